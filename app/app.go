@@ -23,11 +23,24 @@
 package app
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cacheserver"
+	"github.com/TrianaLab/remake/internal/makefile"
+	"github.com/TrianaLab/remake/internal/progress"
+	"github.com/TrianaLab/remake/internal/redact"
 	"github.com/TrianaLab/remake/internal/run"
 	"github.com/TrianaLab/remake/internal/store"
 	"github.com/spf13/viper"
@@ -90,24 +103,184 @@ func (a *App) Login(ctx context.Context, registry, user, pass string) error {
 	if err := a.store.Login(ctx, registry, user, pass); err != nil {
 		return err
 	}
+	return a.loggedIn(registry)
+}
+
+// LoginToken stores an access token for an HTTP(S) endpoint. The token is
+// sent as a bearer token (or in the header configured for the host) on later
+// pulls and pushes.
+func (a *App) LoginToken(ctx context.Context, endpoint, token string) error {
+	if a.Cfg.ParseReference(endpoint) != config.ReferenceHTTP {
+		return fmt.Errorf("token login is only supported for HTTP(S) endpoints: %s", endpoint)
+	}
+	if err := a.store.Login(ctx, endpoint, "", token); err != nil {
+		return err
+	}
+	return a.loggedIn(endpoint)
+}
+
+// loggedIn reports a successful login to registry.
+func (a *App) loggedIn(registry string) error {
+	if a.jsonOutput() {
+		return printJSON(LoginResult{Registry: registry, LoggedIn: true})
+	}
 	fmt.Println("Login succeeded ✅")
 	return nil
 }
 
 // Push uploads a local Makefile artifact to the given OCI reference.
 // reference should be in the form "registry/repo:tag".
-func (a *App) Push(ctx context.Context, reference, path string) error {
-	return a.store.Push(ctx, reference, path)
+// Progress is reported on stderr unless Cfg.Quiet is set. On success the
+// reference pinned to the pushed digest is printed, and when digestFile is
+// set the digest is also written there for later CI steps.
+func (a *App) Push(ctx context.Context, reference, path, digestFile string) error {
+	desc, err := a.store.Push(a.withProgress(ctx), reference, path)
+	if err != nil {
+		return err
+	}
+	if digestFile != "" {
+		if err := os.WriteFile(digestFile, []byte(desc.Digest.String()+"\n"), 0o644); err != nil {
+			return fmt.Errorf("writing digest file: %w", err)
+		}
+	}
+	pinned := a.pinnedReference(reference, desc.Digest.String())
+	if a.jsonOutput() {
+		return printJSON(PushResult{
+			Reference: reference,
+			Digest:    desc.Digest.String(),
+			MediaType: desc.MediaType,
+			Size:      desc.Size,
+			Pinned:    pinned,
+		})
+	}
+	fmt.Println(pinned)
+	return nil
+}
+
+// pinnedReference returns reference pinned to dgst in the syntax its type
+// understands: a '#<digest>' fragment for HTTP(S) URLs, and '@<digest>' in
+// place of the tag for OCI layouts or after it for registry references.
+func (a *App) pinnedReference(reference, dgst string) string {
+	switch a.Cfg.ParseReference(reference) {
+	case config.ReferenceHTTP:
+		base, _, _ := strings.Cut(reference, "#")
+		return base + "#" + dgst
+	case config.ReferenceOCILayout:
+		if l, err := config.ParseLayoutReference(reference); err == nil {
+			return config.LayoutScheme + l.Path + "@" + dgst
+		}
+	}
+	if at := strings.LastIndex(reference, "@"); at > strings.LastIndex(reference, "/") {
+		reference = reference[:at]
+	}
+	return reference + "@" + dgst
+}
+
+// Copy promotes the artifact at src to dst directly between registries,
+// without pulling it through the local cache.
+func (a *App) Copy(ctx context.Context, src, dst string) error {
+	if err := a.store.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	return a.transferred(src, dst)
+}
+
+// Export copies the artifact at reference into an OCI image layout directory,
+// or a tarball when path ends in ".tar", for air-gapped transfer.
+func (a *App) Export(ctx context.Context, reference, path string) error {
+	if err := a.store.Export(ctx, reference, path); err != nil {
+		return err
+	}
+	return a.transferred(reference, path)
+}
+
+// Import copies an artifact from an OCI image layout directory or tarball at
+// path to reference, typically a registry on the other side of an air gap.
+func (a *App) Import(ctx context.Context, path, reference string) error {
+	if err := a.store.Import(ctx, path, reference); err != nil {
+		return err
+	}
+	return a.transferred(path, reference)
+}
+
+// transferred reports a copy from src to dst. Only JSON output prints
+// anything, as the text output of these commands is silent on success.
+func (a *App) transferred(src, dst string) error {
+	if a.jsonOutput() {
+		return printJSON(TransferResult{Source: src, Destination: dst})
+	}
+	return nil
+}
+
+// Delete removes the artifact behind reference from its registry, together
+// with every tag pointing to it. Unless yes is set, the user is asked to
+// confirm on the terminal first.
+func (a *App) Delete(ctx context.Context, reference string, yes bool) error {
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Delete %s and all tags pointing to it?", reference))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			return a.removed(reference, false, "")
+		}
+	}
+	if err := a.store.Delete(ctx, reference); err != nil {
+		return err
+	}
+	return a.removed(reference, true, "Deleted")
+}
+
+// Untag removes the tag in reference from its registry, keeping the
+// underlying artifact. Unless yes is set, the user is asked to confirm first.
+func (a *App) Untag(ctx context.Context, reference string, yes bool) error {
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Remove tag %s?", reference))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			return a.removed(reference, false, "")
+		}
+	}
+	if err := a.store.Untag(ctx, reference); err != nil {
+		return err
+	}
+	return a.removed(reference, true, "Untagged")
+}
+
+// removed reports the outcome of a delete or untag of reference; verb is
+// the past tense printed in text mode when removed is set.
+func (a *App) removed(reference string, removed bool, verb string) error {
+	if a.jsonOutput() {
+		return printJSON(ReferenceResult{Reference: reference, Removed: removed})
+	}
+	if removed {
+		fmt.Printf("%s %s\n", verb, reference)
+	}
+	return nil
 }
 
 // Pull fetches a remote Makefile artifact and prints its contents to stdout.
 // It first retrieves the file from cache or, on cache miss, from the registry.
+// Download progress is reported on stderr unless Cfg.Quiet is set. With JSON
+// output, a PullResult describing the cached file is printed instead.
 func (a *App) Pull(ctx context.Context, reference string) error {
-	path, err := a.store.Pull(ctx, reference)
+	artifact, err := a.store.Pull(a.withProgress(ctx), reference)
 	if err != nil {
 		return err
 	}
-	data, err := os.ReadFile(path)
+	if a.jsonOutput() {
+		return printJSON(PullResult{
+			Reference: reference,
+			Path:      artifact.Path,
+			Digest:    artifact.Digest.String(),
+			CacheHit:  artifact.Cached,
+		})
+	}
+	data, err := os.ReadFile(artifact.Path)
 	if err != nil {
 		return err
 	}
@@ -115,12 +288,304 @@ func (a *App) Pull(ctx context.Context, reference string) error {
 	return nil
 }
 
+// Targets pulls the specified Makefile (from cache or registry) and prints
+// its targets and the variables it assigns with '?=' defaults, with their
+// '##' descriptions (see makefile.Parse).
+func (a *App) Targets(ctx context.Context, reference string) error {
+	artifact, err := a.store.Pull(ctx, reference)
+	if err != nil {
+		return err
+	}
+	info, err := makefile.Parse(artifact.Path)
+	if err != nil {
+		return err
+	}
+	if a.jsonOutput() {
+		result := TargetsResult{Reference: reference, Targets: []TargetResult{}, Variables: []VariableResult{}}
+		for _, t := range info.Targets {
+			result.Targets = append(result.Targets, TargetResult(t))
+		}
+		for _, v := range info.Variables {
+			result.Variables = append(result.Variables, VariableResult(v))
+		}
+		return printJSON(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TARGET\tPHONY\tDESCRIPTION")
+	for _, t := range info.Targets {
+		phony := "no"
+		if t.Phony {
+			phony = "yes"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, phony, t.Description)
+	}
+	if len(info.Variables) > 0 {
+		_, _ = fmt.Fprintln(w, "\nVARIABLE\tDEFAULT\tDESCRIPTION")
+		for _, v := range info.Variables {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, v.Default, v.Description)
+		}
+	}
+	return w.Flush()
+}
+
+// RunOptions are the options of Run besides the Makefile reference.
+type RunOptions struct {
+	// Workdir is the directory make runs in; empty means the current one.
+	Workdir string
+
+	// MakeFlags are passed through to make.
+	MakeFlags []string
+
+	// Vars are passed to make as command-line variables, overriding those
+	// configured for the reference in the 'vars' section of the config file.
+	Vars []run.Var
+
+	// Targets are the targets to build.
+	Targets []string
+
+	// Interactive asks the user on the terminal which targets to build and
+	// for the values of overridable variables when no targets are given.
+	// It has no effect when stdin is not a terminal.
+	Interactive bool
+
+	// Sandbox runs make in a sandbox with the settings configured for the
+	// reference. References configured with 'always' are sandboxed anyway.
+	Sandbox bool
+
+	// Image is the container image make runs in, overriding the image
+	// declared by the artifact's annotations or the Makefile.
+	Image string
+
+	// DryRun prints how the reference was resolved and the make command
+	// that would run, followed by its recipes from 'make -n', instead of
+	// running it.
+	DryRun bool
+}
+
 // Run pulls the specified Makefile (from cache or registry) and executes
-// the given targets using the configured process runner.
-func (a *App) Run(ctx context.Context, reference string, makeFlags, targets []string) error {
-	path, err := a.store.Pull(ctx, reference)
+// the given targets using the configured process runner. The variables
+// configured for reference are passed to make along with opts.Vars. When
+// opts.Interactive is set and no targets are given, the user picks them and
+// fills in variables on the terminal first (see pick). With opts.DryRun, how
+// the reference was resolved is printed before the runner shows what make
+// would do. make runs in opts.Image, or the image declared by the
+// artifact, when set. With JSON output, a RunResult is printed once make
+// exits, even when it fails.
+func (a *App) Run(ctx context.Context, reference string, opts RunOptions) error {
+	artifact, err := a.store.Pull(ctx, reference)
 	if err != nil {
 		return err
 	}
-	return a.runner.Run(ctx, path, makeFlags, targets)
+	var vars []run.Var
+	for _, assignment := range a.Cfg.ReferenceVars(resolvedReference(reference, artifact)) {
+		v, err := run.ParseVar(assignment)
+		if err != nil {
+			return fmt.Errorf("vars for %s: %w", reference, err)
+		}
+		vars = append(vars, v)
+	}
+	vars = append(vars, opts.Vars...)
+	targets := opts.Targets
+	if opts.Interactive && len(targets) == 0 {
+		if !stdinIsTerminal() {
+			a.Cfg.Log().Info("stdin is not a terminal, running the default goal", "reference", redact.Reference(reference))
+		} else {
+			info, err := makefile.Parse(artifact.Path)
+			if err != nil {
+				return err
+			}
+			picked, pickedVars, err := pick(bufio.NewReader(os.Stdin), os.Stderr, reference, info, vars)
+			if err != nil {
+				return err
+			}
+			targets, vars = picked, append(vars, pickedVars...)
+		}
+	}
+	kind := a.Cfg.ParseReference(reference)
+	remote := kind != config.ReferenceLocal
+	var sandbox *config.Sandbox
+	if sb, ok := a.Cfg.SandboxFor(resolvedReference(reference, artifact)); opts.Sandbox || (ok && sb.Always) {
+		sandbox = &sb
+	}
+	image := opts.Image
+	if image == "" {
+		image = artifact.Annotations[makefile.AnnotationImage]
+	}
+	if opts.DryRun && !a.jsonOutput() {
+		printResolution(reference, artifact, kind)
+	}
+	a.Cfg.Log().Debug("running artifact", "reference", redact.Reference(reference), "path", artifact.Path)
+	start := time.Now()
+	err = a.runner.Run(ctx, run.Job{
+		Makefile:       artifact.Path,
+		Reference:      reference,
+		Digest:         artifact.Digest.String(),
+		Remote:         remote,
+		Workdir:        opts.Workdir,
+		MakeFlags:      opts.MakeFlags,
+		Vars:           vars,
+		Targets:        targets,
+		DryRun:         opts.DryRun,
+		Sandbox:        sandbox,
+		Image:          image,
+		MinMakeVersion: artifact.Annotations[makefile.AnnotationRequiresMake],
+	})
+	if !a.jsonOutput() {
+		return err
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return err
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	if printErr := printJSON(RunResult{
+		Reference:       reference,
+		Resolved:        artifact.Resolved,
+		Digest:          artifact.Digest.String(),
+		CacheHit:        artifact.Cached,
+		ExitCode:        exitCode,
+		DurationSeconds: time.Since(start).Seconds(),
+		DryRun:          opts.DryRun,
+	}); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// printResolution prints how reference, of the given kind, was resolved to
+// artifact for a dry run: the fully qualified reference when it differs,
+// the registry and tag or digest of OCI references, the digest of the
+// Makefile and, for remote references, whether it was a cache hit.
+func printResolution(reference string, artifact store.Artifact, kind config.ReferenceType) {
+	fmt.Printf("Reference: %s\n", reference)
+	resolved := resolvedReference(reference, artifact)
+	if resolved != reference {
+		fmt.Printf("Resolved:  %s\n", resolved)
+	}
+	if kind == config.ReferenceOCI {
+		registry, tag := splitResolved(strings.TrimPrefix(resolved, "oci://"))
+		fmt.Printf("Registry:  %s\nTag:       %s\n", registry, tag)
+	}
+	fmt.Printf("Digest:    %s\n", artifact.Digest)
+	if kind != config.ReferenceLocal {
+		cache := "miss"
+		if artifact.Cached {
+			cache = "hit"
+		}
+		fmt.Printf("Cache:     %s\n", cache)
+	}
+}
+
+// resolvedReference returns the fully qualified reference artifact was
+// resolved from, such as ghcr.io/org/repo:latest for org/repo or
+// oci://ghcr.io/org/repo, which per-reference settings are matched against
+// so that short forms cannot bypass them.
+func resolvedReference(reference string, artifact store.Artifact) string {
+	if artifact.Resolved != "" {
+		return artifact.Resolved
+	}
+	return reference
+}
+
+// splitResolved returns the registry and the tag or digest of a fully
+// qualified OCI reference such as ghcr.io/org/repo:tag.
+func splitResolved(resolved string) (registry, tag string) {
+	registry, _, _ = strings.Cut(resolved, "/")
+	if at := strings.LastIndex(resolved, "@"); at >= 0 {
+		return registry, resolved[at+1:]
+	}
+	if colon := strings.LastIndex(resolved, ":"); colon > strings.LastIndex(resolved, "/") {
+		return registry, resolved[colon+1:]
+	}
+	return registry, ""
+}
+
+// Version prints the CLI version, and with JSON output the commit, Go
+// version and platform it was built for.
+func (a *App) Version() error {
+	if a.jsonOutput() {
+		return printJSON(VersionResult{
+			Version:   a.Cfg.Version,
+			Commit:    a.Cfg.Commit,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		})
+	}
+	fmt.Printf("Remake version: %s\n", a.Cfg.Version)
+	return nil
+}
+
+// PrintConfig prints the configuration file, or with JSON output the
+// effective settings including defaults.
+func (a *App) PrintConfig() error {
+	if a.jsonOutput() {
+		return printJSON(viper.AllSettings())
+	}
+	return a.Cfg.PrintConfig()
+}
+
+// ServeCache serves the local cache over HTTP on addr until ctx is done.
+// Requests are answered from the cache, or fetched from upstream registries
+// and cached on the way, so every client configured with 'cacheServer'
+// pointing here shares one warm cache.
+func (a *App) ServeCache(ctx context.Context, addr string) error {
+	s := a.store
+	if a.Cfg.CacheServer != "" {
+		// Never forward to a cache server from a cache server, which
+		// could be this very one
+		cfg := *a.Cfg
+		cfg.CacheServer = ""
+		s = store.New(&cfg)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler: cacheserver.NewHandler(a.Cfg, cacheserver.PullFunc(func(ctx context.Context, reference string) (string, error) {
+			artifact, err := s.Pull(ctx, reference)
+			return artifact.Path, err
+		})),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = srv.Close()
+		case <-done:
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving cache %s on http://%s\n", a.Cfg.CacheDir, ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// withProgress returns ctx carrying a progress reporter writing to stderr,
+// or ctx unchanged when progress output is disabled.
+func (a *App) withProgress(ctx context.Context) context.Context {
+	if a.Cfg.Quiet {
+		return ctx
+	}
+	return progress.WithReporter(ctx, progress.New(os.Stderr))
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from stdin
+// (see prompt). Anything other than "y" or "yes", including an empty line or
+// the end of input, is treated as a refusal.
+func confirm(question string) (bool, error) {
+	answer, err := prompt(bufio.NewReader(os.Stdin), os.Stderr, question+" [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
 }
@@ -22,15 +22,30 @@
 package app
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/makefile"
+	"github.com/TrianaLab/remake/internal/run"
+	"github.com/TrianaLab/remake/internal/store"
 	"github.com/creack/pty"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/viper"
 )
 
@@ -57,8 +72,17 @@ type fakeStoreArgs struct {
 	registryArg, userArg, passArg string
 	pushArgs                      []string
 	pushErr                       error
+	pushDesc                      v1.Descriptor
 	pullPath                      string
+	pullCached                    bool
+	pullResolved                  string
+	pullAnnotations               map[string]string
 	pullErr                       error
+	copyArgs                      []string
+	copyErr                       error
+	deleteArgs                    []string
+	deleteErr                     error
+	references                    []string
 }
 
 func (f *fakeStoreArgs) Login(ctx context.Context, registry, user, pass string) error {
@@ -67,22 +91,55 @@ func (f *fakeStoreArgs) Login(ctx context.Context, registry, user, pass string)
 	return f.loginErr
 }
 
-func (f *fakeStoreArgs) Push(ctx context.Context, reference, path string) error {
+func (f *fakeStoreArgs) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
 	f.pushArgs = []string{reference, path}
-	return f.pushErr
+	return f.pushDesc, f.pushErr
 }
 
-func (f *fakeStoreArgs) Pull(ctx context.Context, reference string) (string, error) {
+func (f *fakeStoreArgs) Pull(ctx context.Context, reference string) (store.Artifact, error) {
+	return store.Artifact{Path: f.pullPath, Digest: digest.FromString(f.pullPath), Cached: f.pullCached, Resolved: f.pullResolved, Annotations: f.pullAnnotations}, f.pullErr
+}
+
+func (f *fakeStoreArgs) Lookup(ctx context.Context, reference string) (string, error) {
 	return f.pullPath, f.pullErr
 }
 
+func (f *fakeStoreArgs) References(ctx context.Context) ([]string, error) {
+	return f.references, nil
+}
+
+func (f *fakeStoreArgs) Copy(ctx context.Context, src, dst string) error {
+	f.copyArgs = []string{src, dst}
+	return f.copyErr
+}
+
+func (f *fakeStoreArgs) Delete(ctx context.Context, reference string) error {
+	f.deleteArgs = append(f.deleteArgs, "delete:"+reference)
+	return f.deleteErr
+}
+
+func (f *fakeStoreArgs) Untag(ctx context.Context, reference string) error {
+	f.deleteArgs = append(f.deleteArgs, "untag:"+reference)
+	return f.deleteErr
+}
+
+func (f *fakeStoreArgs) Export(ctx context.Context, reference, path string) error {
+	f.copyArgs = []string{reference, path}
+	return f.copyErr
+}
+
+func (f *fakeStoreArgs) Import(ctx context.Context, path, reference string) error {
+	f.copyArgs = []string{path, reference}
+	return f.copyErr
+}
+
 type fakeRunnerErr struct {
-	runArgs []interface{}
-	runErr  error
+	job    run.Job
+	runErr error
 }
 
-func (f *fakeRunnerErr) Run(ctx context.Context, path string, makeFlags, targets []string) error {
-	f.runArgs = []interface{}{path, makeFlags, targets}
+func (f *fakeRunnerErr) Run(ctx context.Context, job run.Job) error {
+	f.job = job
 	return f.runErr
 }
 
@@ -127,17 +184,161 @@ func TestLoginErrorPropagates(t *testing.T) {
 	})
 }
 
+// TestLoginTokenHTTPOnly ensures tokens are only accepted for HTTP(S) endpoints.
+func TestLoginTokenHTTPOnly(t *testing.T) {
+	fs := &fakeStoreArgs{}
+	app := &App{store: fs, runner: &fakeRunnerErr{}, Cfg: &config.Config{}}
+
+	if err := app.LoginToken(context.Background(), "ghcr.io", "tok"); err == nil {
+		t.Fatal("expected error for OCI registry")
+	}
+	out, _ := capture(func() {
+		if err := app.LoginToken(context.Background(), "https://files.example.com", "tok"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if out != "Login succeeded ✅\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if fs.registryArg != "https://files.example.com" || fs.userArg != "" || fs.passArg != "tok" {
+		t.Errorf("unexpected store args: %q %q %q", fs.registryArg, fs.userArg, fs.passArg)
+	}
+}
+
 // TestPushError ensures Push returns store errors.
 func TestPushError(t *testing.T) {
 	cfg := &config.Config{}
 	fs := &fakeStoreArgs{pushErr: errors.New("push fail")}
 	app := &App{store: fs, runner: &fakeRunnerErr{}, Cfg: cfg}
 
-	if err := app.Push(context.Background(), "ref", "path"); err == nil || err.Error() != "push fail" {
+	if err := app.Push(context.Background(), "ref", "path", ""); err == nil || err.Error() != "push fail" {
 		t.Fatalf("expected push fail, got %v", err)
 	}
 }
 
+// TestPushPrintsPinnedReference ensures Push prints the reference pinned to
+// the pushed digest and writes the digest file.
+func TestPushPrintsPinnedReference(t *testing.T) {
+	dgst := digest.FromString("manifest")
+	fs := &fakeStoreArgs{pushDesc: v1.Descriptor{Digest: dgst}}
+	app := &App{store: fs, runner: &fakeRunnerErr{}, Cfg: &config.Config{Quiet: true}}
+	digestFile := filepath.Join(t.TempDir(), "digest.txt")
+
+	tests := map[string]string{
+		"ghcr.io/org/make:v1":                  "ghcr.io/org/make:v1@" + dgst.String(),
+		"ghcr.io/org/make@sha256:old":          "ghcr.io/org/make@" + dgst.String(),
+		"localhost:5000/make":                  "localhost:5000/make@" + dgst.String(),
+		"https://files.example.com/ci.mk":      "https://files.example.com/ci.mk#" + dgst.String(),
+		"https://files.example.com/ci.mk#v1":   "https://files.example.com/ci.mk#" + dgst.String(),
+		config.LayoutScheme + "/tmp/layout:v1": config.LayoutScheme + "/tmp/layout@" + dgst.String(),
+	}
+	for ref, want := range tests {
+		out, _ := capture(func() {
+			if err := app.Push(context.Background(), ref, "Makefile", digestFile); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+		if out != want+"\n" {
+			t.Errorf("push %s: expected %q, got %q", ref, want, out)
+		}
+	}
+	if data, err := os.ReadFile(digestFile); err != nil || string(data) != dgst.String()+"\n" {
+		t.Errorf("expected digest file, got %q (%v)", data, err)
+	}
+
+	if err := app.Push(context.Background(), "ghcr.io/org/make:v1", "Makefile", filepath.Join(digestFile, "x")); err == nil {
+		t.Error("expected error writing digest file")
+	}
+}
+
+// TestCopyDelegatesToStore ensures Copy forwards both references to the store.
+func TestCopyDelegatesToStore(t *testing.T) {
+	fs := &fakeStoreArgs{}
+	app := &App{store: fs, runner: &fakeRunnerErr{}, Cfg: &config.Config{}}
+
+	if err := app.Copy(context.Background(), "src:1", "dst:1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fs.copyArgs) != 2 || fs.copyArgs[0] != "src:1" || fs.copyArgs[1] != "dst:1" {
+		t.Errorf("unexpected copy args: %v", fs.copyArgs)
+	}
+}
+
+// withStdin replaces os.Stdin with a pipe fed with input for the duration of f.
+func withStdin(t *testing.T, input string, f func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteString(input)
+	_ = w.Close()
+	orig := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = orig }()
+	f()
+}
+
+// TestDeleteConfirmation ensures Delete and Untag only reach the store once confirmed.
+func TestDeleteConfirmation(t *testing.T) {
+	fs := &fakeStoreArgs{}
+	app := &App{store: fs, runner: &fakeRunnerErr{}, Cfg: &config.Config{}}
+
+	withStdin(t, "n\n", func() {
+		_, stderr := capture(func() {
+			if err := app.Delete(context.Background(), "reg/repo:1", false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+		if stderr == "" {
+			t.Error("expected confirmation prompt on stderr")
+		}
+	})
+	if len(fs.deleteArgs) != 0 {
+		t.Fatalf("expected no store call after refusal, got %v", fs.deleteArgs)
+	}
+
+	withStdin(t, "yes\n", func() {
+		out, _ := capture(func() {
+			if err := app.Untag(context.Background(), "reg/repo:2", false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+		if out != "Untagged reg/repo:2\n" {
+			t.Errorf("unexpected output %q", out)
+		}
+	})
+
+	_, _ = capture(func() {
+		if err := app.Delete(context.Background(), "reg/repo:3", true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	want := []string{"untag:reg/repo:2", "delete:reg/repo:3"}
+	if len(fs.deleteArgs) != 2 || fs.deleteArgs[0] != want[0] || fs.deleteArgs[1] != want[1] {
+		t.Errorf("expected %v, got %v", want, fs.deleteArgs)
+	}
+
+	// an empty line or the end of input refuse too
+	for _, input := range []string{"\n", ""} {
+		withStdin(t, input, func() {
+			_, _ = capture(func() {
+				if err := app.Delete(context.Background(), "reg/repo:5", false); err != nil {
+					t.Errorf("%q: unexpected error: %v", input, err)
+				}
+			})
+		})
+	}
+	if len(fs.deleteArgs) != 2 {
+		t.Errorf("expected no store call without an answer, got %v", fs.deleteArgs)
+	}
+
+	fs.deleteErr = errors.New("delete fail")
+	if err := app.Delete(context.Background(), "reg/repo:4", true); err == nil {
+		t.Error("expected store error")
+	}
+}
+
 // TestPullStoreError ensures Pull returns store errors.
 func TestPullStoreError(t *testing.T) {
 	cfg := &config.Config{}
@@ -183,6 +384,45 @@ func TestPullPrintsFileContent(t *testing.T) {
 	}
 }
 
+// TestTargets ensures Targets lists the targets and variables of the
+// pulled Makefile as a table and as JSON.
+func TestTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(path, []byte(".PHONY: up\nPORT ?= 6379 ## Port\nup: ## Start\n\ttrue\n"), 0o644)
+	cfg := &config.Config{}
+	app := &App{store: &fakeStoreArgs{pullPath: path}, runner: &fakeRunnerErr{}, Cfg: cfg}
+
+	out, _ := capture(func() {
+		if err := app.Targets(context.Background(), "ghcr.io/org/make:v1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	want := "TARGET  PHONY  DESCRIPTION\nup      yes    Start\n\nVARIABLE  DEFAULT  DESCRIPTION\nPORT      6379     Port\n"
+	if out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+
+	cfg.Output = config.OutputJSON
+	out, _ = capture(func() {
+		if err := app.Targets(context.Background(), "ghcr.io/org/make:v1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	var result TargetsResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if len(result.Targets) != 1 || result.Targets[0] != (TargetResult{Name: "up", Description: "Start", Phony: true}) ||
+		len(result.Variables) != 1 || result.Variables[0].Default != "6379" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	app.store = &fakeStoreArgs{pullErr: errors.New("pull fail")}
+	if err := app.Targets(context.Background(), "ref"); err == nil {
+		t.Error("expected pull error")
+	}
+}
+
 // TestRunPullError ensures Run returns errors from Pull.
 func TestRunPullError(t *testing.T) {
 	cfg := &config.Config{}
@@ -190,7 +430,7 @@ func TestRunPullError(t *testing.T) {
 	fr := &fakeRunnerErr{}
 	app := &App{store: fs, runner: fr, Cfg: cfg}
 
-	if err := app.Run(context.Background(), "ref", nil, []string{"t"}); err == nil || err.Error() != "pull err" {
+	if err := app.Run(context.Background(), "ref", RunOptions{Targets: []string{"t"}}); err == nil || err.Error() != "pull err" {
 		t.Fatalf("expected pull err, got %v", err)
 	}
 }
@@ -202,11 +442,238 @@ func TestRunRunnerError(t *testing.T) {
 	fr := &fakeRunnerErr{runErr: errors.New("run err")}
 	app := &App{store: fs, runner: fr, Cfg: cfg}
 
-	if err := app.Run(context.Background(), "ref", []string{"-j4"}, []string{"build"}); err == nil || err.Error() != "run err" {
+	if err := app.Run(context.Background(), "ref", RunOptions{MakeFlags: []string{"-j4"}, Targets: []string{"build"}}); err == nil || err.Error() != "run err" {
 		t.Fatalf("expected run err, got %v", err)
 	}
 }
 
+// TestRunBuildsJob ensures Run passes the resolved artifact and options to
+// the runner.
+func TestRunBuildsJob(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(local, []byte("all:\n"), 0o644)
+	fs := &fakeStoreArgs{pullPath: "/cache/blob"}
+	fr := &fakeRunnerErr{}
+	app := &App{store: fs, runner: fr, Cfg: &config.Config{}}
+
+	opts := RunOptions{Workdir: "/src", MakeFlags: []string{"-j4"}, Targets: []string{"build"}}
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := run.Job{
+		Makefile:  "/cache/blob",
+		Reference: "ghcr.io/org/make:v1",
+		Digest:    digest.FromString("/cache/blob").String(),
+		Remote:    true,
+		Workdir:   "/src",
+		MakeFlags: []string{"-j4"},
+		Targets:   []string{"build"},
+	}
+	if fmt.Sprint(fr.job) != fmt.Sprint(want) {
+		t.Errorf("expected job %+v, got %+v", want, fr.job)
+	}
+
+	app.Cfg.Vars = map[string][]string{"ghcr.io/org/make": {"PORT=1", "MODE=dev"}}
+	opts.Vars = []run.Var{{Name: "PORT", Value: "2"}}
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantVars := []run.Var{{Name: "PORT", Value: "1"}, {Name: "MODE", Value: "dev"}, {Name: "PORT", Value: "2"}}
+	if fmt.Sprint(fr.job.Vars) != fmt.Sprint(wantVars) {
+		t.Errorf("expected configured vars before option vars %v, got %v", wantVars, fr.job.Vars)
+	}
+	fs.pullResolved = "ghcr.io/org/make:v1"
+	if err := app.Run(context.Background(), "org/make:v1", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(fr.job.Vars) != fmt.Sprint(wantVars) {
+		t.Errorf("expected vars for the resolved reference %v, got %v", wantVars, fr.job.Vars)
+	}
+	fs.pullResolved = ""
+	app.Cfg.Vars = map[string][]string{"ghcr.io/org/make": {"PORT"}}
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", opts); err == nil {
+		t.Error("expected error for invalid configured var")
+	}
+	app.Cfg.Vars = nil
+
+	fs.pullPath = local
+	if err := app.Run(context.Background(), local, RunOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fr.job.Remote {
+		t.Error("expected local Makefiles not to be treated as remote")
+	}
+}
+
+// TestPick ensures targets are picked by number or name and variables not
+// already set are asked for.
+func TestPick(t *testing.T) {
+	info := makefile.Info{
+		Targets:   []makefile.Target{{Name: "up", Description: "Start"}, {Name: "down"}},
+		Variables: []makefile.Variable{{Name: "PORT", Default: "6379", Description: "Port"}, {Name: "MODE", Default: "dev"}, {Name: "TOKEN"}},
+	}
+	in := bufio.NewReader(strings.NewReader("3\n2, logs\n6380\n\n"))
+	var out bytes.Buffer
+	targets, vars, err := pick(in, &out, "ghcr.io/org/make:v1", info, []run.Var{{Name: "TOKEN", Value: "x"}})
+	if err != nil {
+		t.Fatalf("pick error: %v", err)
+	}
+	if strings.Join(targets, " ") != "down logs" {
+		t.Errorf("unexpected targets %v", targets)
+	}
+	if len(vars) != 1 || vars[0] != (run.Var{Name: "PORT", Value: "6380"}) {
+		t.Errorf("unexpected vars %v", vars)
+	}
+	for _, want := range []string{"Targets of ghcr.io/org/make:v1:", "1)  up    Start", "no target number 3", "PORT (Port) [6379]: ", "MODE [dev]: "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in %q", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "TOKEN") {
+		t.Error("expected no prompt for a variable already set")
+	}
+}
+
+// TestRunInteractive ensures Run asks for targets on a terminal and falls
+// back to the default goal otherwise.
+func TestRunInteractive(t *testing.T) {
+	origTerminal, origStdin := stdinIsTerminal, os.Stdin
+	defer func() { stdinIsTerminal, os.Stdin = origTerminal, origStdin }()
+	path := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(path, []byte("up:\n\ttrue\ndown:\n\ttrue\n"), 0o644)
+	fr := &fakeRunnerErr{}
+	app := &App{store: &fakeStoreArgs{pullPath: path}, runner: fr, Cfg: &config.Config{}}
+
+	stdinIsTerminal = func() bool { return false }
+	if err := app.Run(context.Background(), path, RunOptions{Interactive: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fr.job.Targets) != 0 {
+		t.Errorf("expected the default goal without a terminal, got %v", fr.job.Targets)
+	}
+
+	stdinIsTerminal = func() bool { return true }
+	r, w, _ := os.Pipe()
+	_, _ = w.WriteString("2\n")
+	_ = w.Close()
+	os.Stdin = r
+	_, _ = capture(func() {
+		if err := app.Run(context.Background(), path, RunOptions{Interactive: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if strings.Join(fr.job.Targets, " ") != "down" {
+		t.Errorf("expected the picked target, got %v", fr.job.Targets)
+	}
+}
+
+// TestRunDryRun ensures a dry run prints the resolution and asks the runner
+// for a dry run.
+func TestRunDryRun(t *testing.T) {
+	fs := &fakeStoreArgs{pullPath: "/cache/blob", pullCached: true, pullResolved: "ghcr.io/org/make:latest"}
+	fr := &fakeRunnerErr{}
+	app := &App{store: fs, runner: fr, Cfg: &config.Config{}}
+
+	out, _ := capture(func() {
+		if err := app.Run(context.Background(), "org/make", RunOptions{DryRun: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	want := "Reference: org/make\nResolved:  ghcr.io/org/make:latest\nRegistry:  ghcr.io\nTag:       latest\n" +
+		"Digest:    " + digest.FromString("/cache/blob").String() + "\nCache:     hit\n"
+	if out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+	if !fr.job.DryRun {
+		t.Error("expected a dry run job")
+	}
+
+	// fully qualified references still show their registry and tag
+	out, _ = capture(func() {
+		if err := app.Run(context.Background(), "ghcr.io/org/make:latest", RunOptions{DryRun: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	want = "Reference: ghcr.io/org/make:latest\nRegistry:  ghcr.io\nTag:       latest\n" +
+		"Digest:    " + digest.FromString("/cache/blob").String() + "\nCache:     hit\n"
+	if out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
+
+func TestRunSandbox(t *testing.T) {
+	cfg := &config.Config{Sandboxes: map[string]config.Sandbox{
+		"ghcr.io/untrusted/*": {Always: true, Env: []string{"GOCACHE"}},
+		"ghcr.io/org/*":       {Network: true},
+	}}
+	fr := &fakeRunnerErr{}
+	app := &App{store: &fakeStoreArgs{pullPath: "/cache/blob"}, runner: fr, Cfg: cfg}
+
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", RunOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fr.job.Sandbox != nil {
+		t.Errorf("expected no sandbox without --sandbox, got %+v", fr.job.Sandbox)
+	}
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", RunOptions{Sandbox: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fr.job.Sandbox == nil || !fr.job.Sandbox.Network {
+		t.Errorf("expected the configured sandbox, got %+v", fr.job.Sandbox)
+	}
+	if err := app.Run(context.Background(), "ghcr.io/untrusted/make:v1", RunOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fr.job.Sandbox == nil || len(fr.job.Sandbox.Env) != 1 {
+		t.Errorf("expected an always sandboxed run, got %+v", fr.job.Sandbox)
+	}
+
+	// Short forms resolving to a sandboxed repository are sandboxed too
+	app.store = &fakeStoreArgs{pullPath: "/cache/blob", pullResolved: "ghcr.io/untrusted/make:v1"}
+	for _, ref := range []string{"untrusted/make:v1", "oci://ghcr.io/untrusted/make:v1"} {
+		fr.job = run.Job{}
+		if err := app.Run(context.Background(), ref, RunOptions{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fr.job.Sandbox == nil || !fr.job.Sandbox.Always {
+			t.Errorf("%s: expected an always sandboxed run, got %+v", ref, fr.job.Sandbox)
+		}
+	}
+}
+
+func TestRunImage(t *testing.T) {
+	fs := &fakeStoreArgs{pullPath: "/cache/blob", pullAnnotations: map[string]string{makefile.AnnotationImage: "golang:1.24"}}
+	fr := &fakeRunnerErr{}
+	app := &App{store: fs, runner: fr, Cfg: &config.Config{}}
+
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", RunOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fr.job.Image != "golang:1.24" {
+		t.Errorf("expected the annotated image, got %q", fr.job.Image)
+	}
+	if err := app.Run(context.Background(), "ghcr.io/org/make:v1", RunOptions{Image: "alpine:3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fr.job.Image != "alpine:3" {
+		t.Errorf("expected --image to win, got %q", fr.job.Image)
+	}
+}
+
+func TestSplitResolved(t *testing.T) {
+	tests := map[string][2]string{
+		"ghcr.io/org/make:v1":             {"ghcr.io", "v1"},
+		"localhost:5000/make@sha256:abc":  {"localhost:5000", "sha256:abc"},
+		"localhost:5000/make":             {"localhost:5000", ""},
+		"ghcr.io/org/make:v1@sha256:abc1": {"ghcr.io", "sha256:abc1"},
+	}
+	for resolved, want := range tests {
+		if registry, tag := splitResolved(resolved); registry != want[0] || tag != want[1] {
+			t.Errorf("splitResolved(%q) = %q, %q, want %q, %q", resolved, registry, tag, want[0], want[1])
+		}
+	}
+}
+
 // TestNewInitializesFields ensures New sets up store, runner, and config.
 func TestNewInitializesFields(t *testing.T) {
 	cfg := &config.Config{}
@@ -338,3 +805,126 @@ func TestLoginPromptPasswordError(t *testing.T) {
 		}
 	})
 }
+
+func TestServeCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "makefile")
+	_ = os.WriteFile(path, []byte("all:\n"), 0o644)
+	cfg := &config.Config{ServeCacheHosts: []string{"files.example.com"}}
+	app := &App{store: &fakeStoreArgs{pullPath: path}, runner: &fakeRunnerErr{}, Cfg: cfg}
+
+	// Reserve a free port for the server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- app.ServeCache(ctx, addr) }()
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://" + addr + "/pull?ref=https://files.example.com/make.mk"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server did not start: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(data) != "all:\n" {
+		t.Errorf("unexpected body %q", data)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error after shutdown: %v", err)
+	}
+	if err := app.ServeCache(context.Background(), "bad address"); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
+
+// TestJSONOutput ensures commands print stable JSON documents with -o json.
+func TestJSONOutput(t *testing.T) {
+	cfg := &config.Config{Output: config.OutputJSON, Quiet: true, Version: "v1.2.3", Commit: "abc123"}
+	manifest := v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("manifest"), Size: 42}
+	fs := &fakeStoreArgs{pushDesc: manifest, pullPath: "/cache/blob", pullCached: true}
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	fr := &fakeRunnerErr{runErr: exitErr}
+	app := &App{store: fs, runner: fr, Cfg: cfg}
+	ctx := context.Background()
+
+	decode := func(f func() error, v any) {
+		t.Helper()
+		var err error
+		out, _ := capture(func() { err = f() })
+		if uerr := json.Unmarshal([]byte(out), v); uerr != nil {
+			t.Fatalf("invalid JSON %q: %v (command error: %v)", out, uerr, err)
+		}
+	}
+
+	var login LoginResult
+	decode(func() error { return app.Login(ctx, "reg.io", "u", "p") }, &login)
+	if login != (LoginResult{Registry: "reg.io", LoggedIn: true}) {
+		t.Errorf("unexpected login result %+v", login)
+	}
+
+	var push PushResult
+	decode(func() error { return app.Push(ctx, "reg.io/repo:1", "Makefile", "") }, &push)
+	if push != (PushResult{Reference: "reg.io/repo:1", Digest: manifest.Digest.String(), MediaType: manifest.MediaType, Size: 42,
+		Pinned: "reg.io/repo:1@" + manifest.Digest.String()}) {
+		t.Errorf("unexpected push result %+v", push)
+	}
+
+	var pull PullResult
+	decode(func() error { return app.Pull(ctx, "reg.io/repo:1") }, &pull)
+	if pull != (PullResult{Reference: "reg.io/repo:1", Path: "/cache/blob", Digest: digest.FromString("/cache/blob").String(), CacheHit: true}) {
+		t.Errorf("unexpected pull result %+v", pull)
+	}
+
+	var run RunResult
+	decode(func() error {
+		if err := app.Run(ctx, "reg.io/repo:1", RunOptions{Targets: []string{"build"}}); err != exitErr {
+			t.Errorf("expected make's exit error, got %v", err)
+		}
+		return nil
+	}, &run)
+	if run.ExitCode != 3 || run.Digest != pull.Digest || run.Reference != "reg.io/repo:1" {
+		t.Errorf("unexpected run result %+v", run)
+	}
+
+	var version VersionResult
+	decode(app.Version, &version)
+	if version.Version != "v1.2.3" || version.Commit != "abc123" || version.GoVersion != runtime.Version() ||
+		version.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("unexpected version result %+v", version)
+	}
+
+	var removed ReferenceResult
+	decode(func() error { return app.Untag(ctx, "reg.io/repo:1", true) }, &removed)
+	if removed != (ReferenceResult{Reference: "reg.io/repo:1", Removed: true}) {
+		t.Errorf("unexpected untag result %+v", removed)
+	}
+
+	var transfer TransferResult
+	decode(func() error { return app.Copy(ctx, "a:1", "b:1") }, &transfer)
+	if transfer != (TransferResult{Source: "a:1", Destination: "b:1"}) {
+		t.Errorf("unexpected copy result %+v", transfer)
+	}
+
+	// non-exit errors from the runner are returned without a document
+	fr.runErr = errors.New("make not found")
+	out, _ := capture(func() {
+		if err := app.Run(ctx, "reg.io/repo:1", RunOptions{}); err == nil {
+			t.Error("expected runner error")
+		}
+	})
+	if out != "" {
+		t.Errorf("expected no output, got %q", out)
+	}
+}
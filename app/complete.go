@@ -0,0 +1,77 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/makefile"
+	"github.com/TrianaLab/remake/internal/run"
+	"github.com/spf13/viper"
+)
+
+// The methods below back shell completion. They never use the network:
+// remote Makefiles and references are read from the local cache only.
+
+// CompleteTargets returns the targets of the Makefile at reference when run
+// in workdir (see run.Targets). Remote Makefiles that are not cached yield an
+// error rather than being fetched. As make runs the $(shell) calls of the
+// Makefiles it reads, cached remote Makefiles are parsed instead (see
+// makefile.Parse), which leaves out targets from included Makefiles.
+func (a *App) CompleteTargets(ctx context.Context, reference, workdir string) ([]string, error) {
+	path, err := a.store.Lookup(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if a.Cfg.ParseReference(reference) == config.ReferenceLocal {
+		return run.Targets(ctx, a.Cfg, path, workdir)
+	}
+	info, err := makefile.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, 0, len(info.Targets))
+	for _, target := range info.Targets {
+		targets = append(targets, target.Name)
+	}
+	return targets, nil
+}
+
+// CompleteReferences returns the references with an artifact in the cache.
+func (a *App) CompleteReferences(ctx context.Context) ([]string, error) {
+	return a.store.References(ctx)
+}
+
+// CompleteRegistries returns the registries configured in the config file,
+// sorted.
+func (a *App) CompleteRegistries() []string {
+	var registries []string
+	for key := range viper.GetStringMap("registries") {
+		// Keys are normalized with dots replaced, which hosts never contain
+		registries = append(registries, strings.ReplaceAll(key, "_", "."))
+	}
+	sort.Strings(registries)
+	return registries
+}
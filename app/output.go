@@ -0,0 +1,124 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+// The types below are the JSON documents printed on stdout with '-o json'.
+// Their fields are part of the CLI interface: add fields, but do not rename
+// or remove them.
+
+// LoginResult is printed by login.
+type LoginResult struct {
+	Registry string `json:"registry"`
+	LoggedIn bool   `json:"loggedIn"`
+}
+
+// PushResult is printed by push. Digest is that of the pushed manifest, or
+// of the file for HTTP(S) references, and Pinned is the reference pinned to it.
+type PushResult struct {
+	Reference string `json:"reference"`
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType,omitempty"`
+	Size      int64  `json:"size"`
+	Pinned    string `json:"pinned"`
+}
+
+// PullResult is printed by pull. Digest is that of the Makefile content.
+type PullResult struct {
+	Reference string `json:"reference"`
+	Path      string `json:"path"`
+	Digest    string `json:"digest"`
+	CacheHit  bool   `json:"cacheHit"`
+}
+
+// RunResult is printed by run once make exits, successfully or not.
+// Resolved is the fully qualified reference, and DryRun is set for
+// '--dry-run', where make only printed its recipes.
+type RunResult struct {
+	Reference       string  `json:"reference"`
+	Resolved        string  `json:"resolved"`
+	Digest          string  `json:"digest"`
+	CacheHit        bool    `json:"cacheHit"`
+	ExitCode        int     `json:"exitCode"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	DryRun          bool    `json:"dryRun,omitempty"`
+}
+
+// TargetsResult is printed by targets.
+type TargetsResult struct {
+	Reference string           `json:"reference"`
+	Targets   []TargetResult   `json:"targets"`
+	Variables []VariableResult `json:"variables"`
+}
+
+// TargetResult is a target of a TargetsResult.
+type TargetResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Phony       bool   `json:"phony"`
+}
+
+// VariableResult is an overridable variable of a TargetsResult.
+type VariableResult struct {
+	Name        string `json:"name"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+// VersionResult is printed by version.
+type VersionResult struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// ReferenceResult is printed by delete and untag; Removed is false when the
+// user declined the confirmation prompt.
+type ReferenceResult struct {
+	Reference string `json:"reference"`
+	Removed   bool   `json:"removed"`
+}
+
+// TransferResult is printed by copy, export and import.
+type TransferResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// jsonOutput reports whether commands print JSON documents.
+func (a *App) jsonOutput() bool {
+	return a.Cfg.Output == config.OutputJSON
+}
+
+// printJSON writes v to stdout as an indented JSON document.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
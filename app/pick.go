@@ -0,0 +1,126 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/TrianaLab/remake/internal/makefile"
+	"github.com/TrianaLab/remake/internal/run"
+	"golang.org/x/term"
+)
+
+// stdinIsTerminal reports whether stdin is a terminal, which the
+// interactive picker needs. It is a variable so tests can override it.
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// pick lists the targets in info on out and asks which to build, then asks
+// for the value of each variable with a '?=' default that is not already
+// assigned in set. Answers are read line by line from in. Targets are picked
+// by number or name, separated by spaces or commas; an empty answer keeps
+// the default goal, or the variable's default.
+func pick(in *bufio.Reader, out io.Writer, reference string, info makefile.Info, set []run.Var) ([]string, []run.Var, error) {
+	if len(info.Targets) > 0 {
+		_, _ = fmt.Fprintf(out, "Targets of %s:\n", reference)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for i, t := range info.Targets {
+			_, _ = fmt.Fprintf(w, "  %d)\t%s\t%s\n", i+1, t.Name, t.Description)
+		}
+		if err := w.Flush(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var targets []string
+	for {
+		answer, err := prompt(in, out, "Targets to run (numbers or names, empty for the default goal): ")
+		if err != nil {
+			return nil, nil, err
+		}
+		targets, err = pickedTargets(answer, info.Targets)
+		if err == nil {
+			break
+		}
+		_, _ = fmt.Fprintln(out, err)
+	}
+
+	assigned := map[string]bool{}
+	for _, v := range set {
+		assigned[v.Name] = true
+	}
+	var vars []run.Var
+	for _, v := range info.Variables {
+		if assigned[v.Name] {
+			continue
+		}
+		question := v.Name
+		if v.Description != "" {
+			question += " (" + v.Description + ")"
+		}
+		answer, err := prompt(in, out, fmt.Sprintf("%s [%s]: ", question, v.Default))
+		if err != nil {
+			return nil, nil, err
+		}
+		if answer != "" {
+			vars = append(vars, run.Var{Name: v.Name, Value: answer})
+		}
+	}
+	return targets, vars, nil
+}
+
+// pickedTargets returns the targets named or numbered in answer.
+func pickedTargets(answer string, targets []makefile.Target) ([]string, error) {
+	var picked []string
+	for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			// Targets the Makefile parser did not list can still be named
+			picked = append(picked, field)
+			continue
+		}
+		if n < 1 || n > len(targets) {
+			return nil, fmt.Errorf("no target number %d", n)
+		}
+		picked = append(picked, targets[n-1].Name)
+	}
+	return picked, nil
+}
+
+// prompt writes question to out and returns the next line read from in,
+// trimmed. End of input counts as an empty answer.
+func prompt(in *bufio.Reader, out io.Writer, question string) (string, error) {
+	_, _ = fmt.Fprint(out, question)
+	line, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -23,18 +23,26 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"unsafe"
 
 	"github.com/TrianaLab/remake/app"
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/run"
+	"github.com/TrianaLab/remake/internal/store"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -46,35 +54,62 @@ type fakeStore struct {
 	pushErr  error
 	pullErr  error
 	pullPath string
+	copyErr  error
+	delErr   error
+	refs     []string
 }
 
 func (f *fakeStore) Login(ctx context.Context, registry, user, pass string) error {
 	return f.loginErr
 }
 
-func (f *fakeStore) Push(ctx context.Context, reference, path string) error {
-	return f.pushErr
+func (f *fakeStore) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
+	return v1.Descriptor{}, f.pushErr
 }
 
-func (f *fakeStore) Pull(ctx context.Context, reference string) (string, error) {
+func (f *fakeStore) Pull(ctx context.Context, reference string) (store.Artifact, error) {
+	return store.Artifact{Path: f.pullPath}, f.pullErr
+}
+
+func (f *fakeStore) Lookup(ctx context.Context, reference string) (string, error) {
 	return f.pullPath, f.pullErr
 }
 
+func (f *fakeStore) References(ctx context.Context) ([]string, error) {
+	return f.refs, nil
+}
+
+func (f *fakeStore) Copy(ctx context.Context, src, dst string) error {
+	return f.copyErr
+}
+
+func (f *fakeStore) Delete(ctx context.Context, reference string) error {
+	return f.delErr
+}
+
+func (f *fakeStore) Untag(ctx context.Context, reference string) error {
+	return f.delErr
+}
+
+func (f *fakeStore) Export(ctx context.Context, reference, path string) error {
+	return f.copyErr
+}
+
+func (f *fakeStore) Import(ctx context.Context, path, reference string) error {
+	return f.copyErr
+}
+
 // fakeRunner implements run.Runner for testing
 // Captures invocation details.
 type fakeRunner struct {
-	executed  bool
-	err       error
-	path      string
-	makeFlags []string
-	targets   []string
+	executed bool
+	err      error
+	job      run.Job
 }
 
-func (f *fakeRunner) Run(ctx context.Context, path string, makeFlags []string, targets []string) error {
+func (f *fakeRunner) Run(ctx context.Context, job run.Job) error {
 	f.executed = true
-	f.path = path
-	f.makeFlags = makeFlags
-	f.targets = targets
+	f.job = job
 	return f.err
 }
 
@@ -170,6 +205,42 @@ func TestPushCmdErrorPropagation(t *testing.T) {
 	}
 }
 
+func TestCopyCmdErrorPropagation(t *testing.T) {
+	cfg, _ := config.InitConfig()
+	a := app.New(cfg)
+	fs := &fakeStore{copyErr: errors.New("copy failed")}
+	setUnexportedField(a, "store", fs)
+	c := copyCmd(a)
+	c.SilenceUsage = true
+	c.SilenceErrors = true
+
+	_, err := captureCmdOutput(c, []string{"src:1", "dst:1"})
+	if err == nil || err.Error() != "copy failed" {
+		t.Fatalf("expected error 'copy failed', got %v", err)
+	}
+}
+
+func TestDeleteAndUntagCmdWithYes(t *testing.T) {
+	cfg, _ := config.InitConfig()
+	a := app.New(cfg)
+	setUnexportedField(a, "store", &fakeStore{})
+
+	out, err := captureCmdOutput(deleteCmd(a), []string{"reg.io/repo:1", "--yes"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "Deleted reg.io/repo:1\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	out, err = captureCmdOutput(untagCmd(a), []string{"reg.io/repo:1", "-y"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "Untagged reg.io/repo:1\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
 func TestPullCmdHTTP(t *testing.T) {
 	// Start test server
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -208,13 +279,28 @@ func TestRunCmdExecution(t *testing.T) {
 	setUnexportedField(a, "store", fs)
 	setUnexportedField(a, "runner", fr)
 	c := runCmd(a)
-	_, err := captureCmdOutput(c, []string{"all"})
+	envFile := filepath.Join(t.TempDir(), ".env")
+	_ = os.WriteFile(envFile, []byte("TOKEN=abc\n"), 0o644)
+	_, err := captureCmdOutput(c, []string{"all", "-C", "/src", "--env-file", envFile, "--set", "PORT=6380", "--image", "golang:1.24"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if !fr.executed {
 		t.Error("expected runner to execute")
 	}
+	if fr.job.Workdir != "/src" || len(fr.job.Targets) != 1 || fr.job.Targets[0] != "all" || fr.job.Image != "golang:1.24" {
+		t.Errorf("unexpected job %+v", fr.job)
+	}
+	wantVars := []run.Var{{Name: "TOKEN", Value: "abc", Secret: true}, {Name: "PORT", Value: "6380"}}
+	if fmt.Sprint(fr.job.Vars) != fmt.Sprint(wantVars) {
+		t.Errorf("expected vars %v, got %v", wantVars, fr.job.Vars)
+	}
+
+	c = runCmd(a)
+	c.SilenceUsage, c.SilenceErrors = true, true
+	if _, err := captureCmdOutput(c, []string{"all", "--set", "PORT"}); err == nil {
+		t.Error("expected error for invalid --set")
+	}
 }
 
 // TestExecute_InitConfigFatal covers the log.Fatal path in Execute()
@@ -257,3 +343,94 @@ func TestExecute_InitConfigFatal(t *testing.T) {
 		t.Fatalf("expected fatalErr \"boom init\", got %v", fatalErr)
 	}
 }
+
+func TestNewLogger(t *testing.T) {
+	defer func() { verbose, debug = false, false }()
+
+	verbose, debug = false, false
+	if newLogger(io.Discard) != nil {
+		t.Error("expected no logger without --verbose or --debug")
+	}
+	verbose = true
+	if l := newLogger(io.Discard); l == nil || !l.Enabled(context.Background(), slog.LevelInfo) || l.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected an info logger with --verbose")
+	}
+	verbose, debug = false, true
+	if l := newLogger(io.Discard); l == nil || !l.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected a debug logger with --debug")
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	defer func() { output = "" }()
+	viper.Set("cacheDir", t.TempDir())
+	// drop subcommands bound to the apps of earlier Execute calls
+	rootCmd.ResetCommands()
+
+	out := captureOutput(func() {
+		os.Args = []string{"remake", "version", "-o", "json"}
+		if err := Execute(); err != nil {
+			t.Fatalf("Execute error: %v", err)
+		}
+	})
+	var version app.VersionResult
+	if err := json.Unmarshal([]byte(out), &version); err != nil || version.Version == "" {
+		t.Fatalf("expected version JSON, got %q (%v)", out, err)
+	}
+
+	output = ""
+	rootCmd.ResetCommands()
+	os.Args = []string{"remake", "version", "--output", "yaml"}
+	rootCmd.SilenceErrors = true
+	defer func() { rootCmd.SilenceErrors = false }()
+	if err := Execute(); err == nil || !strings.Contains(err.Error(), "invalid output") {
+		t.Fatalf("expected invalid output error, got %v", err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("up:\n\ttrue\ndown:\n\ttrue\n"), 0o644)
+	viper.Reset()
+	viper.Set("registries.ghcr_io.username", "me")
+	viper.Set("registries.registry_example_com:5000.username", "me")
+
+	a := app.New(&config.Config{})
+	setUnexportedField(a, "store", &fakeStore{pullPath: mk, refs: []string{"ghcr.io/org/make:v1", "https://example.com/go.mk"}})
+
+	refs, directive := completeReferences(a)(nil, nil, "ghcr")
+	if len(refs) != 1 || refs[0] != "ghcr.io/org/make:v1" || directive != cobra.ShellCompDirectiveDefault {
+		t.Errorf("unexpected reference completions %v (%v)", refs, directive)
+	}
+	registries, _ := completeRegistries(a)(nil, nil, "")
+	if strings.Join(registries, " ") != "ghcr.io registry.example.com:5000" {
+		t.Errorf("unexpected registry completions %v", registries)
+	}
+	if registries, _ := completeRegistries(a)(nil, []string{"ghcr.io"}, ""); len(registries) != 0 {
+		t.Errorf("expected no completions after the registry, got %v", registries)
+	}
+
+	// cached remote Makefiles are parsed rather than read by make
+	remote := filepath.Join(t.TempDir(), "sha256:abc")
+	ran := filepath.Join(t.TempDir(), "ran")
+	_ = os.WriteFile(remote, []byte("X := $(shell touch "+ran+")\nbuild:\n\ttrue\ntest:\n\ttrue\n"), 0o644)
+	setUnexportedField(a, "store", &fakeStore{pullPath: remote})
+	file, workdir := "ghcr.io/org/make:v1", ""
+	targets, directive := completeTargets(a, &file, &workdir)(nil, nil, "")
+	if strings.Join(targets, " ") != "build test" || directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("unexpected remote target completions %v (%v)", targets, directive)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("expected no $(shell) call to run while completing a remote Makefile")
+	}
+
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make not installed")
+	}
+	setUnexportedField(a, "store", &fakeStore{pullPath: mk})
+	file = mk
+	targets, directive = completeTargets(a, &file, &workdir)(nil, []string{"up"}, "")
+	if strings.Join(targets, " ") != "down" || directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("unexpected target completions %v (%v)", targets, directive)
+	}
+}
@@ -0,0 +1,93 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the time spent computing one shell completion.
+const completionTimeout = 5 * time.Second
+
+// completeFunc is the signature of Cobra's argument and flag completion
+// functions.
+type completeFunc = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// completeTargets completes the targets of the Makefile in the -f flag
+// (see app.CompleteTargets), leaving out targets already given. file and
+// workdir point at the command's flag variables, which Cobra has parsed by
+// the time it asks for completions.
+func completeTargets(a *app.App, file, workdir *string) completeFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		targets, err := a.CompleteTargets(ctx, *file, *workdir)
+		if err != nil {
+			cobra.CompDebugln("completing targets: "+err.Error(), true)
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return matching(targets, toComplete, args), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeReferences completes -f flags with the cached references, falling
+// back to local file names.
+func completeReferences(a *app.App) completeFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		refs, err := a.CompleteReferences(ctx)
+		if err != nil {
+			cobra.CompDebugln("completing references: "+err.Error(), true)
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return matching(refs, toComplete, nil), cobra.ShellCompDirectiveDefault
+	}
+}
+
+// completeRegistries completes the registry argument of login with the
+// registries in the config file.
+func completeRegistries(a *app.App) completeFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return matching(a.CompleteRegistries(), toComplete, nil), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// matching returns the values starting with prefix that are not in exclude.
+func matching(values []string, prefix string, exclude []string) []string {
+	var matches []string
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) && !slices.Contains(exclude, v) {
+			matches = append(matches, v)
+		}
+	}
+	return matches
+}
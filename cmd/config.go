@@ -44,10 +44,13 @@ Use this to verify or export your active settings before running other commands.
   remake config
 
   # Save current configuration to a file
-  remake config > config.yaml`,
+  remake config > config.yaml
+
+  # Print the effective settings, including defaults, as JSON
+  remake config -o json`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return app.Cfg.PrintConfig()
+			return app.PrintConfig()
 		},
 	}
 	return cmd
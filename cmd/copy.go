@@ -0,0 +1,57 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// copyCmd returns the Cobra command for promoting a Makefile artifact from
+// one OCI reference to another. The artifact is copied registry-to-registry
+// without being downloaded into the local cache.
+func copyCmd(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "copy <src-reference> <dst-reference>",
+		Short: "Copy a Makefile artifact between OCI registries",
+		Long: `Copy the Makefile artifact at <src-reference> to <dst-reference> directly
+between registries. The manifest is transferred unchanged, so the digest and
+annotations are preserved, and referrers such as signatures are copied along
+with it.
+
+Credentials for both registries are read from configuration; use
+'remake login' for each registry beforehand if required.`,
+		Example: `  # Promote a Makefile from staging to production
+  remake copy staging.example.com/myorg/myrepo:1.0.0 ghcr.io/myorg/myrepo:1.0.0
+
+  # Retag within the default registry
+  remake copy myorg/myrepo:rc1 myorg/myrepo:stable`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Copy(context.Background(), args[0], args[1])
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,63 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// deleteCmd returns the Cobra command for removing a Makefile artifact from
+// an OCI registry. The manifest is deleted together with every tag pointing
+// to it, and the matching entry is dropped from the local cache.
+func deleteCmd(app *app.App) *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "delete <reference>",
+		Short: "Delete a Makefile artifact from an OCI registry",
+		Long: `Delete the Makefile artifact identified by <reference> from its registry
+using the manifest-delete API. The reference may be a tag or a digest; when a
+tag is given it is first resolved to its digest, so every tag pointing to the
+same artifact disappears as well.
+
+The matching reference is also removed from the local cache so that nobody
+keeps running the deleted version. You are asked for confirmation unless
+--yes is specified.`,
+		Example: `  # Delete a bad release after confirming interactively
+  remake delete ghcr.io/myorg/myrepo:1.0.1
+
+  # Delete without prompting (e.g., from CI)
+  remake delete ghcr.io/myorg/myrepo@sha256:<digest> --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Delete(context.Background(), args[0], yes)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false,
+		"Do not prompt for confirmation")
+	return cmd
+}
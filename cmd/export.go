@@ -0,0 +1,60 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd returns the Cobra command for saving a Makefile artifact from an
+// OCI registry into an on-disk OCI image layout, for air-gapped transfer or
+// hermetic tests.
+func exportCmd(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <reference> <path>",
+		Short: "Save a Makefile artifact to an OCI layout directory or tarball",
+		Long: `Copy the Makefile artifact at <reference> into the OCI image layout at <path>,
+tagged with the same tag (or digest) as <reference>. The layout directory is
+created if needed and may hold many artifacts; when <path> ends in ".tar" a
+tarball of a fresh layout is written instead.
+
+Artifacts in a layout can be used directly with oci-layout://<path>:<tag>
+references, or loaded into another registry with 'remake import'.`,
+		Example: `  # Export to a layout directory
+  remake export ghcr.io/myorg/myrepo:1.0.0 ./layout
+
+  # Export to a tarball for transfer
+  remake export ghcr.io/myorg/myrepo:1.0.0 myrepo.tar
+
+  # Run straight from the layout
+  remake run -f oci-layout://./layout:1.0.0 build`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Export(context.Background(), args[0], args[1])
+		},
+	}
+	return cmd
+}
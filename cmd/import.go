@@ -0,0 +1,52 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// importCmd returns the Cobra command for loading a Makefile artifact from an
+// on-disk OCI image layout into an OCI registry.
+func importCmd(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <path> <reference>",
+		Short: "Load a Makefile artifact from an OCI layout directory or tarball",
+		Long: `Copy the Makefile artifact from the OCI image layout directory or tarball at
+<path> to <reference>. The artifact is looked up in the layout by the tag (or
+digest) of <reference>, matching what 'remake export' writes.`,
+		Example: `  # Import into an internal registry after an air-gapped transfer
+  remake import myrepo.tar registry.internal/myorg/myrepo:1.0.0
+
+  # Import from a layout directory
+  remake import ./layout registry.internal/myorg/myrepo:1.0.0`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Import(context.Background(), args[0], args[1])
+		},
+	}
+	return cmd
+}
@@ -30,25 +30,32 @@ import (
 )
 
 // loginCmd returns the Cobra command for authenticating the CLI
-// against an OCI registry. It supports interactive prompt fallback
-// when credentials are not provided via flags or config.
+// against an OCI registry or HTTP(S) endpoint. It supports interactive
+// prompt fallback when credentials are not provided via flags or config.
 func loginCmd(app *app.App) *cobra.Command {
 	var (
 		usernameFlag string
 		passwordFlag string
+		tokenFlag    string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "login [registry]",
-		Short: "Authenticate with an OCI registry (e.g., ghcr.io)",
-		Long: `Authenticate the Remake CLI with the specified OCI registry.
+		Short: "Authenticate with an OCI registry (e.g., ghcr.io) or HTTP(S) host",
+		Long: `Authenticate the Remake CLI with the specified OCI registry or HTTP(S) host.
 If no registry is provided, the default registry from configuration is used.
 Credentials can be supplied via flags, config file, or interactively prompted.
 
+For http:// and https:// endpoints the credentials are stored per host and
+sent on every pull and push to that host: a username and password with basic
+auth, or a --token as a bearer token. Hosts without stored credentials fall
+back to entries in ~/.netrc.
+
 Examples of registries:
   - GitHub Container Registry: ghcr.io (default)
   - Docker Hub: docker.io
-  - Private registry: registry.example.com`,
+  - Private registry: registry.example.com
+  - Raw files host: https://raw.githubusercontent.com`,
 		Example: `  # Login using flags
   remake login ghcr.io -u myuser -p mypass
 
@@ -56,18 +63,26 @@ Examples of registries:
   remake login ghcr.io -u myuser
 
   # Login to default registry (from config)
-  remake login`,
-		Args: cobra.MaximumNArgs(1),
+  remake login
+
+  # Store a bearer token for private raw GitHub URLs
+  remake login https://raw.githubusercontent.com --token "$GITHUB_TOKEN"`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeRegistries(app),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			registry := app.Cfg.DefaultRegistry
 			if len(args) == 1 {
 				registry = args[0]
 			}
+			if tokenFlag != "" {
+				return app.LoginToken(context.Background(), registry, tokenFlag)
+			}
 			return app.Login(context.Background(), registry, usernameFlag, passwordFlag)
 		},
 	}
 
 	cmd.Flags().StringVarP(&usernameFlag, "username", "u", "", "Username for the OCI registry")
 	cmd.Flags().StringVarP(&passwordFlag, "password", "p", "", "Password or token for the OCI registry")
+	cmd.Flags().StringVar(&tokenFlag, "token", "", "Bearer token for an HTTP(S) host")
 	return cmd
 }
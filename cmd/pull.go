@@ -33,7 +33,7 @@ import (
 // from an OCI registry. It downloads the artifact into the local cache
 // (unless bypassed) and prints its contents to stdout.
 func pullCmd(app *app.App) *cobra.Command {
-	var noCache bool
+	var noCache, quiet bool
 
 	cmd := &cobra.Command{
 		Use:   "pull <reference>",
@@ -41,10 +41,14 @@ func pullCmd(app *app.App) *cobra.Command {
 		Long: `Download the specified Makefile artifact from an OCI registry and print its
 contents to stdout. By default, the artifact is stored in a local cache directory
 (e.g., ~/.remake/cache) and subsequent pulls use the cache unless the --no-cache
-flag is specified.
+flag is specified. HTTP(S) artifacts fetched again are only downloaded when
+their ETag or Last-Modified shows that they changed.
 
 If the <reference> does not include a registry host (e.g., myorg/myrepo:tag),
-the default registry from configuration is used.`,
+the default registry from configuration is used.
+
+Download progress is shown on stderr: a progress bar on terminals and plain
+lines otherwise (e.g., in CI logs). Use --quiet to suppress it.`,
 		Example: `  # Pull latest Makefile from GitHub Container Registry
   remake pull ghcr.io/myorg/myrepo:latest
 
@@ -52,16 +56,22 @@ the default registry from configuration is used.`,
   remake pull myorg/myrepo:latest
 
   # Force re-download and bypass cache
-  remake pull ghcr.io/myorg/myrepo:latest --no-cache`,
+  remake pull ghcr.io/myorg/myrepo:latest --no-cache
+
+  # Save a Makefile without progress output
+  remake pull ghcr.io/myorg/myrepo:latest -q > Makefile`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ref := args[0]
 			app.Cfg.NoCache = noCache
+			app.Cfg.Quiet = app.Cfg.Quiet || quiet
 			return app.Pull(context.Background(), ref)
 		},
 	}
 
 	cmd.Flags().BoolVar(&noCache, "no-cache", false,
 		"Bypass the local cache and always fetch from the registry")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false,
+		"Do not report download progress")
 	return cmd
 }
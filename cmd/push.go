@@ -29,20 +29,40 @@ import (
 )
 
 // pushCmd returns the Cobra command for uploading a local Makefile artifact
-// to an OCI registry. The Makefile is read from the specified file and
-// pushed under the provided reference (e.g., registry/repo:tag).
+// to an OCI registry or an HTTP(S) endpoint. The Makefile is read from the
+// specified file and pushed under the provided reference (e.g.,
+// registry/repo:tag).
 func pushCmd(app *app.App) *cobra.Command {
-	var file string
+	var (
+		file       string
+		quiet      bool
+		digestFile string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "push <reference>",
-		Short: "Upload a Makefile artifact to an OCI registry",
+		Short: "Upload a Makefile artifact to an OCI registry or HTTP(S) endpoint",
 		Long: `Push a local Makefile artifact to the given OCI reference.
 By default, the command reads from a file named 'makefile' in the current
 directory. Use the -f flag to specify a different filename or path.
 
 The <reference> syntax is registry host followed by repository and tag,
-for example: ghcr.io/myorg/myrepo:1.0.0`,
+for example: ghcr.io/myorg/myrepo:1.0.0
+
+An http:// or https:// URL uploads the file with an HTTP PUT instead, which
+works with generic artifact repositories (Artifactory, Nexus), WebDAV servers
+and presigned object storage URLs. Credentials stored with 'remake login' for
+the URL host are sent as basic auth, or as a bearer token when a 'token' is
+configured for the host.
+
+Upload progress is shown on stderr: a progress bar on terminals and plain
+lines otherwise (e.g., in CI logs). Use --quiet to suppress it.
+
+On success the reference pinned to the pushed digest is printed, e.g.
+ghcr.io/myorg/myrepo:1.0.0@sha256:..., or for HTTP(S) URLs
+https://host/path#sha256:... . The digest is that of the artifact manifest,
+or of the file itself for HTTP(S). Use --digest-file to also write the
+digest to a file, e.g. to pin the artifact in later CI steps.`,
 		Example: `  # Push default makefile to GitHub Container Registry
   remake push ghcr.io/myorg/myrepo:latest
 
@@ -50,15 +70,27 @@ for example: ghcr.io/myorg/myrepo:1.0.0`,
   remake push ghcr.io/myorg/myrepo:dev -f Makefile.dev
 
   # Push to default registry with custom file
-  remake push myorg/myrepo:v2 -f ./ci/Makefile.ci`,
+  remake push myorg/myrepo:v2 -f ./ci/Makefile.ci
+
+  # Upload to a generic HTTP repository
+  remake push https://artifacts.example.com/generic/make/ci.mk -f Makefile.ci
+
+  # Record the pushed digest for later CI steps
+  remake push ghcr.io/myorg/myrepo:${GITHUB_SHA} --digest-file digest.txt
+  remake run -f "ghcr.io/myorg/myrepo@$(cat digest.txt)" deploy`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ref := args[0]
-			return app.Push(context.Background(), ref, file)
+			app.Cfg.Quiet = app.Cfg.Quiet || quiet
+			return app.Push(context.Background(), ref, file, digestFile)
 		},
 	}
 
 	cmd.Flags().StringVarP(&file, "file", "f", "makefile",
 		"Path to the local Makefile to upload (default 'makefile')")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false,
+		"Do not report upload progress")
+	cmd.Flags().StringVar(&digestFile, "digest-file", "",
+		"Write the digest of the pushed artifact to this file")
 	return cmd
 }
@@ -22,7 +22,10 @@
 package cmd
 
 import (
+	"io"
 	"log"
+	"log/slog"
+	"os"
 
 	"github.com/TrianaLab/remake/app"
 	"github.com/TrianaLab/remake/config"
@@ -33,6 +36,14 @@ import (
 var initConfigFunc = config.InitConfig
 var fatalFunc = log.Fatal
 
+// global logging flags, bound in init so that repeated calls to Execute do
+// not redefine them
+var (
+	verbose bool
+	debug   bool
+	output  string
+)
+
 // rootCmd is the base command for the Remake CLI. It initializes configuration,
 // creates the application instance, and registers all subcommands.
 var rootCmd = &cobra.Command{
@@ -43,12 +54,30 @@ as OCI artifacts. It supports pushing local Makefiles to container registries,
 pulling cached artifacts, and executing targets locally or remotely.
 
 Available commands:
-  login    Authenticate to an OCI registry
-  push     Upload a Makefile artifact
-  pull     Download and display a Makefile artifact
-  run      Execute Makefile targets
-  version  Show the CLI version
-  config   Display current CLI configuration`,
+  login        Authenticate to an OCI registry
+  push         Upload a Makefile artifact
+  pull         Download and display a Makefile artifact
+  copy         Copy an artifact between registries
+  delete       Delete an artifact from a registry
+  untag        Remove a tag from a registry
+  export       Save an artifact to an OCI layout directory or tarball
+  import       Load an artifact from an OCI layout directory or tarball
+  targets      List the targets and variables of a Makefile
+  run          Execute Makefile targets
+  serve-cache  Serve the local cache to other machines over HTTP
+  version      Show the CLI version
+  config       Display current CLI configuration
+
+Logging:
+  -v/--verbose logs cache hits and misses, resolved references and the make
+  command line to stderr; --debug additionally traces every registry and HTTP
+  request and response. Authorization headers, cookies and token-like values
+  are redacted from the output.
+
+Output:
+  -o json prints a single JSON document on stdout for login, push, pull,
+  targets, run, version, config, copy, delete, untag, export and import, for
+  use in scripts. The output of make itself goes to stderr in this mode.`,
 	Example: `  # Display help for all commands
   remake --help
 
@@ -57,7 +86,29 @@ Available commands:
 
   # Push a Makefile artifact and then run a target
   remake push ghcr.io/myorg/myrepo:latest
-  remake run ghcr.io/myorg/myrepo:latest build`,
+  remake run ghcr.io/myorg/myrepo:latest build
+
+  # Show where a Makefile comes from and the requests made to fetch it
+  remake run --debug ghcr.io/myorg/myrepo:latest build`,
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log cache decisions, resolved references and commands to stderr")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Like --verbose, and also trace registry and HTTP requests")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "", "Output format: text or json (default from config, else text)")
+}
+
+// newLogger returns a logger writing text records to w at the level selected
+// by the --verbose and --debug flags, or nil when neither is set.
+func newLogger(w io.Writer) *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case debug:
+		level = slog.LevelDebug
+	case !verbose:
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
 }
 
 // Execute initializes configuration and executes the root command.
@@ -70,12 +121,32 @@ func Execute() error {
 	}
 
 	a := app.New(cfg)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if cfg == nil {
+			return nil
+		}
+		cfg.Logger = newLogger(os.Stderr)
+		if output != "" {
+			if err := config.ValidateOutput(output); err != nil {
+				return err
+			}
+			cfg.Output = output
+		}
+		return nil
+	}
 
 	rootCmd.AddCommand(
 		loginCmd(a),
 		pushCmd(a),
 		pullCmd(a),
+		copyCmd(a),
+		deleteCmd(a),
+		untagCmd(a),
+		exportCmd(a),
+		importCmd(a),
 		runCmd(a),
+		targetsCmd(a),
+		serveCacheCmd(a),
 		versionCmd(a),
 		configCmd(a),
 	)
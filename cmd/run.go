@@ -23,8 +23,10 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/TrianaLab/remake/app"
+	"github.com/TrianaLab/remake/internal/run"
 	"github.com/spf13/cobra"
 )
 
@@ -34,9 +36,17 @@ import (
 // unless --no-cache is specified. Additional flags can be passed to make via --make-flag.
 func runCmd(app *app.App) *cobra.Command {
 	var (
-		noCache   bool
-		file      string
-		makeFlags []string
+		noCache     bool
+		file        string
+		workdir     string
+		makeBin     string
+		makeFlags   []string
+		sets        []string
+		envFiles    []string
+		interactive bool
+		dryRun      bool
+		sandbox     bool
+		image       string
 	)
 
 	cmd := &cobra.Command{
@@ -45,10 +55,77 @@ func runCmd(app *app.App) *cobra.Command {
 		Long: `Execute specified targets from a Makefile. By default, the CLI looks for a
 local file named 'makefile' in the current directory. To run a Makefile stored
 as an OCI artifact, use the -f flag with a reference (e.g., ghcr.io/myorg/myrepo:latest).
+Makefiles in git repositories are referenced as git+<url>//<path>@<ref>.
 
 The command uses a local cache directory (e.g., ~/.remake/cache) to avoid repeated
 downloads; use --no-cache to force re-download. Any flags provided via
---make-flag are forwarded directly to the make process.`,
+--make-flag are forwarded directly to the make process.
+
+make runs in the current directory, or in the one given with -C/--workdir.
+Remote Makefiles are run under a name derived from their reference (e.g.,
+make-redis.mk for ghcr.io/trianalab/make-redis) so that $(MAKEFILE_LIST)
+reads naturally, and make receives these environment variables:
+  REMAKE_REF        the reference the Makefile was resolved from
+  REMAKE_DIGEST     the digest of the Makefile content
+  REMAKE_CACHE_DIR  the Remake cache directory
+
+The make binary is 'make' from PATH unless set with --make or 'makeBinary'
+in the config file (e.g., gmake on BSD and macOS, or a wrapper script). A
+Makefile can declare the GNU make version it needs with a comment such as
+  # remake: requires make >= 4.3
+which is also recorded as an annotation when it is pushed; the run fails
+with a clear error if the make binary is not GNU make of that version.
+
+Variables are passed to make on its command line, overriding assignments in
+the Makefile, with --set KEY=VALUE or from .env files with --env-file. Values
+from env files are treated as secrets and masked in logged command lines.
+Variables can also be configured per reference in the config file, for a
+repository or a single tag:
+  vars:
+    ghcr.io/myorg/make-redis:
+      - REDIS_PORT=6380
+When a variable is set more than once, --set wins over --env-file, which wins
+over the config file.
+
+With --interactive and no targets, the targets of the Makefile and their '##'
+descriptions are listed on the terminal to pick from, and the value of each
+'?=' variable not already set is asked for, its default kept when the answer
+is empty. When stdin is not a terminal, the default goal is run as usual.
+
+With --dry-run, nothing is built: the command prints how the reference was
+resolved (registry, tag, digest, cache hit or miss) and the exact make command
+line, then runs 'make -n' to show the recipes make would run. As make still
+runs recipe lines prefixed with '+' or using $(MAKE), and $(shell) calls made
+while reading the Makefile, dry runs of remote references always run in the
+sandbox described below, and sandboxed dry runs have no network and a
+read-only workdir. Where the sandbox is unavailable, dry runs of remote
+references skip 'make -n' with a warning rather than run it on the host; use
+--image to see their recipes from a container instead.
+
+With --sandbox (Linux only), make runs in new namespaces with bubblewrap
+(bwrap) when installed: the root file system is read-only, /tmp and the home
+directory are private and empty, as are remake's own configuration and cache
+directories, only the workdir is writable, the network is cut off, and only
+the PATH, HOME, USER, LOGNAME, LANG, LC_ALL and TERM environment variables
+are kept besides REMAKE_*. Without bwrap, sandboxed runs fail unless
+'writableRoot' allows creating the namespaces directly, which cannot make
+the file system read-only. Settings are configured per reference pattern,
+and 'always' sandboxes matching references even without --sandbox:
+  sandbox:
+    ghcr.io/untrusted/*:
+      always: true
+      network: true
+      env: [GOPATH, GOCACHE]
+
+With --image, make runs in a container of that image with podman, or docker
+when podman is not installed ('containerRuntime' in the config file picks
+one). The Makefile and the workdir are mounted at the same paths, so the
+image only needs make and the tools the Makefile uses. A Makefile can
+declare its image with a comment, which 'remake push' records in the
+artifact's annotations:
+  # remake: image golang:1.24
+Combined with --sandbox, the container has no network unless allowed and a
+read-only root file system, on any OS.`,
 		Example: `  # Run default targets 'all' and 'test' from local Makefile
   remake run all test
 
@@ -56,10 +133,44 @@ downloads; use --no-cache to force re-download. Any flags provided via
   remake run --make-flag -j4 --make-flag --silent build
 
   # Execute target from remote Makefile artifact, bypassing cache
-  remake run -f ghcr.io/myorg/myrepo:latest --no-cache deploy`,
+  remake run -f ghcr.io/myorg/myrepo:latest --no-cache deploy
+
+  # Execute target from a Makefile in a git repository at a tag
+  remake run -f git+https://github.com/myorg/make.git//ci/go.mk@v1.2.0 test
+
+  # Build a project in another directory with a shared Makefile
+  remake run -f ghcr.io/myorg/make-go:v1 -C ./services/api build
+
+  # Override Makefile variables, reading secrets from an env file
+  remake run -f ghcr.io/myorg/make-redis:v1 --set REDIS_PORT=6380 --env-file .env up
+
+  # Show what a shared Makefile would do without running it
+  remake run -f ghcr.io/myorg/make-redis:v1 --dry-run up
+
+  # Run an untrusted Makefile in a sandbox
+  remake run -f ghcr.io/someone/make-tools:v1 --sandbox lint
+
+  # Build with the Go toolchain of an image instead of the host's
+  remake run -f ghcr.io/myorg/make-go:v1 --image golang:1.24 build
+
+  # Pick targets and fill in variables on the terminal
+  remake run -f ghcr.io/myorg/make-redis:v1 -i
+
+  # Use GNU make installed as gmake (BSD, macOS with Homebrew)
+  remake run --make gmake build`,
+		ValidArgsFunction: completeTargets(app, &file, &workdir),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			app.Cfg.NoCache = noCache
-			return app.Run(context.Background(), file, makeFlags, args)
+			if makeBin != "" {
+				app.Cfg.MakeBinary = makeBin
+			}
+			opts, err := runOptions(workdir, makeFlags, args, envFiles, sets)
+			if err != nil {
+				return err
+			}
+			opts.Interactive, opts.DryRun, opts.Sandbox = interactive, dryRun, sandbox
+			opts.Image = image
+			return app.Run(context.Background(), file, opts)
 		},
 	}
 
@@ -67,7 +178,48 @@ downloads; use --no-cache to force re-download. Any flags provided via
 		"Bypass the local cache and always fetch Makefile artifact")
 	cmd.Flags().StringVarP(&file, "file", "f", "makefile",
 		"Makefile path or OCI reference to use (default 'makefile')")
+	cmd.Flags().StringVarP(&workdir, "workdir", "C", "",
+		"Directory to run make in (default: the current directory)")
+	cmd.Flags().StringVar(&makeBin, "make", "",
+		"make binary to run (default from config, else 'make')")
 	cmd.Flags().StringArrayVar(&makeFlags, "make-flag", nil,
 		"Flags to pass through to the make process")
+	cmd.Flags().StringArrayVar(&sets, "set", nil,
+		"Set a make variable as KEY=VALUE (can be repeated)")
+	cmd.Flags().StringArrayVar(&envFiles, "env-file", nil,
+		"Read secret make variables from a .env file (can be repeated)")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false,
+		"Pick targets and variables on the terminal when no targets are given")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show the resolved reference, make command and recipes without running them")
+	cmd.Flags().BoolVar(&sandbox, "sandbox", false,
+		"Run make in a Linux sandbox where only the workdir is writable")
+	cmd.Flags().StringVar(&image, "image", "",
+		"Run make in a container of this image with podman or docker")
+	_ = cmd.RegisterFlagCompletionFunc("file", completeReferences(app))
+	_ = cmd.RegisterFlagCompletionFunc("workdir", cobra.FixedCompletions(nil, cobra.ShellCompDirectiveFilterDirs))
 	return cmd
 }
+
+// runOptions builds the app.RunOptions for the run command's flags and
+// arguments, reading the env files before the --set variables so that the
+// latter take precedence. It lives outside runCmd, where the app parameter
+// shadows the package.
+func runOptions(workdir string, makeFlags, targets, envFiles, sets []string) (app.RunOptions, error) {
+	var vars []run.Var
+	for _, path := range envFiles {
+		fileVars, err := run.ReadEnvFile(path)
+		if err != nil {
+			return app.RunOptions{}, fmt.Errorf("failed to read env file: %w", err)
+		}
+		vars = append(vars, fileVars...)
+	}
+	for _, set := range sets {
+		v, err := run.ParseVar(set)
+		if err != nil {
+			return app.RunOptions{}, err
+		}
+		vars = append(vars, v)
+	}
+	return app.RunOptions{Workdir: workdir, MakeFlags: makeFlags, Vars: vars, Targets: targets}, nil
+}
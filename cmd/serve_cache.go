@@ -0,0 +1,83 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// serveCacheCmd returns the Cobra command for sharing the local cache with
+// other machines over HTTP.
+func serveCacheCmd(app *app.App) *cobra.Command {
+	var (
+		addr  string
+		hosts []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve-cache",
+		Short: "Serve the local cache to other machines over HTTP",
+		Long: `Expose the local cache over HTTP so that a whole office or CI fleet shares
+one warm cache. Artifacts missing from the cache are fetched from their
+upstream registry without this machine's credentials and cached on the way.
+
+Clients use the server by setting 'cacheServer' in their configuration:
+
+  cacheServer: http://cache.internal:8080
+
+On a local cache miss they ask the server before the upstream registry, and
+fall back to the registry if the server is unreachable. OCI artifacts are
+served through a read-only registry API, with their manifests unchanged so
+they keep their digest. Registries, and the hosts of http(s) and git
+references, must be allowed with --allow-host or 'serveCacheHosts'. Local
+files are never served.
+
+The server listens on the loopback interface by default; pass --addr to
+expose it to other machines.`,
+		Example: `  # Serve the cache to other machines on port 8080
+  remake serve-cache --addr :8080 --allow-host ghcr.io
+
+  # Also serve Makefiles from an artifact repository and a git server
+  remake serve-cache --addr :8080 --allow-host ghcr.io \
+    --allow-host artifacts.internal --allow-host github.com`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app.Cfg.ServeCacheHosts = append(app.Cfg.ServeCacheHosts, hosts...)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return app.ServeCache(ctx, addr)
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:8080",
+		"Address to listen on")
+	cmd.Flags().StringArrayVar(&hosts, "allow-host", nil,
+		"Serve OCI, HTTP(S) and git references on this host (can be repeated)")
+	return cmd
+}
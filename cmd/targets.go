@@ -0,0 +1,73 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"context"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// targetsCmd returns the Cobra command for listing the targets and
+// overridable variables of a local or remote Makefile.
+func targetsCmd(app *app.App) *cobra.Command {
+	var (
+		noCache bool
+		file    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "targets",
+		Short: "List the targets and variables of a Makefile",
+		Long: `List the targets of a Makefile, and the variables it assigns with '?=',
+which can be overridden with 'remake run --set'. The Makefile is resolved like
+in 'remake run': a local file, an HTTP(S) URL, an OCI reference or a git
+reference, pulled through the local cache unless --no-cache is given.
+
+Descriptions are read from '##' comments, at the end of the rule or
+assignment line or on the lines just before it:
+  ## Start Redis
+  up: ## or here
+  REDIS_PORT ?= 6379 ## Port Redis listens on
+
+Targets listed as prerequisites of .PHONY are marked as phony. Special
+targets and pattern rules are not listed.`,
+		Example: `  # Inspect a catalog Makefile before running it
+  remake targets -f trianalab/make-redis
+
+  # List the targets of the local Makefile
+  remake targets`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app.Cfg.NoCache = noCache
+			return app.Targets(context.Background(), file)
+		},
+	}
+
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"Bypass the local cache and always fetch Makefile artifact")
+	cmd.Flags().StringVarP(&file, "file", "f", "makefile",
+		"Makefile path or OCI reference to inspect (default 'makefile')")
+	_ = cmd.RegisterFlagCompletionFunc("file", completeReferences(app))
+	return cmd
+}
@@ -0,0 +1,61 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/TrianaLab/remake/app"
+	"github.com/spf13/cobra"
+)
+
+// untagCmd returns the Cobra command for removing a single tag from an OCI
+// registry while keeping the artifact it points to. The matching entry is
+// dropped from the local cache.
+func untagCmd(app *app.App) *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "untag <reference>",
+		Short: "Remove a tag from an OCI registry",
+		Long: `Remove the tag in <reference> from its registry. The artifact itself and any
+other tags pointing to it are left untouched. Not every registry accepts
+deleting manifests by tag; in that case use 'remake delete' instead.
+
+The matching reference is also removed from the local cache. You are asked
+for confirmation unless --yes is specified.`,
+		Example: `  # Remove a mistaken tag
+  remake untag ghcr.io/myorg/myrepo:latest
+
+  # Remove without prompting
+  remake untag ghcr.io/myorg/myrepo:rc1 --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Untag(context.Background(), args[0], yes)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false,
+		"Do not prompt for confirmation")
+	return cmd
+}
@@ -22,8 +22,6 @@
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/TrianaLab/remake/app"
 	"github.com/spf13/cobra"
 )
@@ -41,11 +39,13 @@ This is useful for verifying the installed version and checking for updates.
   remake version
 
   # Use version in scripts or logs
-  if [ "$(remake version)" != "v1.2.3" ]; then echo "Update available"; fi`,
+  if [ "$(remake version)" != "v1.2.3" ]; then echo "Update available"; fi
+
+  # Print version, commit, Go version and platform as JSON
+  remake version -o json`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Printf("Remake version: %s\n", app.Cfg.Version)
-			return nil
+			return app.Version()
 		},
 	}
 	return cmd
@@ -24,15 +24,21 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
 // ReferenceType enumerates the types of Makefile references.
-// It can be an HTTP URL, a local filesystem path, or an OCI artifact reference.
+// It can be an HTTP URL, a local filesystem path, an OCI artifact reference,
+// or a file inside a git repository.
 type ReferenceType int
 
 const (
@@ -44,8 +50,84 @@ const (
 
 	// ReferenceOCI indicates the reference is an OCI registry artifact.
 	ReferenceOCI
+
+	// ReferenceGit indicates the reference is a file in a git repository,
+	// written as git+<url>//<path>@<ref>.
+	ReferenceGit
+
+	// ReferenceOCILayout indicates the reference is an artifact in an on-disk
+	// OCI image layout, written as oci-layout://<path>[:<tag>|@<digest>].
+	ReferenceOCILayout
 )
 
+// Cache ref modes select how the HTTP and git caches record which blob a
+// reference points to.
+const (
+	// CacheRefsSymlink stores refs as symbolic links to blobs.
+	CacheRefsSymlink = "symlink"
+
+	// CacheRefsFile stores refs as small pointer files holding the blob digest.
+	// It works where symlinks are unavailable, such as Windows without
+	// developer mode.
+	CacheRefsFile = "file"
+)
+
+const (
+	// OutputText prints human-readable command output.
+	OutputText = "text"
+
+	// OutputJSON prints a single JSON document per command on stdout, for
+	// scripts.
+	OutputJSON = "json"
+)
+
+// DefaultMakeBinary is the make executable used when none is configured.
+const DefaultMakeBinary = "make"
+
+// LayoutScheme is the prefix of references to on-disk OCI image layouts.
+const LayoutScheme = "oci-layout://"
+
+// LayoutReference is a parsed oci-layout://<path>[:<tag>|@<digest>] reference.
+type LayoutReference struct {
+	// Path is the layout directory, or a tarball when it ends in ".tar".
+	Path string
+
+	// Reference is the tag or digest inside the layout ("latest" if omitted).
+	Reference string
+}
+
+// GitReference is a parsed git+<url>//<path>@<ref> reference.
+type GitReference struct {
+	// Repository is the URL passed to git, without the git+ prefix.
+	Repository string
+
+	// Path is the file path inside the repository.
+	Path string
+
+	// Ref is the branch, tag or commit to read the file from ("HEAD" if omitted).
+	Ref string
+}
+
+// Sandbox configures sandboxed runs of the references matching a pattern
+// in the 'sandbox' section of the config file.
+type Sandbox struct {
+	// Always sandboxes runs of matching references, even without --sandbox.
+	Always bool `mapstructure:"always"`
+
+	// Network keeps network access inside the sandbox, which has none by
+	// default.
+	Network bool `mapstructure:"network"`
+
+	// Env lists environment variables passed into the sandbox on top of
+	// the default allowlist (PATH, HOME, USER, LOGNAME, LANG, LC_ALL, TERM).
+	Env []string `mapstructure:"env"`
+
+	// WritableRoot allows sandboxed runs without bubblewrap, in namespaces
+	// that isolate the network, processes and environment but leave the
+	// root file system writable. Without it, such runs fail.
+	WritableRoot bool `mapstructure:"writableRoot"`
+}
+
 // Config holds all settings for the Remake CLI, including directories,
 // default values, and runtime flags.
 type Config struct {
@@ -67,15 +149,107 @@ type Config struct {
 	// Version is the semantic version string of the CLI.
 	Version string
 
+	// Commit is the VCS revision the CLI was built from, if known.
+	Commit string
+
+	// Output is the command output format: OutputText or OutputJSON. An
+	// empty value means OutputText.
+	Output string
+
 	// NoCache disables cache usage when set to true.
 	NoCache bool
+
+	// Quiet suppresses progress output for pushes and pulls.
+	Quiet bool
+
+	// CacheRefs is how cache refs are stored: CacheRefsSymlink or
+	// CacheRefsFile. An empty value means CacheRefsSymlink.
+	CacheRefs string
+
+	// CacheServer is the URL of a shared cache server (see 'remake
+	// serve-cache') consulted before the upstream registry on cache misses.
+	CacheServer string
+
+	// ServeCacheHosts are the registries and the hosts of HTTP(S) and git
+	// references that 'remake serve-cache' fetches for its clients. Other
+	// references are refused.
+	ServeCacheHosts []string
+
+	// MaxArtifactSize is the largest artifact, in bytes, that will be
+	// downloaded into the cache. Zero means no limit.
+	MaxArtifactSize int64
+
+	// MakeBinary is the make executable run by 'remake run', looked up in
+	// PATH unless it is a path.
+	MakeBinary string
+
+	// ContainerRuntime is the container CLI that runs make in an image,
+	// such as podman or docker. Empty means the first of podman and docker
+	// found in PATH.
+	ContainerRuntime string
+
+	// Sandboxes maps reference patterns to the settings of sandboxed runs
+	// (see SandboxFor). Keys are lower case.
+	Sandboxes map[string]Sandbox
+
+	// Vars maps references to make variables, as KEY=VALUE strings, passed
+	// to make when running them (see ReferenceVars). Keys are lower case.
+	Vars map[string][]string
+
+	// Logger receives diagnostic logs: cache hits and misses, resolved
+	// references and commands run at info level, and registry HTTP traffic
+	// at debug level. Nil disables logging; use Log to access it.
+	Logger *slog.Logger
+}
+
+// discardLogger is returned by Log when no Logger is configured.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Log returns the configured Logger, or a logger that discards everything
+// when none is set.
+func (c *Config) Log() *slog.Logger {
+	if c == nil || c.Logger == nil {
+		return discardLogger
+	}
+	return c.Logger
 }
 
 // userHomeDir allows us to override os.UserHomeDir in tests.
 var userHomeDir = os.UserHomeDir
 
-// buildVersion is populated via -ldflags at build time.
-var buildVersion = "dev"
+// DefaultMaxArtifactSize is the default value of Config.MaxArtifactSize.
+const DefaultMaxArtifactSize = 100 << 20
+
+// defaultCacheRefs is the cache ref mode used when none is configured.
+// Symlinks need special privileges on Windows, so pointer files are used there.
+var defaultCacheRefs = func() string {
+	if runtime.GOOS == "windows" {
+		return CacheRefsFile
+	}
+	return CacheRefsSymlink
+}()
+
+// buildVersion and buildCommit are populated via -ldflags at build time.
+var (
+	buildVersion = "dev"
+	buildCommit  = ""
+)
+
+// vcsRevision returns buildCommit, or the VCS revision recorded by the Go
+// toolchain when it was not set at build time.
+func vcsRevision() string {
+	if buildCommit != "" {
+		return buildCommit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return ""
+}
 
 // InitConfig initializes directory structure and loads configuration from
 // ~/.remake/config.yaml, applying defaults for all settings.
@@ -100,6 +274,11 @@ func InitConfig() (*Config, error) {
 	viper.SetDefault("defaultMakefile", "makefile")
 	viper.SetDefault("defaultRegistry", "ghcr.io")
 	viper.SetDefault("noCache", false)
+	viper.SetDefault("cacheRefs", defaultCacheRefs)
+	viper.SetDefault("cacheServer", "")
+	viper.SetDefault("maxArtifactSize", DefaultMaxArtifactSize)
+	viper.SetDefault("output", OutputText)
+	viper.SetDefault("makeBinary", DefaultMakeBinary)
 
 	// Create default config file if it does not exist
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
@@ -116,30 +295,188 @@ func InitConfig() (*Config, error) {
 
 	// Populate Config struct from viper
 	cfg := &Config{
-		BaseDir:         viper.GetString("baseDir"),
-		ConfigFile:      viper.GetString("configFile"),
-		CacheDir:        viper.GetString("cacheDir"),
-		DefaultMakefile: viper.GetString("defaultMakefile"),
-		DefaultRegistry: viper.GetString("defaultRegistry"),
-		Version:         buildVersion,
-		NoCache:         viper.GetBool("noCache"),
+		BaseDir:          viper.GetString("baseDir"),
+		ConfigFile:       viper.GetString("configFile"),
+		CacheDir:         viper.GetString("cacheDir"),
+		DefaultMakefile:  viper.GetString("defaultMakefile"),
+		DefaultRegistry:  viper.GetString("defaultRegistry"),
+		Version:          buildVersion,
+		Commit:           vcsRevision(),
+		Output:           viper.GetString("output"),
+		NoCache:          viper.GetBool("noCache"),
+		Quiet:            viper.GetBool("quiet"),
+		CacheRefs:        viper.GetString("cacheRefs"),
+		CacheServer:      viper.GetString("cacheServer"),
+		ServeCacheHosts:  viper.GetStringSlice("serveCacheHosts"),
+		MaxArtifactSize:  viper.GetInt64("maxArtifactSize"),
+		MakeBinary:       viper.GetString("makeBinary"),
+		ContainerRuntime: viper.GetString("containerRuntime"),
+		Vars:             viper.GetStringMapStringSlice("vars"),
+	}
+	if cfg.CacheRefs != CacheRefsSymlink && cfg.CacheRefs != CacheRefsFile {
+		return nil, fmt.Errorf("invalid cacheRefs %q: must be %q or %q", cfg.CacheRefs, CacheRefsSymlink, CacheRefsFile)
+	}
+	if err := ValidateOutput(cfg.Output); err != nil {
+		return nil, err
+	}
+	if err := viper.UnmarshalKey("sandbox", &cfg.Sandboxes); err != nil {
+		return nil, fmt.Errorf("invalid sandbox settings: %w", err)
 	}
 	return cfg, nil
 }
 
 // ParseReference determines the ReferenceType for a given string.
-// It returns ReferenceHTTP for URLs, ReferenceLocal for existing files,
-// and ReferenceOCI otherwise.
+// It returns ReferenceGit for git+ URLs, ReferenceOCILayout for oci-layout://
+// paths, ReferenceHTTP for URLs, ReferenceOCI for oci:// references,
+// ReferenceLocal for existing files, and ReferenceOCI otherwise.
 func (c *Config) ParseReference(ref string) ReferenceType {
+	if strings.HasPrefix(ref, "git+") {
+		return ReferenceGit
+	}
+	if strings.HasPrefix(ref, LayoutScheme) {
+		return ReferenceOCILayout
+	}
 	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
 		return ReferenceHTTP
 	}
+	if strings.HasPrefix(ref, "oci://") {
+		return ReferenceOCI
+	}
 	if _, err := os.Stat(ref); err == nil {
 		return ReferenceLocal
 	}
 	return ReferenceOCI
 }
 
+// ReferenceVars returns the make variables configured for ref in the 'vars'
+// section, as KEY=VALUE strings. Variables set for the repository, i.e. ref
+// without its tag or digest, come first, followed by those set for ref
+// itself, so that the latter take precedence. Keys are matched case
+// insensitively, and ref should be fully qualified, as keys are.
+func (c *Config) ReferenceVars(ref string) []string {
+	if c == nil || len(c.Vars) == 0 {
+		return nil
+	}
+	ref = strings.ToLower(ref)
+	var vars []string
+	if repo := referenceRepository(ref); repo != ref {
+		vars = append(vars, c.Vars[repo]...)
+	}
+	return append(vars, c.Vars[ref]...)
+}
+
+// SandboxFor returns the sandbox settings for ref from the 'sandbox' section,
+// whose keys are patterns as understood by path.Match, such as
+// "ghcr.io/untrusted/*", matched case insensitively against ref and ref
+// without its tag or digest. ref should be fully qualified, as the patterns
+// are. When several patterns match, the longest one wins, ties going to the
+// first in lexical order. It reports false when no pattern matches.
+func (c *Config) SandboxFor(ref string) (Sandbox, bool) {
+	if c == nil {
+		return Sandbox{}, false
+	}
+	ref = strings.ToLower(ref)
+	repo := referenceRepository(ref)
+	best := ""
+	for pattern := range c.Sandboxes {
+		if best != "" && (len(pattern) < len(best) || len(pattern) == len(best) && pattern > best) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, ref); ok {
+			best = pattern
+		} else if ok, _ := path.Match(pattern, repo); ok {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return Sandbox{}, false
+	}
+	return c.Sandboxes[best], true
+}
+
+// referenceRepository strips the tag or digest from ref, if any.
+func referenceRepository(ref string) string {
+	if at := strings.LastIndex(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	return ref
+}
+
+// ParseGitReference splits a git+<url>//<path>@<ref> reference into its parts.
+// The '//' separating the repository from the file path is the first one after
+// the URL scheme, e.g. git+https://github.com/org/repo.git//make/redis.mk@v1.2.0.
+// As both paths name directories in the cache, '..' segments are rejected in
+// either, even when percent-encoded in the URL.
+func ParseGitReference(ref string) (GitReference, error) {
+	if !strings.HasPrefix(ref, "git+") {
+		return GitReference{}, fmt.Errorf("invalid git reference: %s", ref)
+	}
+	raw := strings.TrimPrefix(ref, "git+")
+	scheme := strings.Index(raw, "://")
+	if scheme < 0 {
+		return GitReference{}, fmt.Errorf("invalid git reference: %s", ref)
+	}
+	sep := strings.Index(raw[scheme+3:], "//")
+	if sep < 0 {
+		return GitReference{}, fmt.Errorf("git reference %s has no //<path> component", ref)
+	}
+	sep += scheme + 3
+	g := GitReference{Repository: raw[:sep], Path: raw[sep+2:], Ref: "HEAD"}
+	if at := strings.LastIndex(g.Path, "@"); at >= 0 {
+		g.Path, g.Ref = g.Path[:at], g.Path[at+1:]
+	}
+	if g.Path == "" || g.Ref == "" || strings.HasSuffix(g.Repository, "://") {
+		return GitReference{}, fmt.Errorf("invalid git reference: %s", ref)
+	}
+	u, err := url.Parse(g.Repository)
+	if err != nil {
+		return GitReference{}, fmt.Errorf("invalid git reference %s: %w", ref, err)
+	}
+	if hasDotDot(u.Host) || hasDotDot(u.Path) || hasDotDot(g.Path) {
+		return GitReference{}, fmt.Errorf("invalid git reference %s: paths may not contain '..'", ref)
+	}
+	return g, nil
+}
+
+// hasDotDot reports whether p has a '..' segment, with either slash as the
+// separator.
+func hasDotDot(p string) bool {
+	for _, segment := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the reference in its git+<url>//<path>@<ref> form.
+func (g GitReference) String() string {
+	return "git+" + g.Repository + "//" + g.Path + "@" + g.Ref
+}
+
+// ParseLayoutReference splits an oci-layout://<path>[:<tag>|@<digest>] reference
+// into the layout path and the tag or digest inside it.
+func ParseLayoutReference(ref string) (LayoutReference, error) {
+	if !strings.HasPrefix(ref, LayoutScheme) {
+		return LayoutReference{}, fmt.Errorf("invalid OCI layout reference: %s", ref)
+	}
+	raw := strings.TrimPrefix(ref, LayoutScheme)
+	l := LayoutReference{Path: raw, Reference: "latest"}
+	slash := strings.LastIndex(raw, "/")
+	if at := strings.LastIndex(raw, "@"); at > slash {
+		l.Path, l.Reference = raw[:at], raw[at+1:]
+	} else if colon := strings.LastIndex(raw, ":"); colon > slash {
+		l.Path, l.Reference = raw[:colon], raw[colon+1:]
+	}
+	if l.Path == "" || l.Reference == "" {
+		return LayoutReference{}, fmt.Errorf("invalid OCI layout reference: %s", ref)
+	}
+	return l, nil
+}
+
 // SaveConfig writes any in-memory changes back to the config file.
 func SaveConfig() error {
 	return viper.WriteConfig()
@@ -147,10 +484,24 @@ func SaveConfig() error {
 
 // NormalizeKey transforms an endpoint string into a valid key
 // used for storing credentials in viper (dots replaced by underscores).
+// URLs are reduced to their host, so https://host/path and host share a key.
 func NormalizeKey(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			endpoint = u.Host
+		}
+	}
 	return strings.ReplaceAll(endpoint, ".", "_")
 }
 
+// ValidateOutput returns an error unless output is a supported output format.
+func ValidateOutput(output string) error {
+	if output != OutputText && output != OutputJSON {
+		return fmt.Errorf("invalid output %q: must be %q or %q", output, OutputText, OutputJSON)
+	}
+	return nil
+}
+
 // PrintConfig outputs the raw contents of the configuration file to stdout.
 func (c *Config) PrintConfig() error {
 	configFilePath := viper.GetString("configFile")
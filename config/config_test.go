@@ -24,8 +24,10 @@ package config
 import (
 	"errors"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -174,6 +176,60 @@ func TestInitConfigReadConfigError(t *testing.T) {
 	}
 }
 
+// TestInitConfigCacheRefs verifies the cacheRefs default and its validation.
+func TestInitConfigCacheRefs(t *testing.T) {
+	viper.Reset()
+
+	tmpHome := t.TempDir()
+	_ = os.Setenv("HOME", tmpHome)
+	cfg, err := InitConfig()
+	if err != nil {
+		t.Fatalf("InitConfig error: %v", err)
+	}
+	if cfg.CacheRefs != defaultCacheRefs {
+		t.Errorf("expected default cacheRefs %q, got %q", defaultCacheRefs, cfg.CacheRefs)
+	}
+	if cfg.MaxArtifactSize != DefaultMaxArtifactSize {
+		t.Errorf("expected default maxArtifactSize %d, got %d", DefaultMaxArtifactSize, cfg.MaxArtifactSize)
+	}
+	if cfg.MakeBinary != DefaultMakeBinary {
+		t.Errorf("expected default makeBinary %q, got %q", DefaultMakeBinary, cfg.MakeBinary)
+	}
+	if cfg.ContainerRuntime != "" {
+		t.Errorf("expected no default containerRuntime, got %q", cfg.ContainerRuntime)
+	}
+
+	if err := os.WriteFile(cfg.ConfigFile, []byte("cacheRefs: hardlink\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	if _, err := InitConfig(); err == nil {
+		t.Error("expected error for invalid cacheRefs")
+	}
+}
+
+// TestInitConfigOutput verifies the output default and its validation.
+func TestInitConfigOutput(t *testing.T) {
+	viper.Reset()
+
+	_ = os.Setenv("HOME", t.TempDir())
+	cfg, err := InitConfig()
+	if err != nil {
+		t.Fatalf("InitConfig error: %v", err)
+	}
+	if cfg.Output != OutputText {
+		t.Errorf("expected default output %q, got %q", OutputText, cfg.Output)
+	}
+
+	if err := os.WriteFile(cfg.ConfigFile, []byte("output: xml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	if _, err := InitConfig(); err == nil {
+		t.Error("expected error for invalid output")
+	}
+}
+
 // TestPrintConfigError ensures PrintConfig returns an error when the file path is invalid.
 func TestPrintConfigError(t *testing.T) {
 	viper.Reset()
@@ -214,6 +270,72 @@ func TestParseReference(t *testing.T) {
 	if got := cfg.ParseReference("no_such_file_123"); got != ReferenceOCI {
 		t.Errorf("expected OCI for missing file, got %v", got)
 	}
+
+	// oci:// is never a local file, even if one exists by that name
+	if err := os.MkdirAll("oci:/f_rel.txt", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll("oci:") }()
+	if got := cfg.ParseReference("oci://f_rel.txt"); got != ReferenceOCI {
+		t.Errorf("expected OCI for oci:// reference, got %v", got)
+	}
+}
+
+// TestParseGitReference verifies repository, path and ref splitting.
+func TestParseGitReference(t *testing.T) {
+	cases := map[string]GitReference{
+		"git+https://github.com/org/repo.git//make/redis.mk@v1.2.0": {"https://github.com/org/repo.git", "make/redis.mk", "v1.2.0"},
+		"git+ssh://git@github.com/org/repo.git//Makefile":           {"ssh://git@github.com/org/repo.git", "Makefile", "HEAD"},
+		"git+file:///srv/repo.git//ci/ci.mk@main":                   {"file:///srv/repo.git", "ci/ci.mk", "main"},
+	}
+	for ref, want := range cases {
+		got, err := ParseGitReference(ref)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", ref, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", ref, want, got)
+		}
+	}
+	for _, ref := range []string{"https://x/y", "git+nourl", "git+https://host/repo.git", "git+https://host/repo.git//file@", "git+https:////file",
+		"git+https://host/../../etc//Makefile", "git+https://host/%2e%2e/repo.git//Makefile", "git+https://host/repo.git//../../Makefile@v1",
+		"git+https://host/repo.git//make\\..\\..\\x.mk", "git+https://../repo.git//Makefile"} {
+		if _, err := ParseGitReference(ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+	if (&Config{}).ParseReference("git+https://host/repo.git//Makefile") != ReferenceGit {
+		t.Error("expected ReferenceGit")
+	}
+}
+
+// TestParseLayoutReference verifies path and tag/digest splitting.
+func TestParseLayoutReference(t *testing.T) {
+	cases := map[string]LayoutReference{
+		"oci-layout:///srv/layout:v1":             {"/srv/layout", "v1"},
+		"oci-layout://./layout":                   {"./layout", "latest"},
+		"oci-layout:///tmp/make.tar@sha256:abc":   {"/tmp/make.tar", "sha256:abc"},
+		"oci-layout://host:8080/dir/layout:1.0.0": {"host:8080/dir/layout", "1.0.0"},
+	}
+	for ref, want := range cases {
+		got, err := ParseLayoutReference(ref)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", ref, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", ref, want, got)
+		}
+	}
+	for _, ref := range []string{"/srv/layout:v1", "oci-layout://", "oci-layout:///srv/layout:"} {
+		if _, err := ParseLayoutReference(ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+	if (&Config{}).ParseReference("oci-layout:///srv/layout:v1") != ReferenceOCILayout {
+		t.Error("expected ReferenceOCILayout")
+	}
 }
 
 // TestNormalizeKey verifies that dots are replaced by underscores.
@@ -222,6 +344,9 @@ func TestNormalizeKey(t *testing.T) {
 	if out != "a_b_c" {
 		t.Errorf("unexpected normalize: got %q want %q", out, "a_b_c")
 	}
+	if out := NormalizeKey("https://files.example.com/x/y"); out != "files_example_com" {
+		t.Errorf("expected URL to normalize to its host, got %q", out)
+	}
 }
 
 // TestInitConfigUserHomeDirError covers the error return path of os.UserHomeDir.
@@ -240,3 +365,87 @@ func TestInitConfigUserHomeDirError(t *testing.T) {
 		t.Fatal("expected InitConfig to return error when UserHomeDir fails")
 	}
 }
+
+func TestConfigLog(t *testing.T) {
+	var nilCfg *Config
+	if nilCfg.Log() == nil || (&Config{}).Log() == nil {
+		t.Fatal("expected a discarding logger when none is configured")
+	}
+	if (&Config{}).Log().Enabled(t.Context(), slog.LevelError) {
+		t.Error("expected the default logger to discard records")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if (&Config{Logger: logger}).Log() != logger {
+		t.Error("expected the configured logger")
+	}
+}
+
+// TestReferenceVars verifies vars are read per reference from the config file.
+func TestReferenceVars(t *testing.T) {
+	viper.Reset()
+
+	_ = os.Setenv("HOME", t.TempDir())
+	cfg, err := InitConfig()
+	if err != nil {
+		t.Fatalf("InitConfig error: %v", err)
+	}
+	content := "vars:\n  ghcr.io/org/make-redis:\n    - REDIS_PORT=6380\n    - MODE=dev\n  ghcr.io/org/make-redis:v2:\n    - MODE=prod\n"
+	if err := os.WriteFile(cfg.ConfigFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	if cfg, err = InitConfig(); err != nil {
+		t.Fatalf("InitConfig error: %v", err)
+	}
+
+	tests := map[string][]string{
+		"ghcr.io/org/make-redis":            {"REDIS_PORT=6380", "MODE=dev"},
+		"ghcr.io/org/make-redis:v1":         {"REDIS_PORT=6380", "MODE=dev"},
+		"ghcr.io/org/make-redis:v2":         {"REDIS_PORT=6380", "MODE=dev", "MODE=prod"},
+		"ghcr.io/org/make-redis@sha256:abc": {"REDIS_PORT=6380", "MODE=dev"},
+		"ghcr.io/org/make-go:v1":            nil,
+	}
+	for ref, want := range tests {
+		if got := cfg.ReferenceVars(ref); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("ReferenceVars(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+// TestSandboxFor verifies sandbox settings are read per reference pattern.
+func TestSandboxFor(t *testing.T) {
+	viper.Reset()
+
+	_ = os.Setenv("HOME", t.TempDir())
+	cfg, err := InitConfig()
+	if err != nil {
+		t.Fatalf("InitConfig error: %v", err)
+	}
+	content := "sandbox:\n  ghcr.io/untrusted/*:\n    always: true\n    env: [GOCACHE]\n  ghcr.io/untrusted/net-*:\n    network: true\n"
+	if err := os.WriteFile(cfg.ConfigFile, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	if cfg, err = InitConfig(); err != nil {
+		t.Fatalf("InitConfig error: %v", err)
+	}
+
+	sb, ok := cfg.SandboxFor("ghcr.io/untrusted/make:v1")
+	if !ok || !sb.Always || sb.Network || len(sb.Env) != 1 || sb.Env[0] != "GOCACHE" {
+		t.Errorf("unexpected sandbox %+v (%v)", sb, ok)
+	}
+	if sb, ok := cfg.SandboxFor("ghcr.io/untrusted/net-tools@sha256:abc"); !ok || !sb.Network || sb.Always {
+		t.Errorf("expected the longest pattern to win, got %+v (%v)", sb, ok)
+	}
+	if _, ok := cfg.SandboxFor("ghcr.io/trusted/make:v1"); ok {
+		t.Error("expected no sandbox for an unmatched reference")
+	}
+
+	if err := os.WriteFile(cfg.ConfigFile, []byte("sandbox: yes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	if _, err := InitConfig(); err == nil {
+		t.Error("expected error for invalid sandbox settings")
+	}
+}
@@ -22,49 +22,215 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/TrianaLab/remake/config"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // These vars allows us to override functions in tests.
 var (
-	parseRef    = name.ParseReference
-	mkdirAll    = os.MkdirAll
-	renameFile  = os.Rename
-	removePath  = os.Remove
-	symlinkPath = os.Symlink
-	createFile  = os.Create
-	copyData    = io.Copy
-	closeFile   = func(f *os.File) error { return f.Close() }
-	symlink     = os.Symlink
-	readLink    = os.Readlink
+	parseRef   = name.ParseReference
+	mkdirAll   = os.MkdirAll
+	renameFile = os.Rename
+	removePath = os.Remove
+	createTemp = os.CreateTemp
+	copyData   = io.Copy
+	closeFile  = func(f *os.File) error { return f.Close() }
+	symlink    = os.Symlink
+	readLink   = os.Readlink
 )
 
 // CacheRepository defines the interface for caching Makefile artifacts.
 // Implementations may store artifacts locally, over HTTP, or in OCI registries.
 type CacheRepository interface {
-	// Push stores the given data bytes under the specified reference key.
-	// The reference typically matches an OCI artifact reference or URL.
-	Push(ctx context.Context, reference string, data []byte) error
+	// Push stores the data read from r under the specified reference key.
+	// The reference typically matches an OCI artifact reference or URL, and
+	// desc describes the data as returned by the client that fetched it. The
+	// data is streamed to disk and checked against desc's digest and size
+	// when they are set.
+	Push(ctx context.Context, reference string, desc v1.Descriptor, r io.Reader) error
 
 	// Pull retrieves a cached artifact by reference and returns the
 	// local filesystem path where the data is stored.
 	Pull(ctx context.Context, reference string) (string, error)
+
+	// Delete drops the cached entry for reference so that later pulls
+	// miss the cache. Deleting an entry that does not exist is not an error.
+	Delete(ctx context.Context, reference string) error
+}
+
+// Annotator is implemented by caches that keep the annotations of the
+// artifacts they store, such as the OCI cache.
+type Annotator interface {
+	// Annotations returns the manifest and Makefile layer annotations of the
+	// artifact cached for reference, layer annotations taking precedence.
+	Annotations(ctx context.Context, reference string) (map[string]string, error)
+}
+
+// Lister is implemented by caches that can enumerate the references they
+// hold, such as the OCI and HTTP caches.
+type Lister interface {
+	// References returns the references of the cached artifacts.
+	References(ctx context.Context) ([]string, error)
+}
+
+// Evicter is implemented by caches where several references can name the
+// same artifact, such as the OCI cache for tags and digests.
+type Evicter interface {
+	// Evict drops the artifact cached for reference under every reference
+	// that names it. Evicting an artifact that is not cached is not an error.
+	Evict(ctx context.Context, reference string) error
+}
+
+// Revalidator is implemented by caches that record the validators servers
+// return for an artifact, such as the HTTP cache, so that fetching it again
+// can be made conditional.
+type Revalidator interface {
+	// Validators returns the AnnotationETag and AnnotationLastModified
+	// annotations recorded for the cached version of reference, or nil when
+	// there are none.
+	Validators(ctx context.Context, reference string) (map[string]string, error)
+}
+
+// Resolver is implemented by caches whose references can name a moving
+// target, such as the git cache for branches and tags.
+type Resolver interface {
+	// Resolve returns reference pinned to what it currently names, so that
+	// the artifact fetched for it matches the cache key.
+	Resolve(ctx context.Context, reference string) (string, error)
 }
 
 // NewCache constructs a CacheRepository based on the reference type.
-// It inspects the reference string and returns an HTTP-based cache
-// or an OCI repository-based cache. Returns nil for unsupported types.
+// It inspects the reference string and returns an HTTP-based cache, a
+// git commit-keyed cache, or an OCI repository-based cache.
+// Returns nil for unsupported types.
 func NewCache(cfg *config.Config, reference string) CacheRepository {
 	switch cfg.ParseReference(reference) {
 	case config.ReferenceHTTP:
 		return NewHTTPCache(cfg)
 	case config.ReferenceOCI:
 		return NewOCIRepository(cfg)
+	case config.ReferenceGit:
+		return NewGitCache(cfg)
+	}
+	return nil
+}
+
+// writeBlob stores data as 'dir/<digest>'. The data is written to a uniquely
+// named temporary file first and renamed into place, so concurrent writers
+// never share a temporary file and readers never see a partial blob.
+func writeBlob(dir, digest string, data []byte) (string, error) {
+	if err := mkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	blobPath := filepath.Join(dir, digest)
+	f, err := createTemp(dir, digest+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := copyData(f, bytes.NewReader(data)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := closeFile(f); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := renameFile(f.Name(), blobPath); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return blobPath, nil
+}
+
+// ingest streams r into a new temporary file in dir while computing its
+// digest. The data must match desc's digest and size when they are set and
+// may not exceed cfg.MaxArtifactSize. On success the caller owns the returned
+// file, which is still open and positioned at its start.
+func ingest(cfg *config.Config, dir string, r io.Reader, desc v1.Descriptor) (*os.File, digest.Digest, int64, error) {
+	limit := cfg.MaxArtifactSize
+	if limit > 0 && desc.Size > limit {
+		return nil, "", 0, fmt.Errorf("artifact of %d bytes exceeds maxArtifactSize of %d bytes", desc.Size, limit)
+	}
+	if err := mkdirAll(dir, 0o755); err != nil {
+		return nil, "", 0, err
+	}
+	f, err := createTemp(dir, "ingest.*.tmp")
+	if err != nil {
+		return nil, "", 0, err
+	}
+	fail := func(err error) (*os.File, digest.Digest, int64, error) {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, "", 0, err
+	}
+
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	digester := digest.Canonical.Digester()
+	n, err := copyData(io.MultiWriter(f, digester.Hash()), r)
+	if err != nil {
+		return fail(err)
+	}
+	if limit > 0 && n > limit {
+		return fail(fmt.Errorf("artifact exceeds maxArtifactSize of %d bytes", limit))
+	}
+	dgst := digester.Digest()
+	if desc.Size > 0 && n != desc.Size {
+		return fail(fmt.Errorf("size mismatch: expected %d bytes, got %d", desc.Size, n))
+	}
+	if desc.Digest != "" && dgst != desc.Digest {
+		return fail(fmt.Errorf("digest mismatch: expected %s, got %s", desc.Digest, dgst))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return f, dgst, n, nil
+}
+
+// writeStream stores the data read from r as a blob in dir named after its
+// digest (see blobName), verifying it as described for ingest. The blob is
+// renamed into place once complete, so readers never see a partial blob.
+func writeStream(cfg *config.Config, dir string, r io.Reader, desc v1.Descriptor) (string, digest.Digest, error) {
+	f, dgst, _, err := ingest(cfg, dir, r, desc)
+	if err != nil {
+		return "", "", err
+	}
+	if err := closeFile(f); err != nil {
+		_ = os.Remove(f.Name())
+		return "", "", err
+	}
+	blobPath := filepath.Join(dir, blobName(cfg, dgst.String()))
+	if err := renameFile(f.Name(), blobPath); err != nil {
+		_ = os.Remove(f.Name())
+		return "", "", err
+	}
+	return blobPath, dgst, nil
+}
+
+// replaceSymlink atomically points link at target: the symlink is created
+// under a unique temporary name and renamed over link, so readers always see
+// either the previous or the new target.
+func replaceSymlink(target, link string) error {
+	tmp := link + "." + strconv.FormatUint(rand.Uint64(), 36) + ".tmp"
+	if err := symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := renameFile(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return err
 	}
 	return nil
 }
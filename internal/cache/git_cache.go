@@ -0,0 +1,235 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/redact"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// commitPattern matches full and abbreviated hexadecimal commit ids.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// fullCommitPattern matches full SHA-1 and SHA-256 commit ids.
+var fullCommitPattern = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// refRules are the full ref names git tries, in order, for a short name
+// (see gitrevisions(7)), so tags win over branches of the same name.
+var refRules = []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"}
+
+// lsRemote lists the refs of a remote git repository matching pattern.
+// It is a variable so tests can run without network access.
+var lsRemote = func(ctx context.Context, repository, pattern string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", repository, pattern)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GitCache implements CacheRepository for git references. Files are stored
+// under 'cacheDir/git/<host>/<repo>/<path>/blobs' and keyed by the commit they
+// were read from, so a branch or tag is looked up by resolving it to a commit
+// with 'git ls-remote' and a pinned commit never needs the network.
+type GitCache struct {
+	cfg      *config.Config
+	resolved map[string]string
+}
+
+// NewGitCache returns a new GitCache configured with the given settings.
+func NewGitCache(cfg *config.Config) CacheRepository {
+	return &GitCache{cfg: cfg, resolved: map[string]string{}}
+}
+
+// Push stores the data read from r as the content of the referenced file at the commit the
+// reference currently resolves to, and atomically links 'refs/<commit>' to the blob.
+func (c *GitCache) Push(ctx context.Context, reference string, desc v1.Descriptor, r io.Reader) error {
+	ref, base, err := c.location(reference)
+	if err != nil {
+		return err
+	}
+	commit, err := c.commit(ctx, ref)
+	if err != nil {
+		return err
+	}
+	blobPath, digest, err := writeStream(c.cfg, filepath.Join(base, "blobs"), r, desc)
+	if err != nil {
+		return fmt.Errorf("caching %s: %w", reference, err)
+	}
+	c.cfg.Log().Debug("stored blob", "reference", redact.Reference(reference), "commit", commit, "path", blobPath)
+
+	unlock, err := lockCache(c.cfg.CacheDir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	refDir := filepath.Join(base, "refs")
+	if err := mkdirAll(refDir, 0o755); err != nil {
+		return err
+	}
+	return writeRef(c.cfg, blobPath, digest.String(), filepath.Join(refDir, commit))
+}
+
+// Pull resolves the reference to a commit and returns the cached file for
+// that commit. Returns an error on cache miss or when the ref cannot be resolved.
+func (c *GitCache) Pull(ctx context.Context, reference string) (string, error) {
+	ref, base, err := c.location(reference)
+	if err != nil {
+		return "", err
+	}
+	commit, err := c.commit(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	target, err := readRef(c.cfg, filepath.Join(base, "refs", commit))
+	if err != nil {
+		return "", fmt.Errorf("cache miss for %s", redact.Reference(reference))
+	}
+	return target, nil
+}
+
+// Delete removes the cached entry for the commit the reference resolves to.
+func (c *GitCache) Delete(ctx context.Context, reference string) error {
+	ref, base, err := c.location(reference)
+	if err != nil {
+		return err
+	}
+	commit, err := c.commit(ctx, ref)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockCache(c.cfg.CacheDir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := removePath(filepath.Join(base, "refs", commit)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Resolve returns reference pinned to the commit its ref resolves to, so
+// that the file fetched for it is the one cached under that commit.
+func (c *GitCache) Resolve(ctx context.Context, reference string) (string, error) {
+	ref, err := config.ParseGitReference(reference)
+	if err != nil {
+		return "", err
+	}
+	commit, err := c.commit(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	ref.Ref = commit
+	return ref.String(), nil
+}
+
+// location parses reference and returns the cache directory for its file.
+func (c *GitCache) location(reference string) (config.GitReference, string, error) {
+	ref, err := config.ParseGitReference(reference)
+	if err != nil {
+		return ref, "", err
+	}
+	u, err := url.Parse(ref.Repository)
+	if err != nil {
+		return ref, "", err
+	}
+	host := u.Host
+	if host == "" {
+		host = "local"
+	}
+	repo := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	elems := []string{c.cfg.CacheDir, "git", host}
+	elems = append(elems, strings.Split(repo, "/")...)
+	elems = append(elems, strings.Split(ref.Path, "/")...)
+	return ref, filepath.Join(elems...), nil
+}
+
+// commit resolves the ref of a git reference to a commit id. Full commit ids
+// are used as-is; branches and tags are resolved with 'git ls-remote' using
+// git's own precedence, taking the peeled commit of annotated tags. Results
+// are memoized so that a single pull observes one consistent commit.
+func (c *GitCache) commit(ctx context.Context, ref config.GitReference) (string, error) {
+	key := ref.Repository + "@" + ref.Ref
+	if commit, ok := c.resolved[key]; ok {
+		return commit, nil
+	}
+	if fullCommitPattern.MatchString(ref.Ref) {
+		c.resolved[key] = ref.Ref
+		return ref.Ref, nil
+	}
+	out, err := lsRemote(ctx, ref.Repository, ref.Ref)
+	if err != nil {
+		return "", err
+	}
+	commit := matchRef(out, ref.Ref)
+	if commit == "" {
+		// Abbreviated commit ids are not advertised by the remote
+		if !commitPattern.MatchString(ref.Ref) {
+			return "", fmt.Errorf("cannot resolve %s in %s", ref.Ref, redact.Reference(ref.Repository))
+		}
+		commit = ref.Ref
+	}
+	c.cfg.Log().Info("resolved git reference", "repository", redact.Reference(ref.Repository), "ref", ref.Ref, "commit", commit)
+	c.resolved[key] = commit
+	return commit, nil
+}
+
+// matchRef returns the commit that name refers to in the 'git ls-remote'
+// output out, trying the full ref names of refRules in order, or "" when
+// none is listed.
+func matchRef(out []byte, name string) string {
+	refs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	for _, rule := range refRules {
+		full := fmt.Sprintf(rule, name)
+		if peeled, ok := refs[full+"^{}"]; ok {
+			return peeled
+		}
+		if commit, ok := refs[full]; ok {
+			return commit
+		}
+	}
+	return ""
+}
@@ -22,22 +22,64 @@
 package cache
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/redact"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+const (
+	// AnnotationETag is the descriptor annotation holding the ETag header
+	// returned when an HTTP(S) artifact was fetched.
+	AnnotationETag = "dev.remake.http.etag"
+
+	// AnnotationLastModified is the descriptor annotation holding the
+	// Last-Modified header returned when an HTTP(S) artifact was fetched.
+	AnnotationLastModified = "dev.remake.http.last-modified"
+)
+
+// maxHTTPVersions is the number of versions of an HTTP(S) artifact kept in
+// the history of its 'meta.json' file.
+const maxHTTPVersions = 20
+
+// HTTPVersion is a version of an HTTP(S) artifact recorded in the cache.
+type HTTPVersion struct {
+	Digest       string    `json:"digest"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// httpMetadata is the contents of an entry's 'meta.json' file.
+type httpMetadata struct {
+	URL      string        `json:"url"`
+	Versions []HTTPVersion `json:"versions"`
+}
+
 // HTTPCache implements CacheRepository for HTTP(S) references.
-// It stores blobs under a directory structure based on the URL host and path,
-// using SHA-256 digests for content addressing and symbolic links for references.
+// Each normalized URL, query string included, gets its own entry under
+// 'cacheDir/http/<host>/<sha256 of URL>' holding the blobs of every version
+// fetched, a 'refs/latest' ref to the newest one and a 'meta.json' file with
+// the URL and its history of up to maxHTTPVersions versions (digest, ETag,
+// Last-Modified), whose validators make fetching it again conditional (see
+// Validators). Refs are
+// symbolic links or pointer files (see config.CacheRefs). A reference ending
+// in '#sha256:<hex>' is pinned to that version and is served from the
+// history without moving 'latest'.
 type HTTPCache struct {
 	cfg *config.Config
 }
@@ -47,75 +89,261 @@ func NewHTTPCache(cfg *config.Config) CacheRepository {
 	return &HTTPCache{cfg: cfg}
 }
 
-// Push stores the given data bytes at a cache path derived from the reference URL.
-// It computes a SHA-256 digest, writes the blob under 'cacheDir/host/.../blobs',
-// and creates or updates a 'latest' symlink under 'cacheDir/host/.../refs'.
-func (c *HTTPCache) Push(ctx context.Context, reference string, data []byte) error {
-	u, err := url.Parse(reference)
+// PinnedDigest returns the digest a reference is pinned to with a
+// '#sha256:<hex>' fragment, or an empty string if it is not pinned.
+func PinnedDigest(reference string) string {
+	_, fragment, ok := strings.Cut(reference, "#")
+	if !ok || !digestPattern.MatchString(fragment) {
+		return ""
+	}
+	return fragment
+}
+
+// Push stores the data read from r as a version of the reference URL. The
+// blob is streamed into the entry's 'blobs' directory, the version is recorded in
+// 'meta.json' along with the validators in desc, and unless the reference is
+// pinned 'refs/latest' is atomically pointed at it. The cache lock is held so
+// that concurrent processes do not interleave.
+func (c *HTTPCache) Push(ctx context.Context, reference string, desc v1.Descriptor, r io.Reader) error {
+	u, base, err := c.entry(reference)
 	if err != nil {
 		return err
 	}
-	sum := sha256.Sum256(data)
-	digest := "sha256:" + hex.EncodeToString(sum[:])
-
-	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
-	base := append([]string{c.cfg.CacheDir, u.Host}, segments...)
+	if pinned := PinnedDigest(reference); pinned != "" {
+		if desc.Digest != "" && desc.Digest.String() != pinned {
+			return fmt.Errorf("digest mismatch for %s: got %s", reference, desc.Digest)
+		}
+		desc.Digest = digest.Digest(pinned)
+	}
 
-	blobDir := filepath.Join(append(base, "blobs")...)
-	if err := os.MkdirAll(blobDir, 0o755); err != nil {
-		return err
+	// The blob is complete and verified before the lock is taken, so a slow
+	// download does not hold up other processes
+	blobPath, dgst, err := writeStream(c.cfg, filepath.Join(base, "blobs"), r, desc)
+	if err != nil {
+		return fmt.Errorf("caching %s: %w", reference, err)
 	}
-	blobPath := filepath.Join(blobDir, digest)
-	tmp := blobPath + ".tmp"
-	f, err := createFile(tmp)
+	c.cfg.Log().Debug("stored blob", "reference", redact.Reference(reference), "path", blobPath)
+
+	unlock, err := lockCache(c.cfg.CacheDir, true)
 	if err != nil {
 		return err
 	}
-	if _, err := copyData(f, bytes.NewReader(data)); err != nil {
-		_ = f.Close()
+	defer unlock()
+
+	if err := c.record(base, u, HTTPVersion{
+		Digest:       dgst.String(),
+		ETag:         desc.Annotations[AnnotationETag],
+		LastModified: desc.Annotations[AnnotationLastModified],
+		Fetched:      time.Now().UTC(),
+	}); err != nil {
 		return err
 	}
-	if err := closeFile(f); err != nil {
-		return err
+	if PinnedDigest(reference) != "" {
+		return nil
 	}
-	if err := os.Rename(tmp, blobPath); err != nil {
+
+	refDir := filepath.Join(base, "refs")
+	if err := os.MkdirAll(refDir, 0o755); err != nil {
 		return err
 	}
+	return writeRef(c.cfg, blobPath, dgst.String(), filepath.Join(refDir, "latest"))
+}
 
-	refDir := filepath.Join(append(base, "refs")...)
-	if err := os.MkdirAll(refDir, 0o755); err != nil {
+// Pull returns the cached blob for the reference URL: the version its
+// '#sha256:' fragment pins, or the one 'refs/latest' points to.
+// Returns an error if the cache entry does not exist or is invalid.
+func (c *HTTPCache) Pull(ctx context.Context, reference string) (string, error) {
+	_, base, err := c.entry(reference)
+	if err != nil {
+		return "", err
+	}
+	if pinned := PinnedDigest(reference); pinned != "" {
+		if path, ok := findBlob(filepath.Join(base, "blobs"), pinned); ok {
+			return path, nil
+		}
+		return "", fmt.Errorf("cache miss for %s", redact.Reference(reference))
+	}
+
+	target, err := readRef(c.cfg, filepath.Join(base, "refs", "latest"))
+	if errors.Is(err, errNoRef) {
+		return "", fmt.Errorf("cache miss for %s", redact.Reference(reference))
+	}
+	if err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// Delete removes the 'latest' ref for the given reference URL. Recorded
+// versions remain available to pinned references.
+func (c *HTTPCache) Delete(ctx context.Context, reference string) error {
+	_, base, err := c.entry(reference)
+	if err != nil {
 		return err
 	}
-	latest := filepath.Join(refDir, "latest")
-	// ignore error if symlink does not exist
-	if err := os.Remove(latest); err != nil && !os.IsNotExist(err) {
+	unlock, err := lockCache(c.cfg.CacheDir, true)
+	if err != nil {
 		return err
 	}
-	if err := symlink(blobPath, latest); err != nil {
+	defer unlock()
+
+	if err := os.Remove(filepath.Join(base, "refs", "latest")); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
-// Pull retrieves the cached path for the given reference URL.
-// It reads the 'latest' symlink under 'cacheDir/host/.../refs' and returns its target.
-// Returns an error if the cache entry does not exist or is invalid.
-func (c *HTTPCache) Pull(ctx context.Context, reference string) (string, error) {
-	u, err := url.Parse(reference)
+// Validators returns the ETag and Last-Modified recorded for the version
+// 'refs/latest' points to, as AnnotationETag and AnnotationLastModified
+// annotations. Pinned references and versions recorded without validators
+// yield nil.
+func (c *HTTPCache) Validators(ctx context.Context, reference string) (map[string]string, error) {
+	if PinnedDigest(reference) != "" {
+		return nil, nil
+	}
+	_, base, err := c.entry(reference)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	target, err := readRef(c.cfg, filepath.Join(base, "refs", "latest"))
+	if errors.Is(err, errNoRef) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
-	baseElems := append([]string{c.cfg.CacheDir, u.Host}, segments...)
+	meta, err := readMetadata(base)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(target)
+	for i := len(meta.Versions) - 1; i >= 0; i-- {
+		v := meta.Versions[i]
+		if name != v.Digest && name != strings.Replace(v.Digest, ":", "-", 1) {
+			continue
+		}
+		annotations := map[string]string{}
+		if v.ETag != "" {
+			annotations[AnnotationETag] = v.ETag
+		}
+		if v.LastModified != "" {
+			annotations[AnnotationLastModified] = v.LastModified
+		}
+		if len(annotations) == 0 {
+			return nil, nil
+		}
+		return annotations, nil
+	}
+	return nil, nil
+}
 
-	link := filepath.Join(append(append(baseElems, "refs"), "latest")...)
-	info, err := os.Lstat(link)
-	if err != nil || info.Mode()&os.ModeSymlink == 0 {
-		return "", fmt.Errorf("cache miss for %s", reference)
+// References returns the URLs of the cached entries, read from their
+// 'meta.json' files.
+func (c *HTTPCache) References(ctx context.Context) ([]string, error) {
+	entries, err := filepath.Glob(filepath.Join(c.cfg.CacheDir, "http", "*", "*", "meta.json"))
+	if err != nil {
+		return nil, err
 	}
-	target, err := readLink(link)
+	var refs []string
+	for _, entry := range entries {
+		meta, err := readMetadata(filepath.Dir(entry))
+		if err != nil {
+			return nil, err
+		}
+		if meta.URL != "" {
+			refs = append(refs, meta.URL)
+		}
+	}
+	return refs, nil
+}
+
+// entry returns the normalized reference URL and its cache directory.
+func (c *HTTPCache) entry(reference string) (*url.URL, string, error) {
+	u, err := normalizeURL(reference)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
-	return target, nil
+	sum := sha256.Sum256([]byte(u.String()))
+	host := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(u.Host)
+	return u, filepath.Join(c.cfg.CacheDir, "http", host, hex.EncodeToString(sum[:])), nil
+}
+
+// record adds version to the history in 'meta.json', replacing any earlier
+// record of the same digest so that the newest version comes last, and drops
+// the oldest versions beyond maxHTTPVersions. Their blobs are kept, so
+// references pinned to them still hit the cache.
+func (c *HTTPCache) record(base string, u *url.URL, version HTTPVersion) error {
+	meta, err := readMetadata(base)
+	if err != nil {
+		return err
+	}
+	meta.URL = u.String()
+	versions := meta.Versions[:0]
+	for _, v := range meta.Versions {
+		if v.Digest != version.Digest {
+			versions = append(versions, v)
+		}
+	}
+	meta.Versions = append(versions, version)
+	if len(meta.Versions) > maxHTTPVersions {
+		meta.Versions = meta.Versions[len(meta.Versions)-maxHTTPVersions:]
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeBlob(base, "meta.json", data)
+	return err
+}
+
+// readMetadata reads the 'meta.json' file of an entry. A missing file yields
+// empty metadata.
+func readMetadata(base string) (httpMetadata, error) {
+	var meta httpMetadata
+	data, err := os.ReadFile(filepath.Join(base, "meta.json"))
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("reading cache metadata %s: %w", base, err)
+	}
+	return meta, nil
+}
+
+// normalizeURL returns the form of an HTTP(S) URL used as its cache key:
+// scheme and host are lowercased, default ports, credentials and the
+// fragment are dropped, query parameters are sorted and an empty path
+// becomes '/'.
+func normalizeURL(reference string) (*url.URL, error) {
+	u, err := url.Parse(reference)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid HTTP reference: %s", reference)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	u.RawQuery = u.Query().Encode()
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u, nil
 }
@@ -22,22 +22,39 @@
 package cache
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/TrianaLab/remake/config"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	oras "oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/oci"
+	"oras.land/oras-go/v2/errdef"
+)
+
+const (
+	// FileMediaType is the media type of the Makefile layer of an artifact.
+	FileMediaType = "application/vnd.remake.file"
+
+	// ArtifactType is the artifact type of Remake manifests.
+	ArtifactType = "application/vnd.remake.artifact"
 )
 
 // OCIRepository implements CacheRepository for OCI artifact references.
-// It stores blobs under a directory structure based on registry and repository,
-// uses SHA-256 digests for content addressing, and symlinks tags and digests under refs.
+// All repositories share a single OCI image layout under 'cacheDir/oci', so
+// identical Makefiles are stored once and the cache can be read by standard
+// tools such as oras or skopeo. Manifests are tagged in 'index.json' with
+// their fully qualified reference (e.g., ghcr.io/org/repo:tag) and are also
+// addressable by digest, which lets digest-pinned pulls be answered offline.
 type OCIRepository struct {
 	cfg *config.Config
 }
@@ -47,103 +64,409 @@ func NewOCIRepository(cfg *config.Config) CacheRepository {
 	return &OCIRepository{cfg: cfg}
 }
 
-// Push caches the given data bytes as an OCI blob and creates a tag reference.
-// It parses the reference (with default registry), computes SHA-256 digest,
-// writes the blob under 'cacheDir/registry/repo/blobs', and symlinks under 'refs/<tag|digest>'.
-func (c *OCIRepository) Push(ctx context.Context, reference string, data []byte) error {
-	if strings.Contains(reference, "://") && !strings.HasPrefix(reference, "oci://") {
-		return fmt.Errorf("invalid OCI reference: %s", reference)
+// LayoutDir returns the directory of the OCI image layout used as the cache.
+func LayoutDir(cfg *config.Config) string {
+	return filepath.Join(cfg.CacheDir, "oci")
+}
+
+// OpenLayout opens (creating it if needed) the OCI image layout used as the cache.
+// The layout's index.json is loaded when it is opened and rewritten in place
+// on every tag change, so callers must hold the cache lock; writers should
+// go through StagingLayout and TagLayout instead.
+func OpenLayout(cfg *config.Config) (*oci.Store, error) {
+	store, err := oci.New(LayoutDir(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("opening cache layout: %w", err)
 	}
-	raw := strings.ToLower(strings.TrimPrefix(reference, "oci://"))
-	ref, err := parseRef(raw, name.WithDefaultRegistry(c.cfg.DefaultRegistry))
+	return store, nil
+}
+
+// StagingLayout opens the cache layout for copying blobs and manifests into
+// it without holding the cache lock. The store never saves its index, so
+// copied content is only visible to other readers once TagLayout tags it.
+// Blobs are written to temporary files and renamed into place, which makes
+// concurrent and interrupted downloads safe.
+func StagingLayout(cfg *config.Config) (*oci.Store, error) {
+	unlock, err := lockCache(cfg.CacheDir, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	sum := sha256.Sum256(data)
-	digest := "sha256:" + hex.EncodeToString(sum[:])
-	domain := ref.Context().RegistryStr()
-	repo := ref.Context().RepositoryStr()
+	defer unlock()
 
-	// Blob directory
-	blobDir := filepath.Join(c.cfg.CacheDir, domain, repo, "blobs")
-	if err := mkdirAll(blobDir, 0o755); err != nil {
+	store, err := OpenLayout(cfg)
+	if err != nil {
+		return nil, err
+	}
+	store.AutoSaveIndex = false
+	return store, nil
+}
+
+// TagLayout tags desc, which must already be stored in the cache layout (see
+// StagingLayout), as tag. The cache lock is held so concurrent writers do not
+// overwrite each other's index.json entries.
+func TagLayout(ctx context.Context, cfg *config.Config, desc v1.Descriptor, tag string) error {
+	unlock, err := lockCache(cfg.CacheDir, true)
+	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	// Write to temp file then atomically rename
-	blobPath := filepath.Join(blobDir, digest)
-	tmpPath := blobPath + ".tmp"
-	f, err := createFile(tmpPath)
+	store, err := OpenLayout(cfg)
 	if err != nil {
 		return err
 	}
-	if _, err := copyData(f, bytes.NewReader(data)); err != nil {
-		_ = f.Close()
+	if err := store.Tag(ctx, desc, tag); err != nil {
+		return fmt.Errorf("saving %s to cache: %w", tag, err)
+	}
+	return nil
+}
+
+// SaveToLayout copies the manifest tagged srcRef in src, along with the blobs
+// it references, into the cache layout and tags it as tag.
+func SaveToLayout(ctx context.Context, cfg *config.Config, src oras.ReadOnlyTarget, srcRef, tag string) error {
+	store, err := StagingLayout(cfg)
+	if err != nil {
 		return err
 	}
-	if err := closeFile(f); err != nil {
+	desc, err := oras.Copy(ctx, src, srcRef, store, "", oras.DefaultCopyOptions)
+	if err != nil {
+		return fmt.Errorf("saving %s to cache: %w", tag, err)
+	}
+	return TagLayout(ctx, cfg, desc, tag)
+}
+
+// LayoutTag returns the name under which an OCI reference is tagged in the
+// cache layout: the fully qualified "registry/repo:tag" or "registry/repo@digest".
+func LayoutTag(cfg *config.Config, reference string) (string, error) {
+	ref, err := parseOCIReference(cfg, reference)
+	if err != nil {
+		return "", err
+	}
+	return ref.Name(), nil
+}
+
+// Push makes sure the cache layout holds an artifact for reference whose
+// Makefile layer is the data read from r. Registry clients write pulled and
+// pushed manifests straight into the layout, in which case desc names a
+// layer that is already tagged and r is not read; otherwise the data is
+// streamed into the layout and a manifest packed around it is tagged with
+// the reference.
+func (c *OCIRepository) Push(ctx context.Context, reference string, desc v1.Descriptor, r io.Reader) error {
+	tag, err := LayoutTag(c.cfg, reference)
+	if err != nil {
 		return err
 	}
-	if err := renameFile(tmpPath, blobPath); err != nil {
+	store, err := StagingLayout(c.cfg)
+	if err != nil {
 		return err
 	}
 
-	// Refs directory
-	refDir := filepath.Join(c.cfg.CacheDir, domain, repo, "refs")
-	if err := mkdirAll(refDir, 0o755); err != nil {
+	layerDesc := v1.Descriptor{MediaType: FileMediaType, Digest: desc.Digest, Size: desc.Size}
+	if desc.Digest == "" || desc.Size <= 0 {
+		f, dgst, n, err := ingest(c.cfg, filepath.Join(LayoutDir(c.cfg), "ingest"), r, desc)
+		if err != nil {
+			return fmt.Errorf("caching %s: %w", reference, err)
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+		layerDesc.Digest, layerDesc.Size, r = dgst, n, f
+	}
+	if limit := c.cfg.MaxArtifactSize; limit > 0 && layerDesc.Size > limit {
+		return fmt.Errorf("caching %s: artifact of %d bytes exceeds maxArtifactSize of %d bytes", reference, layerDesc.Size, limit)
+	}
+	if manifestDesc, err := store.Resolve(ctx, tag); err == nil {
+		if layer, err := firstLayer(ctx, store, manifestDesc); err == nil && layer.Digest == layerDesc.Digest {
+			c.cfg.Log().Debug("layer already tagged", "tag", tag, "digest", layerDesc.Digest)
+			return nil
+		}
+	}
+	exists, err := store.Exists(ctx, layerDesc)
+	if err != nil {
 		return err
 	}
+	if !exists {
+		if err := store.Push(ctx, layerDesc, r); err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+			return fmt.Errorf("caching %s: %w", reference, err)
+		}
+	}
+	opts := oras.PackManifestOptions{Layers: []v1.Descriptor{layerDesc}}
+	manifestDesc, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, ArtifactType, opts)
+	if err != nil {
+		return fmt.Errorf("packing manifest: %w", err)
+	}
+	c.cfg.Log().Debug("stored layer", "tag", tag, "digest", layerDesc.Digest)
+	return TagLayout(ctx, c.cfg, manifestDesc, tag)
+}
 
-	// Remove existing tag symlink, ignoring "not exist"
-	tagPath := filepath.Join(refDir, ref.Identifier())
-	if err := removePath(tagPath); err != nil && !os.IsNotExist(err) {
-		return err
+// Pull resolves reference in the cache layout and returns the path of the
+// Makefile layer blob. Digest references are resolved by digest alone, so a
+// manifest cached under any repository satisfies them. Returns an error on cache miss.
+func (c *OCIRepository) Pull(ctx context.Context, reference string) (string, error) {
+	manifest, err := c.manifest(ctx, reference)
+	if err != nil {
+		return "", err
 	}
+	blobPath := BlobPath(c.cfg, manifest.Layers[0].Digest)
+	if _, err := os.Stat(blobPath); err != nil {
+		return "", fmt.Errorf("cache miss for %s", reference)
+	}
+	return blobPath, nil
+}
 
-	// Create new symlink
-	if err := symlinkPath(blobPath, tagPath); err != nil {
-		return err
+// Annotations returns the annotations of the manifest cached for reference,
+// merged with those of its Makefile layer.
+func (c *OCIRepository) Annotations(ctx context.Context, reference string) (map[string]string, error) {
+	manifest, err := c.manifest(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	annotations := map[string]string{}
+	for k, v := range manifest.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range manifest.Layers[0].Annotations {
+		annotations[k] = v
 	}
+	return annotations, nil
+}
 
-	return nil
+// References returns the tags of the cache layout, i.e. the fully qualified
+// references of the cached artifacts.
+func (c *OCIRepository) References(ctx context.Context) ([]string, error) {
+	if _, err := os.Stat(LayoutDir(c.cfg)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	unlock, err := lockCache(c.cfg.CacheDir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	store, err := OpenLayout(c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	err = store.Tags(ctx, "", func(tags []string) error {
+		refs = append(refs, tags...)
+		return nil
+	})
+	return refs, err
 }
 
-// Pull retrieves a cached artifact path for the given OCI reference.
-// It looks for a symlink under 'refs/<identifier>' first. If missing and the reference
-// is a digest, it checks the blob directly. Returns an error on cache miss.
-func (c *OCIRepository) Pull(ctx context.Context, reference string) (string, error) {
-	if strings.Contains(reference, "://") && !strings.HasPrefix(reference, "oci://") {
-		return "", fmt.Errorf("invalid OCI reference: %s", reference)
+// manifest reads the manifest cached for reference under a shared lock,
+// making sure it has at least one layer.
+func (c *OCIRepository) manifest(ctx context.Context, reference string) (v1.Manifest, error) {
+	var manifest v1.Manifest
+	err := withLayout(ctx, c.cfg, reference, func(store *oci.Store, manifestDesc v1.Descriptor) error {
+		var err error
+		if manifest, err = readManifest(ctx, store, manifestDesc); err != nil {
+			return fmt.Errorf("cache miss for %s: %w", reference, err)
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+// ResolveLayout returns the descriptor of the manifest cached for the OCI
+// reference in the cache layout, as it was pulled from its registry. The
+// manifest itself is stored as a blob (see BlobPath).
+func ResolveLayout(ctx context.Context, cfg *config.Config, reference string) (v1.Descriptor, error) {
+	var desc v1.Descriptor
+	err := withLayout(ctx, cfg, reference, func(store *oci.Store, manifestDesc v1.Descriptor) error {
+		desc = manifestDesc
+		return nil
+	})
+	return desc, err
+}
+
+// withLayout resolves reference in the cache layout and calls fn with the
+// layout and the manifest descriptor, under a shared lock. Digest references
+// are resolved by digest alone.
+func withLayout(ctx context.Context, cfg *config.Config, reference string, fn func(*oci.Store, v1.Descriptor) error) error {
+	ref, err := parseOCIReference(cfg, reference)
+	if err != nil {
+		return err
 	}
-	raw := strings.ToLower(strings.TrimPrefix(reference, "oci://"))
+	lookup := ref.Name()
+	if dig, ok := ref.(name.Digest); ok {
+		lookup = dig.DigestStr()
+	}
+	unlock, err := lockCache(cfg.CacheDir, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	ref, err := name.ParseReference(raw, name.WithDefaultRegistry(c.cfg.DefaultRegistry))
+	store, err := OpenLayout(cfg)
 	if err != nil {
-		return "", err
+		return err
+	}
+	manifestDesc, err := store.Resolve(ctx, lookup)
+	if err != nil {
+		return fmt.Errorf("cache miss for %s", reference)
 	}
-	domain := ref.Context().RegistryStr()
-	repo := ref.Context().RepositoryStr()
+	return fn(store, manifestDesc)
+}
 
-	// Attempt to resolve tag or digest symlink under refs
-	tagPath := filepath.Join(c.cfg.CacheDir, domain, repo, "refs", ref.Identifier())
-	if info, err := os.Lstat(tagPath); err == nil {
-		if info.Mode()&os.ModeSymlink != 0 {
-			target, err := readLink(tagPath)
+// RepositoryBlob reports whether the blob with digest dgst belongs to an
+// artifact cached for repository (e.g., ghcr.io/org/repo): it is the
+// manifest tagged with one of the repository's tags or digests, or the
+// config or a layer of such a manifest.
+func RepositoryBlob(ctx context.Context, cfg *config.Config, repository string, dgst digest.Digest) (bool, error) {
+	if _, err := os.Stat(LayoutDir(cfg)); os.IsNotExist(err) {
+		return false, nil
+	}
+	unlock, err := lockCache(cfg.CacheDir, false)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	store, err := OpenLayout(cfg)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	err = store.Tags(ctx, "", func(tags []string) error {
+		for _, tag := range tags {
+			if found || !(strings.HasPrefix(tag, repository+":") || strings.HasPrefix(tag, repository+"@")) {
+				continue
+			}
+			desc, err := store.Resolve(ctx, tag)
 			if err != nil {
-				return "", err
+				continue
+			}
+			found = desc.Digest == dgst
+			if manifest, err := readManifest(ctx, store, desc); err == nil && !found {
+				found = manifest.Config.Digest == dgst
+				for _, layer := range manifest.Layers {
+					found = found || layer.Digest == dgst
+				}
 			}
-			return target, nil
 		}
-		return tagPath, nil
+		return nil
+	})
+	return found, err
+}
+
+// BlobPath returns the path of the blob with digest dgst in the cache
+// layout, which may not exist.
+func BlobPath(cfg *config.Config, dgst digest.Digest) string {
+	return filepath.Join(LayoutDir(cfg), "blobs", dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// Delete removes the tag for reference from the cache layout. The manifest
+// and blobs are kept, as other references may share them.
+func (c *OCIRepository) Delete(ctx context.Context, reference string) error {
+	tag, err := LayoutTag(c.cfg, reference)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockCache(c.cfg.CacheDir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := OpenLayout(c.cfg)
+	if err != nil {
+		return err
+	}
+	if err := store.Untag(ctx, tag); err != nil && !errors.Is(err, errdef.ErrNotFound) {
+		// Digests are not tags; there is nothing to remove for them
+		if errors.Is(err, errdef.ErrInvalidReference) {
+			return nil
+		}
+		return err
 	}
+	return nil
+}
 
-	// If reference is a digest and no symlink, check blob path directly
+// Evict removes the manifest reference resolves to from the cache layout,
+// along with every tag pointing to it, so that neither its tags nor its
+// digest resolve any longer. Its blobs are kept, as other manifests may
+// share them.
+func (c *OCIRepository) Evict(ctx context.Context, reference string) error {
+	ref, err := parseOCIReference(c.cfg, reference)
+	if err != nil {
+		return err
+	}
+	lookup := ref.Name()
 	if dig, ok := ref.(name.Digest); ok {
-		blobPath := filepath.Join(c.cfg.CacheDir, domain, repo, "blobs", dig.DigestStr())
-		if _, err := os.Stat(blobPath); err == nil {
-			return blobPath, nil
+		lookup = dig.DigestStr()
+	}
+	unlock, err := lockCache(c.cfg.CacheDir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := OpenLayout(c.cfg)
+	if err != nil {
+		return err
+	}
+	store.AutoGC = false
+	manifestDesc, err := store.Resolve(ctx, lookup)
+	if errors.Is(err, errdef.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var tags []string
+	if err := store.Tags(ctx, "", func(page []string) error {
+		tags = append(tags, page...)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if desc, err := store.Resolve(ctx, tag); err == nil && desc.Digest == manifestDesc.Digest {
+			if err := store.Untag(ctx, tag); err != nil {
+				return err
+			}
 		}
 	}
+	if err := store.Delete(ctx, manifestDesc); err != nil && !errors.Is(err, errdef.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// parseOCIReference validates and parses an OCI reference using the default registry.
+func parseOCIReference(cfg *config.Config, reference string) (name.Reference, error) {
+	if strings.Contains(reference, "://") && !strings.HasPrefix(reference, "oci://") {
+		return nil, fmt.Errorf("invalid OCI reference: %s", reference)
+	}
+	raw := strings.ToLower(strings.TrimPrefix(reference, "oci://"))
+	return parseRef(raw, name.WithDefaultRegistry(cfg.DefaultRegistry))
+}
 
-	return "", fmt.Errorf("cache miss for %s", reference)
+// firstLayer reads the manifest described by manifestDesc and returns its
+// first layer, which holds the Makefile.
+func firstLayer(ctx context.Context, store content.Fetcher, manifestDesc v1.Descriptor) (v1.Descriptor, error) {
+	manifest, err := readManifest(ctx, store, manifestDesc)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return manifest.Layers[0], nil
+}
+
+// readManifest reads the manifest described by manifestDesc from store,
+// making sure it has at least one layer.
+func readManifest(ctx context.Context, store content.Fetcher, manifestDesc v1.Descriptor) (v1.Manifest, error) {
+	data, err := content.FetchAll(ctx, store, manifestDesc)
+	if err != nil {
+		return v1.Manifest{}, err
+	}
+	var manifest v1.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return v1.Manifest{}, err
+	}
+	if len(manifest.Layers) == 0 {
+		return v1.Manifest{}, fmt.Errorf("no layers found in manifest %s", manifestDesc.Digest)
+	}
+	return manifest, nil
 }
@@ -0,0 +1,144 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+// errNoRef is returned by readRef when a ref does not exist or is unreadable
+// as a pointer file.
+var errNoRef = errors.New("no such ref")
+
+// digestPattern matches the contents of a ref pointer file.
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Refs live in a 'refs' directory next to the 'blobs' directory holding the
+// data they point to. Depending on cfg.CacheRefs a ref is either a symlink to
+// its blob or a pointer file containing the blob digest. Both forms are read
+// in either mode so the setting can be changed at any time, and symlinks met
+// in pointer-file mode are migrated as they are read.
+
+// blobName returns the file name of the blob for digest. Pointer-file mode is
+// meant for Windows, where ':' is not allowed in file names, so the digest
+// algorithm is separated with '-' instead.
+func blobName(cfg *config.Config, digest string) string {
+	if cfg.CacheRefs == config.CacheRefsFile {
+		return strings.Replace(digest, ":", "-", 1)
+	}
+	return digest
+}
+
+// writeRef atomically points link at the blob stored at blobPath for digest.
+func writeRef(cfg *config.Config, blobPath, digest, link string) error {
+	if cfg.CacheRefs != config.CacheRefsFile {
+		return replaceSymlink(blobPath, link)
+	}
+	_, err := writeBlob(filepath.Dir(link), filepath.Base(link), []byte(digest+"\n"))
+	return err
+}
+
+// readRef returns the path of the blob link points to, or errNoRef if there is
+// no usable ref. Symlinks found in pointer-file mode are rewritten as pointer
+// files on a best-effort basis.
+func readRef(cfg *config.Config, link string) (string, error) {
+	info, err := os.Lstat(link)
+	if err != nil {
+		return "", errNoRef
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := readLink(link)
+		if err != nil {
+			return "", err
+		}
+		if cfg.CacheRefs == config.CacheRefsFile {
+			if migrated, err := migrateRef(cfg, link, target); err == nil {
+				return migrated, nil
+			}
+		}
+		return target, nil
+	}
+	if !info.Mode().IsRegular() {
+		return "", errNoRef
+	}
+
+	data, err := os.ReadFile(link)
+	if err != nil {
+		return "", errNoRef
+	}
+	digest := strings.TrimSpace(string(data))
+	if !digestPattern.MatchString(digest) {
+		return "", errNoRef
+	}
+	if blobPath, ok := findBlob(filepath.Join(filepath.Dir(filepath.Dir(link)), "blobs"), digest); ok {
+		return blobPath, nil
+	}
+	return "", errNoRef
+}
+
+// findBlob returns the path of the blob for digest in blobDir, under either
+// of the names blobName may have given it.
+func findBlob(blobDir, digest string) (string, bool) {
+	for _, name := range []string{strings.Replace(digest, ":", "-", 1), digest} {
+		blobPath := filepath.Join(blobDir, name)
+		if _, err := os.Stat(blobPath); err == nil {
+			return blobPath, true
+		}
+	}
+	return "", false
+}
+
+// migrateRef replaces the symlink at link, which points to target, with a
+// pointer file, copying the blob to its pointer-file mode name. The original
+// blob is kept as other symlinks may still point to it.
+func migrateRef(cfg *config.Config, link, target string) (string, error) {
+	digest := filepath.Base(target)
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("cannot migrate ref %s: unexpected target %s", link, target)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", err
+	}
+
+	unlock, err := lockCache(cfg.CacheDir, true)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	blobPath, err := writeBlob(filepath.Dir(target), blobName(cfg, digest), data)
+	if err != nil {
+		return "", err
+	}
+	if err := writeRef(cfg, blobPath, digest, link); err != nil {
+		return "", err
+	}
+	return blobPath, nil
+}
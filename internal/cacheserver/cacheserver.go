@@ -0,0 +1,292 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+// Package cacheserver serves a Remake cache over HTTP so that a team or CI
+// fleet can share one warm cache.
+package cacheserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cache"
+	"github.com/TrianaLab/remake/internal/client"
+	"github.com/TrianaLab/remake/internal/redact"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PullPath is the endpoint serving HTTP(S) and git artifacts, as
+// GET PullPath?ref=<reference>.
+const PullPath = "/pull"
+
+// MirrorPath is the prefix of the read-only subset of the OCI distribution
+// API serving OCI artifacts, as GET MirrorPath<repository>/manifests/<tag>
+// or <digest> and GET MirrorPath<repository>/blobs/<digest>. Repositories
+// are named by client.MirrorRepository.
+const MirrorPath = "/v2/"
+
+// Puller resolves a reference to a local file holding the artifact, fetching
+// it if needed.
+type Puller interface {
+	Pull(ctx context.Context, reference string) (string, error)
+}
+
+// PullFunc adapts an ordinary function, such as one wrapping store.Store's
+// Pull, to a Puller.
+type PullFunc func(ctx context.Context, reference string) (string, error)
+
+// Pull calls f(ctx, reference).
+func (f PullFunc) Pull(ctx context.Context, reference string) (string, error) {
+	return f(ctx, reference)
+}
+
+// NewHandler returns an http.Handler serving the artifacts of s. Each request
+// is answered with s.Pull, so artifacts already in the server's cache are
+// served from disk and others are fetched from their upstream registry and
+// cached on the way (read-through).
+//
+// OCI artifacts are served under MirrorPath with their manifests and blobs
+// as stored in the cache layout of cfg, unchanged, so they keep their
+// registry digest; a blob is only served for a repository one of whose
+// cached manifests refers to it. HTTP(S) and git artifacts are served under
+// PullPath, only for http(s) URLs. Either way, only the registries and hosts
+// listed in cfg.ServeCacheHosts are served, and artifacts are fetched
+// without the server's credentials (see client.WithoutCredentials). Local
+// paths, file:// URLs and OCI layouts on the server are never exposed.
+func NewHandler(cfg *config.Config, s Puller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PullPath, func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			http.Error(w, "missing ref parameter", http.StatusBadRequest)
+			return
+		}
+		if err := checkReference(ref, cfg.ServeCacheHosts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		path, err := s.Pull(client.WithoutCredentials(r.Context()), ref)
+		if err != nil {
+			cfg.Log().Warn("pull failed", "reference", redact.Reference(ref), "client", r.RemoteAddr, "error", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		cfg.Log().Info("serving artifact", "reference", redact.Reference(ref), "client", r.RemoteAddr, "path", path)
+		serveFile(w, r, path, "application/octet-stream", "")
+	})
+	mux.HandleFunc("GET "+MirrorPath, func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, MirrorPath)
+		if rest == "" {
+			// API version check
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if i := strings.LastIndex(rest, "/manifests/"); i > 0 {
+			serveManifest(cfg, s, w, r, rest[:i], rest[i+len("/manifests/"):])
+			return
+		}
+		if i := strings.LastIndex(rest, "/blobs/"); i > 0 {
+			serveBlob(cfg, w, r, rest[:i], rest[i+len("/blobs/"):])
+			return
+		}
+		http.NotFound(w, r)
+	})
+	return mux
+}
+
+// serveManifest pulls the OCI artifact named by the mirrored repository and
+// the tag or digest id into the cache, and serves its manifest.
+func serveManifest(cfg *config.Config, s Puller, w http.ResponseWriter, r *http.Request, repository, id string) {
+	repo, err := mirroredRepository(cfg, repository)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	sep := ":"
+	if strings.Contains(id, ":") {
+		sep = "@"
+	}
+	ref, err := name.ParseReference(repo.Name()+sep+id, name.StrictValidation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// oci:// keeps the server from looking for a local file by that name
+	reference := "oci://" + ref.Name()
+	if _, err := s.Pull(client.WithoutCredentials(r.Context()), reference); err != nil {
+		// Not found rather than a server error, which registry clients
+		// would retry before falling back to the upstream registry
+		cfg.Log().Warn("pull failed", "reference", ref.Name(), "client", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	desc, err := cache.ResolveLayout(r.Context(), cfg, reference)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// Digests resolve across repositories in the cache, but are only
+	// served for the repository they were pulled from
+	if ok, err := cache.RepositoryBlob(r.Context(), cfg, repo.Name(), desc.Digest); err != nil || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	cfg.Log().Info("serving artifact", "reference", ref.Name(), "client", r.RemoteAddr, "digest", desc.Digest)
+	serveFile(w, r, cache.BlobPath(cfg, desc.Digest), desc.MediaType, desc.Digest)
+}
+
+// serveBlob serves the blob with digest id of the mirrored repository, if
+// a manifest cached for that repository refers to it.
+func serveBlob(cfg *config.Config, w http.ResponseWriter, r *http.Request, repository, id string) {
+	repo, err := mirroredRepository(cfg, repository)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	dgst, err := digest.Parse(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ok, err := cache.RepositoryBlob(r.Context(), cfg, repo.Name(), dgst)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	serveFile(w, r, cache.BlobPath(cfg, dgst), "application/octet-stream", dgst)
+}
+
+// errHostNotAllowed is returned for registries and hosts missing from
+// serveCacheHosts.
+var errHostNotAllowed = errors.New("not allowed: add it to serveCacheHosts on the cache server")
+
+// mirroredRepository parses a repository named by client.MirrorRepository
+// and checks that its registry is in cfg.ServeCacheHosts.
+func mirroredRepository(cfg *config.Config, mirrored string) (name.Repository, error) {
+	registry, repository, err := client.ParseMirrorRepository(mirrored)
+	if err != nil {
+		return name.Repository{}, err
+	}
+	repo, err := name.NewRepository(registry+"/"+repository, name.StrictValidation)
+	if err != nil {
+		return name.Repository{}, err
+	}
+	if err := checkHost(repo.RegistryStr(), cfg.ServeCacheHosts); err != nil {
+		return name.Repository{}, err
+	}
+	return repo, nil
+}
+
+// statusOf returns the HTTP status of an error checking a request: 403 for
+// hosts that are not allowed and 400 otherwise.
+func statusOf(err error) int {
+	if errors.Is(err, errHostNotAllowed) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// serveFile writes the file at path with the given media type and, when set,
+// its digest in the Docker-Content-Digest header registry clients check.
+func serveFile(w http.ResponseWriter, r *http.Request, path, mediaType string, dgst digest.Digest) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	w.Header().Set("Content-Type", mediaType)
+	if dgst != "" {
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, f)
+}
+
+// checkReference returns an error unless reference is an HTTP(S) or git
+// reference whose http(s) URL is on one of hosts. It never looks at the
+// local filesystem.
+func checkReference(reference string, hosts []string) error {
+	target := reference
+	switch {
+	case strings.HasPrefix(reference, "git+"):
+		ref, err := config.ParseGitReference(reference)
+		if err != nil {
+			return err
+		}
+		target = ref.Repository
+	case strings.HasPrefix(reference, "http://"), strings.HasPrefix(reference, "https://"):
+	default:
+		return fmt.Errorf("unsupported reference %s: only HTTP(S) and git references are served here, and OCI artifacts under %s", reference, MirrorPath)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("unsupported reference %s: only http(s) URLs are served", reference)
+	}
+	return checkHost(u.Host, hosts)
+}
+
+// checkHost returns an error unless host, with its port if it has one, is
+// on hosts. Host names are compared case-insensitively.
+func checkHost(host string, hosts []string) error {
+	for _, allowed := range hosts {
+		if strings.EqualFold(allowed, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s is %w", host, errHostNotAllowed)
+}
+
+// Fetch streams reference from the cache server configured in
+// cfg.CacheServer. OCI artifacts are pulled through the server's registry
+// API (see client.NewMirrorClient), and others from PullPath. Credentials
+// configured for the server host are applied as for any pull.
+func Fetch(ctx context.Context, cfg *config.Config, reference string) (v1.Descriptor, io.ReadCloser, error) {
+	if cfg.ParseReference(reference) == config.ReferenceOCI {
+		return client.NewMirrorClient(cfg, cfg.CacheServer).Pull(ctx, reference)
+	}
+	endpoint := strings.TrimSuffix(cfg.CacheServer, "/") + PullPath + "?ref=" + url.QueryEscape(reference)
+	return client.NewClient(cfg, endpoint).Pull(ctx, endpoint)
+}
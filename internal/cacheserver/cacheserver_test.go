@@ -0,0 +1,208 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package cacheserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cache"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakePuller serves files from a map of reference to path.
+type fakePuller struct {
+	paths map[string]string
+	calls []string
+}
+
+func (f *fakePuller) Pull(ctx context.Context, reference string) (string, error) {
+	f.calls = append(f.calls, reference)
+	if path, ok := f.paths[reference]; ok {
+		return path, nil
+	}
+	return "", errors.New("not found upstream")
+}
+
+func TestHandlerAndFetchOCI(t *testing.T) {
+	ctx := context.Background()
+	serverCfg := &config.Config{CacheDir: t.TempDir(), ServeCacheHosts: []string{"reg.io"}}
+	ref := "reg.io/org/make:v1"
+	if err := cache.NewOCIRepository(serverCfg).Push(ctx, ref, v1.Descriptor{}, strings.NewReader("all:\n\techo ok\n")); err != nil {
+		t.Fatal(err)
+	}
+	want, err := cache.ResolveLayout(ctx, serverCfg, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	puller := &fakePuller{paths: map[string]string{"oci://" + ref: "", "oci://reg.io/org/make@" + want.Digest.String(): ""}}
+	srv := httptest.NewServer(NewHandler(serverCfg, puller))
+	defer srv.Close()
+
+	cfg := &config.Config{CacheDir: t.TempDir(), CacheServer: srv.URL}
+	_, rc, err := Fetch(ctx, cfg, ref)
+	if err != nil {
+		t.Fatalf("Fetch error: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil || string(data) != "all:\n\techo ok\n" {
+		t.Errorf("unexpected data %q: %v", data, err)
+	}
+	got, err := cache.ResolveLayout(ctx, cfg, ref)
+	if err != nil {
+		t.Fatalf("expected the artifact in the client cache: %v", err)
+	}
+	if got.Digest != want.Digest {
+		t.Errorf("expected the manifest to keep digest %s, got %s", want.Digest, got.Digest)
+	}
+	if len(puller.calls) == 0 || puller.calls[0] != "oci://"+ref {
+		t.Errorf("expected the qualified reference to reach the store, got %v", puller.calls)
+	}
+
+	if _, _, err := Fetch(ctx, cfg, "reg.io/org/missing:v1"); err == nil {
+		t.Error("expected error for artifact missing upstream")
+	}
+
+	// Blobs and digests are only served for the repository they belong to
+	other := "reg.io/org/other:v1"
+	if err := cache.NewOCIRepository(serverCfg).Push(ctx, other, v1.Descriptor{}, strings.NewReader("all:\n\techo other\n")); err != nil {
+		t.Fatal(err)
+	}
+	puller.paths["oci://reg.io/org/other@"+want.Digest.String()] = ""
+	data, err = os.ReadFile(cache.BlobPath(serverCfg, want.Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest v1.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil || len(manifest.Layers) != 1 {
+		t.Fatalf("unexpected manifest %s: %v", data, err)
+	}
+	layer := manifest.Layers[0].Digest.String()
+	for path, status := range map[string]int{
+		"/v2/reg.io/org/make/blobs/" + layer:                     http.StatusOK,
+		"/v2/reg.io/org/make/manifests/" + want.Digest.String():  http.StatusOK,
+		"/v2/reg.io/org/other/blobs/" + layer:                    http.StatusNotFound,
+		"/v2/reg.io/org/other/manifests/" + want.Digest.String(): http.StatusNotFound,
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("GET %s: expected %d, got %d", path, status, resp.StatusCode)
+		}
+	}
+
+	// Only registries listed in serveCacheHosts are mirrored
+	serverCfg.ServeCacheHosts = nil
+	if _, _, err := Fetch(ctx, &config.Config{CacheDir: t.TempDir(), CacheServer: srv.URL}, ref); err == nil {
+		t.Error("expected registries missing from serveCacheHosts to be refused")
+	}
+}
+
+func TestHandlerAndFetchHTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "makefile")
+	if err := os.WriteFile(path, []byte("all:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref := "https://files.example.com/make.mk?x#y"
+	puller := &fakePuller{paths: map[string]string{ref: path}}
+	srv := httptest.NewServer(NewHandler(&config.Config{ServeCacheHosts: []string{"FILES.example.com"}}, puller))
+	defer srv.Close()
+
+	desc, rc, err := Fetch(context.Background(), &config.Config{CacheServer: srv.URL + "/"}, ref)
+	if err != nil {
+		t.Fatalf("Fetch error: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(data) != "all:\n" || desc.Size != int64(len(data)) {
+		t.Errorf("unexpected data %q (size %d)", data, desc.Size)
+	}
+	if len(puller.calls) != 1 || puller.calls[0] != ref {
+		t.Errorf("expected reference to reach the store unchanged, got %v", puller.calls)
+	}
+}
+
+func TestHandlerRejectsRequests(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(local, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	puller := &fakePuller{paths: map[string]string{local: local}}
+	cfg := &config.Config{CacheDir: t.TempDir(), ServeCacheHosts: []string{"files.example.com", "git.example.com", "reg.io"}}
+	srv := httptest.NewServer(NewHandler(cfg, puller))
+	defer srv.Close()
+
+	pull := func(ref string) string { return PullPath + "?ref=" + url.QueryEscape(ref) }
+	cases := map[string]int{
+		PullPath:                   http.StatusBadRequest,
+		pull(local):                http.StatusBadRequest,
+		pull("oci-layout:///x"):    http.StatusBadRequest,
+		pull("reg.io/org/make:v1"): http.StatusBadRequest,
+		pull("git+file:///srv/repo.git//Makefile"):                http.StatusBadRequest,
+		pull("git+ssh://git.example.com/repo.git//Makefile"):      http.StatusBadRequest,
+		pull("http://169.254.169.254/latest/meta-data"):           http.StatusBadRequest,
+		pull("https://files.example.com@169.254.169.254/x"):       http.StatusBadRequest,
+		pull("https://files.example.com:8443/make.mk"):            http.StatusBadRequest,
+		pull("https://files.example.com/missing.mk"):              http.StatusBadGateway,
+		pull("git+https://git.example.com/repo.git//Makefile@v1"): http.StatusBadGateway,
+		"/v2/":                               http.StatusOK,
+		"/v2/reg.io/org/make/manifests/v1":   http.StatusNotFound,
+		"/v2/other.io/org/make/manifests/v1": http.StatusForbidden,
+		"/v2/other.io/org/make/blobs/sha256:" + strings.Repeat("0", 64): http.StatusForbidden,
+		"/v2/reg.io/ORG/make/manifests/v1":                              http.StatusBadRequest,
+		"/v2/make/manifests/v1":                                         http.StatusBadRequest,
+		"/v2/reg.io/org/make/blobs/md5:abc":                             http.StatusBadRequest,
+		"/v2/reg.io/org/make/blobs/sha256:" + strings.Repeat("0", 64):   http.StatusNotFound,
+		"/v2/reg.io/org/make/tags/list":                                 http.StatusNotFound,
+		"/other":                                                        http.StatusNotFound,
+	}
+	for path, want := range cases {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+	for _, call := range puller.calls {
+		if call == local || strings.Contains(call, "file://") || strings.Contains(call, "169.254") {
+			t.Errorf("%s must never be pulled", call)
+		}
+	}
+}
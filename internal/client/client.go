@@ -23,35 +23,102 @@ package client
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"github.com/TrianaLab/remake/config"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // Client defines the interface for interacting with remote artifact
-// registries over HTTP or OCI protocols. It supports login, push, and pull operations.
+// registries over HTTP or OCI protocols. It supports login, push, pull, copy
+// and delete operations.
 type Client interface {
 	// Login authenticates against the given registry endpoint using username and password.
 	Login(ctx context.Context, registry, user, pass string) error
 
 	// Push uploads the local file at path to the specified reference
-	// (e.g., registry/repo:tag) in the remote registry.
-	Push(ctx context.Context, reference, path string) error
+	// (e.g., registry/repo:tag) in the remote registry and returns the
+	// descriptor of what was pushed: the artifact manifest for OCI
+	// references, or the file itself for HTTP(S) references.
+	Push(ctx context.Context, reference, path string) (v1.Descriptor, error)
 
 	// Pull downloads the artifact identified by reference from the registry
-	// and returns its raw data bytes.
-	Pull(ctx context.Context, reference string) ([]byte, error)
+	// and returns a descriptor of the Makefile along with a reader for its
+	// contents, which the caller must close. The descriptor carries the
+	// digest and size of the data when they are known up front and, for HTTP
+	// references, the response validators as annotations.
+	Pull(ctx context.Context, reference string) (v1.Descriptor, io.ReadCloser, error)
+
+	// Copy transfers the artifact at src to dst without downloading it
+	// locally, preserving its digest, annotations and referrers.
+	Copy(ctx context.Context, src, dst string) error
+
+	// Delete removes the manifest identified by reference from the registry,
+	// which also drops every tag pointing to it.
+	Delete(ctx context.Context, reference string) error
+
+	// Untag removes only the tag in reference, leaving the manifest and any
+	// other tags pointing to it in place.
+	Untag(ctx context.Context, reference string) error
 }
 
 // NewClient constructs a Client implementation based on the reference type.
-// HTTP(S) references use an HTTP client; OCI references use an OCI client.
-// Default fallback is OCI client for any non-HTTP references.
+// HTTP(S) references use an HTTP client; git references use a git client;
+// OCI layout references use a layout client; OCI references use an OCI
+// client. Default fallback is OCI client for any other references.
 func NewClient(cfg *config.Config, reference string) Client {
 	switch cfg.ParseReference(reference) {
 	case config.ReferenceHTTP:
-		return NewHTTPClient()
+		h := NewHTTPClient()
+		h.httpClient = httpClient(cfg, h.httpClient)
+		return h
+	case config.ReferenceGit:
+		return NewGitClient()
+	case config.ReferenceOCILayout:
+		return NewLayoutClient(cfg)
 	case config.ReferenceOCI:
 		return NewOCIClient(cfg)
 	default:
 		return NewOCIClient(cfg)
 	}
 }
+
+// noCredentialsKey is the context key set by WithoutCredentials.
+type noCredentialsKey struct{}
+
+// WithoutCredentials returns ctx marked so that HTTP(S) and git pulls made
+// with it use no stored credentials: neither those configured for the host,
+// netrc entries nor git credential helpers. HTTP redirects to another host
+// are refused too. The cache server pulls references chosen by its clients
+// this way, so that they cannot borrow the server's credentials.
+func WithoutCredentials(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCredentialsKey{}, true)
+}
+
+// withoutCredentials reports whether ctx was marked by WithoutCredentials.
+func withoutCredentials(ctx context.Context) bool {
+	anonymous, _ := ctx.Value(noCredentialsKey{}).(bool)
+	return anonymous
+}
+
+// ErrNotModified is returned by pulls made conditional with WithValidators
+// when the server reports that the artifact has not changed.
+var ErrNotModified = errors.New("not modified")
+
+// validatorsKey is the context key set by WithValidators.
+type validatorsKey struct{}
+
+// WithValidators returns ctx carrying the validators recorded for a cached
+// version of an artifact, as cache.AnnotationETag and
+// cache.AnnotationLastModified annotations. HTTP(S) pulls made with it are
+// conditional, and return ErrNotModified when that version is still current.
+func WithValidators(ctx context.Context, annotations map[string]string) context.Context {
+	return context.WithValue(ctx, validatorsKey{}, annotations)
+}
+
+// validators returns the annotations ctx carries from WithValidators.
+func validators(ctx context.Context) map[string]string {
+	annotations, _ := ctx.Value(validatorsKey{}).(map[string]string)
+	return annotations
+}
@@ -23,18 +23,27 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/opencontainers/go-digest"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -44,9 +53,13 @@ import (
 	"oras.land/oras-go/v2/content/file"
 	"oras.land/oras-go/v2/content/memory"
 	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
 	"oras.land/oras-go/v2/registry/remote/retry"
 
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cache"
+	"github.com/TrianaLab/remake/internal/makefile"
+	"github.com/TrianaLab/remake/internal/progress"
 )
 
 type badBody struct{}
@@ -100,18 +113,65 @@ func TestHTTPClientPullSuccess(t *testing.T) {
 	defer server.Close()
 
 	client := NewHTTPClient()
-	data, err := client.Pull(context.Background(), server.URL)
+	_, rc, err := client.Pull(context.Background(), server.URL)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if string(data) != "ok" {
+	if data := readAndClose(t, rc); data != "ok" {
 		t.Errorf("unexpected data: %s", data)
 	}
 }
 
+// readAndClose reads rc to the end and closes it, failing the test on error.
+func readAndClose(t *testing.T, rc io.ReadCloser) string {
+	t.Helper()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading pulled data: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("closing pulled data: %v", err)
+	}
+	return string(data)
+}
+
+func TestHTTPClientPullDescriptor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	desc, rc, err := client.Pull(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = readAndClose(t, rc)
+	if desc.Digest != "" || desc.Size != 2 {
+		t.Errorf("unexpected descriptor %+v", desc)
+	}
+	if desc.Annotations[cache.AnnotationETag] != `"v1"` || desc.Annotations[cache.AnnotationLastModified] == "" {
+		t.Errorf("expected validators in annotations, got %v", desc.Annotations)
+	}
+
+	// A pinned digest is set on the descriptor so that the cache verifies it
+	sum := sha256.Sum256([]byte("ok"))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	desc, rc, err = client.Pull(context.Background(), server.URL+"#"+digest)
+	if err != nil {
+		t.Fatalf("unexpected error for pinned reference: %v", err)
+	}
+	_ = readAndClose(t, rc)
+	if desc.Digest.String() != digest {
+		t.Errorf("expected pinned digest %s, got %s", digest, desc.Digest)
+	}
+}
+
 func TestHTTPClientPullError(t *testing.T) {
 	client := NewHTTPClient()
-	_, err := client.Pull(context.Background(), "http://invalid.invalid")
+	_, _, err := client.Pull(context.Background(), "http://invalid.invalid")
 	if err == nil {
 		t.Error("expected error")
 	}
@@ -120,7 +180,7 @@ func TestHTTPClientPullError(t *testing.T) {
 func TestOCIClientPullBadRef(t *testing.T) {
 	cfg := &config.Config{}
 	client := NewOCIClient(cfg)
-	_, err := client.Pull(context.Background(), "not-a-ref")
+	_, _, err := client.Pull(context.Background(), "not-a-ref")
 	if err == nil {
 		t.Error("expected parse error")
 	}
@@ -148,25 +208,109 @@ func TestNewClientLocalReferenceDefault(t *testing.T) {
 	}
 }
 
-func TestHTTPClientLoginNoop(t *testing.T) {
+func TestHTTPClientLoginStoresCredentials(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(t.TempDir() + "/config.yaml")
+
 	h := NewHTTPClient()
-	err := h.Login(context.Background(), "any", "user", "pass")
-	if err != nil {
-		t.Errorf("expected nil error, got %v", err)
+	if err := h.Login(context.Background(), "https://files.example.com/repo", "user", "pass"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := viper.GetString("registries.files_example_com.username"); got != "user" {
+		t.Errorf("expected stored username, got %q", got)
+	}
+	if err := h.Login(context.Background(), "", "user", "pass"); err == nil {
+		t.Error("expected error for empty endpoint")
 	}
 }
 
-func TestHTTPClientPushNoop(t *testing.T) {
+func TestHTTPClientPushPut(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	var gotMethod, gotAuth, gotSum string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAuth = r.Header.Get("Authorization")
+		gotSum = r.Header.Get("X-Checksum-Sha256")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	path := t.TempDir() + "/makefile"
+	_ = os.WriteFile(path, []byte("all:\n"), 0o644)
+
+	u, _ := url.Parse(server.URL)
+	key := "registries." + config.NormalizeKey(u.Host)
+	viper.Set(key+".username", "user")
+	viper.Set(key+".password", "pass")
+	viper.Set(key+".checksums", true)
+
 	h := NewHTTPClient()
-	err := h.Push(context.Background(), "http://example.com", "path")
+	desc, err := h.Push(context.Background(), server.URL+"/generic/make.mk", path)
 	if err != nil {
-		t.Errorf("expected nil error, got %v", err)
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotMethod != http.MethodPut {
+		t.Errorf("expected PUT, got %s", gotMethod)
+	}
+	if !strings.HasPrefix(gotAuth, "Basic ") {
+		t.Errorf("expected basic auth, got %q", gotAuth)
+	}
+	if string(gotBody) != "all:\n" {
+		t.Errorf("unexpected body %q", gotBody)
+	}
+	sum := sha256.Sum256([]byte("all:\n"))
+	if gotSum != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected sha256 checksum header, got %q", gotSum)
+	}
+	if desc.Digest.Encoded() != gotSum || desc.Size != 5 {
+		t.Errorf("expected the file descriptor, got %+v", desc)
+	}
+
+	viper.Set(key+".token", "secret")
+	if _, err := h.Push(context.Background(), server.URL+"/generic/make.mk", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("expected bearer auth, got %q", gotAuth)
+	}
+}
+
+func TestHTTPClientPushErrors(t *testing.T) {
+	viper.Reset()
+	h := NewHTTPClient()
+	if _, err := h.Push(context.Background(), "http://example.com", "missing-file"); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	path := t.TempDir() + "/makefile"
+	_ = os.WriteFile(path, []byte("all:\n"), 0o644)
+	if _, err := h.Push(context.Background(), "%ht!tp://bad-url", path); err == nil {
+		t.Error("expected error for bad URL")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	_, err := h.Push(context.Background(), server.URL, path)
+	if err == nil || !strings.Contains(err.Error(), strconv.Itoa(http.StatusForbidden)) {
+		t.Errorf("expected status code error, got %v", err)
+	}
+
+	h.httpClient = &http.Client{Transport: &transportCloseError{}}
+	if _, err := h.Push(context.Background(), "http://any", path); err == nil || err.Error() != "close error" {
+		t.Errorf("expected close error, got %v", err)
 	}
 }
 
 func TestHTTPClientPullBadURL(t *testing.T) {
 	h := NewHTTPClient()
-	_, err := h.Pull(context.Background(), "%ht!tp://bad-url")
+	_, _, err := h.Pull(context.Background(), "%ht!tp://bad-url")
 	if err == nil {
 		t.Error("expected error for bad URL, got nil")
 	}
@@ -179,7 +323,7 @@ func TestHTTPClientPullNonOK(t *testing.T) {
 	defer server.Close()
 
 	h := NewHTTPClient()
-	_, err := h.Pull(context.Background(), server.URL)
+	_, _, err := h.Pull(context.Background(), server.URL)
 	if err == nil || !strings.Contains(err.Error(), strconv.Itoa(http.StatusNotFound)) {
 		t.Errorf("expected non-200 status code error, got %v", err)
 	}
@@ -189,9 +333,13 @@ func TestHTTPClientPullReadBodyError(t *testing.T) {
 	h := NewHTTPClient()
 	h.httpClient = &http.Client{Transport: &badTransport{}}
 
-	_, err := h.Pull(context.Background(), "http://any")
-	if err == nil || !strings.Contains(err.Error(), "failed to read HTTP response body") {
-		t.Errorf("expected read body error, got %v", err)
+	_, rc, err := h.Pull(context.Background(), "http://any")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = rc.Close() }()
+	if _, err := io.ReadAll(rc); err == nil {
+		t.Error("expected read body error, got nil")
 	}
 }
 
@@ -199,11 +347,14 @@ func TestHTTPClientPullCloseError(t *testing.T) {
 	h := NewHTTPClient()
 	h.httpClient = &http.Client{Transport: &transportCloseError{}}
 
-	data, err := h.Pull(context.Background(), "http://any")
-	if data == nil {
-		t.Fatalf("expected data slice, got nil")
+	_, rc, err := h.Pull(context.Background(), "http://any")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatalf("unexpected read error: %v", err)
 	}
-	if err == nil || err.Error() != "close error" {
+	if err := rc.Close(); err == nil || err.Error() != "close error" {
 		t.Errorf("expected close error, got %v", err)
 	}
 }
@@ -283,7 +434,7 @@ func TestOCIClientLoginPingError(t *testing.T) {
 func TestOCIClientPushInvalidScheme(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
-	err := client.Push(context.Background(), "http://example.com/repo:tag", "path")
+	_, err := client.Push(context.Background(), "http://example.com/repo:tag", "path")
 	if err == nil || !strings.Contains(err.Error(), "invalid OCI reference") {
 		t.Errorf("expected invalid OCI reference error, got %v", err)
 	}
@@ -292,7 +443,7 @@ func TestOCIClientPushInvalidScheme(t *testing.T) {
 func TestOCIClientPushParseError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
-	err := client.Push(context.Background(), "oci://not$$invalid/ref", "path")
+	_, err := client.Push(context.Background(), "oci://not$$invalid/ref", "path")
 	if err == nil {
 		t.Error("expected parse error, got nil")
 	}
@@ -301,7 +452,7 @@ func TestOCIClientPushParseError(t *testing.T) {
 func TestOCIClientPushMissingFile(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
-	err := client.Push(context.Background(), "oci://example.com/myrepo:latest", "nofile")
+	_, err := client.Push(context.Background(), "oci://example.com/myrepo:latest", "nofile")
 	if err == nil || !strings.Contains(err.Error(), "adding file to store") {
 		t.Errorf("expected file add error, got %v", err)
 	}
@@ -312,7 +463,7 @@ func TestPushNewRepositoryError(t *testing.T) {
 	defer func() { newRepository = orig }()
 	newRepository = func(ref string) (*remote.Repository, error) { return nil, fmt.Errorf("repo error") }
 	client := NewOCIClient(&config.Config{DefaultRegistry: "example.com"})
-	err := client.Push(context.Background(), "oci://example.com/repo:tag", "file.txt")
+	_, err := client.Push(context.Background(), "oci://example.com/repo:tag", "file.txt")
 	if err == nil || !strings.Contains(err.Error(), "repo error") {
 		t.Errorf("expected repo error, got %v", err)
 	}
@@ -405,6 +556,30 @@ func (r *mockReadCloser) Close() error {
 	return nil
 }
 
+func TestOCIClientRepositoryWithoutCredentials(t *testing.T) {
+	viper.Reset()
+	viper.Set("registries.example_com.username", "testuser")
+	viper.Set("registries.example_com.password", "testpass")
+	defer viper.Reset()
+	ctx := context.Background()
+	client := NewOCIClient(&config.Config{}).(*OCIClient)
+
+	repo, _, err := client.repository(ctx, "example.com/repo:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.Client.(*auth.Client).Credential == nil {
+		t.Error("expected the stored credentials to be used")
+	}
+	repo, _, err = client.repository(WithoutCredentials(ctx), "example.com/repo:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.Client.(*auth.Client).Credential != nil {
+		t.Error("expected no credentials for an anonymous pull")
+	}
+}
+
 func TestOCIClientPushWithCredentials(t *testing.T) {
 	// Set up viper with credentials
 	viper.Set("registries.example_com.username", "testuser")
@@ -463,7 +638,7 @@ func TestOCIClientPushWithCredentials(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
+	_, err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -484,7 +659,7 @@ func TestOCIClientPushFileStoreError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err := client.Push(context.Background(), "oci://example.com/repo:tag", "/some/path")
+	_, err := client.Push(context.Background(), "oci://example.com/repo:tag", "/some/path")
 	if err == nil || !strings.Contains(err.Error(), "file store error") {
 		t.Errorf("expected file store error, got %v", err)
 	}
@@ -530,7 +705,7 @@ func TestOCIClientPushFileStoreCloseError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
+	_, err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
 	// The error assertion may need to be adjusted based on actual behavior
 	if err != nil {
 		t.Logf("Got error (may or may not be close error): %v", err)
@@ -549,7 +724,7 @@ func TestOCIClientPushAbsPathError(t *testing.T) {
 	client := NewOCIClient(cfg)
 
 	// Call Push: path value doesn't matter, stub will error first
-	err := client.Push(context.Background(), "oci://example.com/repo:tag", "somepath")
+	_, err := client.Push(context.Background(), "oci://example.com/repo:tag", "somepath")
 	if err == nil || !strings.Contains(err.Error(), "failed to resolve absolute path somepath: abs error") {
 		t.Errorf("expected abs path error, got %v", err)
 	}
@@ -579,7 +754,7 @@ func TestOCIClientPushPackManifestError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
+	_, err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
 	if err == nil || !strings.Contains(err.Error(), "packing manifest") {
 		t.Errorf("expected packing manifest error, got %v", err)
 	}
@@ -613,7 +788,7 @@ func TestOCIClientPushEmptyDigestError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
+	_, err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
 	if err == nil || !strings.Contains(err.Error(), "invalid manifest descriptor: empty digest") {
 		t.Errorf("expected empty digest error, got %v", err)
 	}
@@ -647,7 +822,7 @@ func TestOCIClientPushTaggingError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
+	_, err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
 	if err != nil {
 		t.Logf("Got error (may or may not be tag error): %v", err)
 	}
@@ -687,7 +862,7 @@ func TestOCIClientPushCopyError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
+	_, err = client.Push(context.Background(), "oci://example.com/repo:tag", tmpFile.Name())
 	if err == nil || !strings.Contains(err.Error(), "pushing to remote") {
 		t.Errorf("expected pushing to remote error, got %v", err)
 	}
@@ -697,7 +872,7 @@ func TestOCIClientPullInvalidOCIReference(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	_, err := client.Pull(context.Background(), "http://example.com/repo:tag")
+	_, _, err := client.Pull(context.Background(), "http://example.com/repo:tag")
 	if err == nil || !strings.Contains(err.Error(), "invalid OCI reference") {
 		t.Errorf("expected invalid OCI reference error, got %v", err)
 	}
@@ -707,7 +882,7 @@ func TestOCIClientPullParseReferenceError(t *testing.T) {
 	cfg := &config.Config{DefaultRegistry: "example.com"}
 	client := NewOCIClient(cfg)
 
-	_, err := client.Pull(context.Background(), "oci://not$$valid/ref")
+	_, _, err := client.Pull(context.Background(), "oci://not$$valid/ref")
 	if err == nil {
 		t.Error("expected parse reference error, got nil")
 	}
@@ -768,7 +943,7 @@ func TestOCIClientPullWithCredentialsAndErrors(t *testing.T) {
 		cfg := &config.Config{DefaultRegistry: "example.com"}
 		client := NewOCIClient(cfg)
 
-		_, err := client.Pull(context.Background(), "oci://example.com/repo:tag")
+		_, _, err := client.Pull(context.Background(), "oci://example.com/repo:tag")
 		if err == nil || !strings.Contains(err.Error(), "copy error") {
 			t.Errorf("expected copy error, got %v", err)
 		}
@@ -882,7 +1057,7 @@ func TestOCIClient_Pull_ContentFetchAllManifestError(t *testing.T) {
 	defer func() { copyFunc = originalCopyFunc }()
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.Nil(t, data)
@@ -922,7 +1097,7 @@ func TestOCIClient_Pull_JSONUnmarshalError(t *testing.T) {
 	defer func() { copyFunc = originalCopyFunc }()
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.Nil(t, data)
@@ -966,7 +1141,7 @@ func TestOCIClient_Pull_NoLayersError(t *testing.T) {
 	defer func() { copyFunc = originalCopyFunc }()
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.Nil(t, data)
@@ -985,18 +1160,15 @@ func TestOCIClient_Pull_LayerFetchError(t *testing.T) {
 	manifestWithLayers := createManifestWithLayers()
 	manifestBytes, _ := json.Marshal(manifestWithLayers)
 
-	// Mock contentFetcher to return manifest on first call, error on second call
-	originalFetcher := contentFetcher
-	callCount := 0
+	// Mock contentFetcher to return the manifest and blobFetcher to fail on the layer
+	originalFetcher, originalBlobFetcher := contentFetcher, blobFetcher
 	contentFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) ([]byte, error) {
-		callCount++
-		if callCount == 1 {
-			return manifestBytes, nil
-		}
-		// Second call is for layer data - return error
+		return manifestBytes, nil
+	}
+	blobFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) (io.ReadCloser, error) {
 		return nil, errors.New("fetch layer error")
 	}
-	defer func() { contentFetcher = originalFetcher }()
+	defer func() { contentFetcher, blobFetcher = originalFetcher, originalBlobFetcher }()
 
 	// Mock other dependencies
 	originalNewRepository := newRepository
@@ -1012,7 +1184,7 @@ func TestOCIClient_Pull_LayerFetchError(t *testing.T) {
 	defer func() { copyFunc = originalCopyFunc }()
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.Nil(t, data)
@@ -1032,18 +1204,15 @@ func TestOCIClient_Pull_Success(t *testing.T) {
 
 	expectedLayerData := []byte("layer data content")
 
-	// Mock contentFetcher to return manifest on first call, layer data on second call
-	originalFetcher := contentFetcher
-	callCount := 0
+	// Mock contentFetcher to return the manifest and blobFetcher the layer data
+	originalFetcher, originalBlobFetcher := contentFetcher, blobFetcher
 	contentFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) ([]byte, error) {
-		callCount++
-		if callCount == 1 {
-			return manifestBytes, nil
-		}
-		// Second call is for layer data
-		return expectedLayerData, nil
+		return manifestBytes, nil
 	}
-	defer func() { contentFetcher = originalFetcher }()
+	blobFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(expectedLayerData)), nil
+	}
+	defer func() { contentFetcher, blobFetcher = originalFetcher, originalBlobFetcher }()
 
 	// Mock other dependencies
 	originalNewRepository := newRepository
@@ -1059,11 +1228,11 @@ func TestOCIClient_Pull_Success(t *testing.T) {
 	defer func() { copyFunc = originalCopyFunc }()
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.NoError(t, err)
-	assert.Equal(t, expectedLayerData, data)
+	assert.Equal(t, string(expectedLayerData), readAndClose(t, data))
 }
 
 func TestOCIClient_Pull_InvalidReference(t *testing.T) {
@@ -1075,7 +1244,7 @@ func TestOCIClient_Pull_InvalidReference(t *testing.T) {
 	reference := "http://registry.test/repo/artifact:tag"
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.Nil(t, data)
@@ -1092,7 +1261,7 @@ func TestOCIClient_Pull_ParseReferenceError(t *testing.T) {
 	reference := "oci://registry.test/INVALID-UPPERCASE-REPO:tag"
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert
 	assert.Nil(t, data)
@@ -1117,13 +1286,11 @@ func TestOCIClient_Pull_FullFlow(t *testing.T) {
 				manifestBytes, _ := json.Marshal(manifestWithLayers)
 				expectedLayerData := []byte("test layer data")
 
-				callCount := 0
 				contentFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) ([]byte, error) {
-					callCount++
-					if callCount == 1 {
-						return manifestBytes, nil
-					}
-					return expectedLayerData, nil
+					return manifestBytes, nil
+				}
+				blobFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(expectedLayerData)), nil
 				}
 			},
 			expectedData: []byte("test layer data"),
@@ -1168,12 +1335,10 @@ func TestOCIClient_Pull_FullFlow(t *testing.T) {
 				manifestWithLayers := createManifestWithLayers()
 				manifestBytes, _ := json.Marshal(manifestWithLayers)
 
-				callCount := 0
 				contentFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) ([]byte, error) {
-					callCount++
-					if callCount == 1 {
-						return manifestBytes, nil
-					}
+					return manifestBytes, nil
+				}
+				blobFetcher = func(ctx context.Context, store content.Fetcher, desc v1.Descriptor) (io.ReadCloser, error) {
 					return nil, errors.New("layer fetch failed")
 				}
 			},
@@ -1190,6 +1355,7 @@ func TestOCIClient_Pull_FullFlow(t *testing.T) {
 
 			// Backup original functions
 			originalFetcher := contentFetcher
+			originalBlobFetcher := blobFetcher
 			originalNewRepository := newRepository
 			originalCopyFunc := copyFunc
 
@@ -1205,7 +1371,7 @@ func TestOCIClient_Pull_FullFlow(t *testing.T) {
 			}
 
 			// Act
-			data, err := client.Pull(ctx, tt.reference)
+			_, data, err := client.Pull(ctx, tt.reference)
 
 			// Assert
 			if tt.expectedError != "" {
@@ -1214,11 +1380,12 @@ func TestOCIClient_Pull_FullFlow(t *testing.T) {
 				assert.Nil(t, data)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.expectedData, data)
+				assert.Equal(t, string(tt.expectedData), readAndClose(t, data))
 			}
 
 			// Restore original functions
 			contentFetcher = originalFetcher
+			blobFetcher = originalBlobFetcher
 			newRepository = originalNewRepository
 			copyFunc = originalCopyFunc
 		})
@@ -1254,9 +1421,932 @@ func TestOCIClient_Pull_StoreResolveError(t *testing.T) {
 	// and the resolve should fail naturally
 
 	// Act
-	data, err := client.Pull(ctx, reference)
+	_, data, err := client.Pull(ctx, reference)
 
 	// Assert - we expect an error because the store won't have the reference
 	assert.Nil(t, data)
 	assert.Error(t, err)
 }
+
+// newTestRegistry starts an in-memory OCI registry with referrers support
+// and returns its host:port for use in references.
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.WithReferrersSupport(true)))
+	t.Cleanup(server.Close)
+	orig := newRepository
+	t.Cleanup(func() { newRepository = orig })
+	newRepository = func(reference string) (*remote.Repository, error) {
+		repo, err := remote.NewRepository(reference)
+		if err == nil {
+			repo.PlainHTTP = true
+		}
+		return repo, err
+	}
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestOCIClientCopyBetweenRegistries(t *testing.T) {
+	viper.Reset()
+	origPack := packManifest
+	defer func() { packManifest = origPack }()
+	packManifest = oras.PackManifest
+	ctx := context.Background()
+	srcHost := newTestRegistry(t)
+	dstHost := newTestRegistry(t)
+
+	dir := t.TempDir()
+	path := dir + "/makefile"
+	if err := os.WriteFile(path, []byte("all:\n\techo ok\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := NewOCIClient(&config.Config{}).(*OCIClient)
+	src := srcHost + "/team/make:staging"
+	if _, err := client.Push(ctx, src, path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// Attach a signature-like referrer to the source artifact
+	srcRepo, _, err := client.repository(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := srcRepo.Resolve(ctx, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigDesc, err := oras.PackManifest(ctx, srcRepo, oras.PackManifestVersion1_1, "application/vnd.test.signature",
+		oras.PackManifestOptions{Subject: &root})
+	if err != nil {
+		t.Fatalf("pack referrer: %v", err)
+	}
+
+	dst := dstHost + "/team/make:prod"
+	if err := client.Copy(ctx, src, dst); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	dstRepo, _, err := client.repository(ctx, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := dstRepo.Resolve(ctx, "prod")
+	if err != nil {
+		t.Fatalf("resolve copied tag: %v", err)
+	}
+	if got.Digest != root.Digest {
+		t.Errorf("expected digest %s, got %s", root.Digest, got.Digest)
+	}
+	found := false
+	if err := dstRepo.Referrers(ctx, got, "", func(refs []v1.Descriptor) error {
+		for _, r := range refs {
+			if r.Digest == sigDesc.Digest {
+				found = true
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("referrers: %v", err)
+	}
+	if !found {
+		t.Error("expected referrer to be copied to destination")
+	}
+}
+
+func TestOCIClientPullWithoutCache(t *testing.T) {
+	viper.Reset()
+	origPack, origCopy, origFetch := packManifest, copyFunc, contentFetcher
+	defer func() { packManifest, copyFunc, contentFetcher = origPack, origCopy, origFetch }()
+	packManifest, copyFunc, contentFetcher = oras.PackManifest, oras.Copy, content.FetchAll
+	ctx := context.Background()
+	host := newTestRegistry(t)
+
+	path := filepath.Join(t.TempDir(), "makefile")
+	if err := os.WriteFile(path, []byte("all:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref := host + "/team/make:v1"
+	if _, err := NewOCIClient(&config.Config{}).Push(ctx, ref, path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// Without a cache the artifact is staged in a temporary layout that is
+	// removed once the returned reader is closed
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	desc, data, err := NewOCIClient(&config.Config{}).Pull(ctx, ref)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 1 {
+		t.Errorf("expected a staging layout while reading, got %d entries", len(entries))
+	}
+	if got := readAndClose(t, data); got != "all:\n" || desc.Size != int64(len(got)) {
+		t.Errorf("unexpected data %q for %+v", got, desc)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("expected staging layout to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestClientProgress(t *testing.T) {
+	viper.Reset()
+	origPack, origCopy, origFetch := packManifest, copyFunc, contentFetcher
+	defer func() { packManifest, copyFunc, contentFetcher = origPack, origCopy, origFetch }()
+	packManifest, copyFunc, contentFetcher = oras.PackManifest, oras.Copy, content.FetchAll
+	host := newTestRegistry(t)
+
+	var out bytes.Buffer
+	ctx := progress.WithReporter(context.Background(), progress.New(&out))
+	path := filepath.Join(t.TempDir(), "ci.mk")
+	if err := os.WriteFile(path, []byte("all:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref := host + "/team/make:v1"
+	c := NewOCIClient(&config.Config{CacheDir: t.TempDir()})
+	if _, err := c.Push(ctx, ref, path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if !strings.Contains(out.String(), "ci.mk: started (5 B)\nci.mk: done 5 B") {
+		t.Errorf("expected upload progress for the layer, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	_, rc, err := NewOCIClient(&config.Config{CacheDir: t.TempDir()}).Pull(ctx, ref)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	_ = readAndClose(t, rc)
+	if got := out.String(); !strings.HasPrefix(got, "ci.mk: started (5 B)\nci.mk: done 5 B") || strings.Count(got, "\n") != 2 {
+		t.Errorf("expected download progress for the layer only, got:\n%s", got)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	out.Reset()
+	_, rc, err = NewHTTPClient().Pull(ctx, server.URL+"/make.mk?x=1")
+	if err != nil {
+		t.Fatalf("HTTP pull: %v", err)
+	}
+	_ = readAndClose(t, rc)
+	name := strings.TrimPrefix(server.URL, "http://") + "/make.mk"
+	if want := name + ": started (2 B)\n" + name + ": done 2 B"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("expected download progress %q, got:\n%s", want, out.String())
+	}
+}
+
+func TestOCIClientPullWritesCacheLayout(t *testing.T) {
+	viper.Reset()
+	origPack, origCopy, origFetch := packManifest, copyFunc, contentFetcher
+	defer func() { packManifest, copyFunc, contentFetcher = origPack, origCopy, origFetch }()
+	packManifest, copyFunc, contentFetcher = oras.PackManifest, oras.Copy, content.FetchAll
+	ctx := context.Background()
+	host := newTestRegistry(t)
+
+	path := filepath.Join(t.TempDir(), "makefile")
+	if err := os.WriteFile(path, []byte("all:\n\techo ok\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref := host + "/team/make:v1"
+	if _, err := NewOCIClient(&config.Config{}).Push(ctx, ref, path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	client := NewOCIClient(cfg).(*OCIClient)
+	_, data, err := client.Pull(ctx, ref)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if got := readAndClose(t, data); got != "all:\n\techo ok\n" {
+		t.Errorf("unexpected data %q", got)
+	}
+
+	repo, _, err := client.repository(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteDesc, err := repo.Resolve(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := cache.OpenLayout(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := layout.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatalf("expected %s in cache layout: %v", ref, err)
+	}
+	if cached.Digest != remoteDesc.Digest {
+		t.Errorf("expected cached digest %s, got %s", remoteDesc.Digest, cached.Digest)
+	}
+}
+
+func TestOCIClientPullMaxArtifactSize(t *testing.T) {
+	viper.Reset()
+	origPack, origCopy, origFetch := packManifest, copyFunc, contentFetcher
+	defer func() { packManifest, copyFunc, contentFetcher = origPack, origCopy, origFetch }()
+	packManifest, copyFunc, contentFetcher = oras.PackManifest, oras.Copy, content.FetchAll
+	ctx := context.Background()
+	host := newTestRegistry(t)
+
+	data := strings.Repeat("#", 1024)
+	path := filepath.Join(t.TempDir(), "makefile")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref := host + "/team/make:v1"
+	if _, err := NewOCIClient(&config.Config{}).Push(ctx, ref, path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	layer := digest.FromString(data)
+
+	cfg := &config.Config{CacheDir: t.TempDir(), MaxArtifactSize: 512}
+	_, _, err := NewOCIClient(cfg).Pull(ctx, ref)
+	if err == nil || !strings.Contains(err.Error(), "exceeds maxArtifactSize") {
+		t.Fatalf("expected the layer to be refused, got %v", err)
+	}
+	if _, err := os.Stat(cache.BlobPath(cfg, layer)); !os.IsNotExist(err) {
+		t.Errorf("expected the oversized layer not to be downloaded: %v", err)
+	}
+
+	cfg.MaxArtifactSize = 2048
+	_, rc, err := NewOCIClient(cfg).Pull(ctx, ref)
+	if err != nil {
+		t.Fatalf("pull within the limit: %v", err)
+	}
+	if got := readAndClose(t, rc); got != data {
+		t.Errorf("unexpected data %q", got)
+	}
+}
+
+func TestOCIClientPushRequiresMakeAnnotation(t *testing.T) {
+	viper.Reset()
+	origPack, origCopy, origFetch := packManifest, copyFunc, contentFetcher
+	defer func() { packManifest, copyFunc, contentFetcher = origPack, origCopy, origFetch }()
+	packManifest, copyFunc, contentFetcher = oras.PackManifest, oras.Copy, content.FetchAll
+	ctx := context.Background()
+	host := newTestRegistry(t)
+
+	path := filepath.Join(t.TempDir(), "makefile")
+	_ = os.WriteFile(path, []byte("# remake: requires make >= 4.3\n# remake: image golang:1.24\nall:\n"), 0o644)
+	ref := host + "/team/make:v1"
+	if _, err := NewOCIClient(&config.Config{}).Push(ctx, ref, path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	_, data, err := NewOCIClient(cfg).Pull(ctx, ref)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	readAndClose(t, data)
+	annotations, err := cache.NewOCIRepository(cfg).(cache.Annotator).Annotations(ctx, ref)
+	if err != nil {
+		t.Fatalf("Annotations: %v", err)
+	}
+	if got := annotations[makefile.AnnotationRequiresMake]; got != "4.3" {
+		t.Errorf("expected required make annotation 4.3, got %q", got)
+	}
+	if got := annotations[makefile.AnnotationImage]; got != "golang:1.24" {
+		t.Errorf("expected image annotation golang:1.24, got %q", got)
+	}
+}
+
+func TestOCIClientCopyErrors(t *testing.T) {
+	client := NewOCIClient(&config.Config{})
+	if err := client.Copy(context.Background(), "http://x/y", "reg.io/repo:tag"); err == nil {
+		t.Error("expected error for invalid source")
+	}
+	if err := client.Copy(context.Background(), "reg.io/repo:tag", "http://x/y"); err == nil {
+		t.Error("expected error for invalid destination")
+	}
+
+	orig := extendedCopy
+	defer func() { extendedCopy = orig }()
+	extendedCopy = func(ctx context.Context, src oras.ReadOnlyGraphTarget, srcRef string, dst oras.Target, dstRef string, opts oras.ExtendedCopyOptions) (v1.Descriptor, error) {
+		return v1.Descriptor{}, errors.New("copy failed")
+	}
+	err := client.Copy(context.Background(), "reg.io/src:1", "reg.io/dst:1")
+	if err == nil || !strings.Contains(err.Error(), "copy failed") {
+		t.Errorf("expected copy error, got %v", err)
+	}
+}
+
+func TestHTTPClientCopyUnsupported(t *testing.T) {
+	if err := NewHTTPClient().Copy(context.Background(), "http://a", "http://b"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestOCIClientDeleteAndUntag(t *testing.T) {
+	viper.Reset()
+	origPack := packManifest
+	defer func() { packManifest = origPack }()
+	packManifest = oras.PackManifest
+	ctx := context.Background()
+	host := newTestRegistry(t)
+
+	path := t.TempDir() + "/makefile"
+	if err := os.WriteFile(path, []byte("all:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := NewOCIClient(&config.Config{}).(*OCIClient)
+	for _, tag := range []string{"v1", "v2"} {
+		if _, err := client.Push(ctx, host+"/team/make:"+tag, path); err != nil {
+			t.Fatalf("push %s: %v", tag, err)
+		}
+	}
+	repo, _, err := client.repository(ctx, host+"/team/make:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := repo.Resolve(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Untag(ctx, host+"/team/make:v1"); err != nil {
+		t.Fatalf("untag: %v", err)
+	}
+	if _, err := repo.Resolve(ctx, "v1"); err == nil {
+		t.Error("expected v1 to be gone after untag")
+	}
+	if _, err := repo.Resolve(ctx, desc.Digest.String()); err != nil {
+		t.Errorf("expected manifest to survive untag: %v", err)
+	}
+	if err := client.Untag(ctx, host+"/team/make:v1"); err == nil {
+		t.Error("expected error untagging missing tag")
+	}
+	if err := client.Untag(ctx, host+"/team/make@"+desc.Digest.String()); err == nil {
+		t.Error("expected error untagging a digest")
+	}
+
+	if err := client.Delete(ctx, host+"/team/make:v2"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := repo.Resolve(ctx, desc.Digest.String()); err == nil {
+		t.Error("expected manifest to be deleted")
+	}
+	if err := client.Delete(ctx, host+"/team/make:missing"); err == nil {
+		t.Error("expected error deleting missing tag")
+	}
+	if err := client.Delete(ctx, "http://bad/ref"); err == nil {
+		t.Error("expected error for invalid reference")
+	}
+}
+
+func TestHTTPClientPullAuthentication(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	var gotReq *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotReq = r
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	key := "registries." + config.NormalizeKey(u.Host)
+
+	origNetrc := netrcPath
+	defer func() { netrcPath = origNetrc }()
+	netrc := t.TempDir() + "/netrc"
+	_ = os.WriteFile(netrc, []byte("machine other.example.com login x password y\n"+
+		"machine "+u.Hostname()+"\n  login netuser\n  password netpass\n"), 0o600)
+	netrcPath = func() string { return netrc }
+
+	h := NewHTTPClient()
+	pull := func() {
+		t.Helper()
+		if _, _, err := h.Pull(context.Background(), server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// netrc fallback
+	pull()
+	if user, pass, ok := gotReq.BasicAuth(); !ok || user != "netuser" || pass != "netpass" {
+		t.Errorf("expected netrc credentials, got %q %q", user, pass)
+	}
+
+	// configured basic auth wins over netrc
+	viper.Set(key+".username", "cfguser")
+	viper.Set(key+".password", "cfgpass")
+	pull()
+	if user, _, _ := gotReq.BasicAuth(); user != "cfguser" {
+		t.Errorf("expected configured username, got %q", user)
+	}
+
+	// token from environment
+	t.Setenv("REMAKE_TEST_TOKEN", "envtoken")
+	viper.Set(key+".tokenEnv", "REMAKE_TEST_TOKEN")
+	pull()
+	if got := gotReq.Header.Get("Authorization"); got != "Bearer envtoken" {
+		t.Errorf("expected bearer token from env, got %q", got)
+	}
+
+	// custom header
+	viper.Set(key+".token", "statictoken")
+	viper.Set(key+".header", "PRIVATE-TOKEN")
+	pull()
+	if got := gotReq.Header.Get("PRIVATE-TOKEN"); got != "statictoken" {
+		t.Errorf("expected custom header token, got %q", got)
+	}
+	if got := gotReq.Header.Get("Authorization"); got != "" {
+		t.Errorf("expected no Authorization header, got %q", got)
+	}
+
+	// no credentials at all for pulls on behalf of cache server clients
+	if _, _, err := h.Pull(WithoutCredentials(context.Background()), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, ok := gotReq.BasicAuth(); ok || gotReq.Header.Get("PRIVATE-TOKEN") != "" {
+		t.Errorf("expected no credentials, got headers %v", gotReq.Header)
+	}
+}
+
+func TestHTTPClientPullWithoutCredentialsRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("elsewhere"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/make.mk", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	ctx := WithoutCredentials(context.Background())
+	h := NewHTTPClient()
+	_, data, err := h.Pull(ctx, server.URL+"/moved")
+	if err != nil {
+		t.Fatalf("expected redirects on the same host to be followed: %v", err)
+	}
+	readAndClose(t, data)
+	if _, _, err := h.Pull(ctx, server.URL+"/away"); err == nil || !strings.Contains(err.Error(), "refusing redirect") {
+		t.Errorf("expected redirect to another host to be refused, got %v", err)
+	}
+	if _, data, err := h.Pull(context.Background(), server.URL+"/away"); err != nil {
+		t.Errorf("expected redirects to be followed with credentials: %v", err)
+	} else {
+		readAndClose(t, data)
+	}
+}
+
+func TestHTTPClientRedirectDropsCustomHeader(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = append(leaked, r.Header.Get("Private-Token"), r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("elsewhere"))
+	}))
+	defer other.Close()
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("Private-Token"))
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/make.mk", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	key := "registries." + config.NormalizeKey(u.Host)
+	viper.Set(key+".token", "supersecret")
+	viper.Set(key+".header", "PRIVATE-TOKEN")
+
+	h := NewHTTPClient()
+	for _, path := range []string{"/moved", "/away"} {
+		_, data, err := h.Pull(context.Background(), server.URL+path)
+		if err != nil {
+			t.Fatalf("pull %s: %v", path, err)
+		}
+		readAndClose(t, data)
+	}
+	if len(sent) != 3 || sent[0] != "supersecret" || sent[1] != "supersecret" || sent[2] != "supersecret" {
+		t.Errorf("expected the token on every request to its host, got %v", sent)
+	}
+	if len(leaked) != 2 || leaked[0] != "" || leaked[1] != "" {
+		t.Errorf("expected no credentials after a redirect to another host, got %v", leaked)
+	}
+}
+
+func TestHTTPClientPullConditional(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("all:\n"))
+	}))
+	defer server.Close()
+
+	ctx := WithValidators(context.Background(), map[string]string{
+		cache.AnnotationETag:         `"v1"`,
+		cache.AnnotationLastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+	})
+	if _, _, err := NewHTTPClient().Pull(ctx, server.URL+"/Makefile"); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("expected ErrNotModified, got %v", err)
+	}
+	if got.Get("If-Modified-Since") != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("expected If-Modified-Since to be sent, got %v", got)
+	}
+
+	ctx = WithValidators(context.Background(), map[string]string{cache.AnnotationETag: `"v0"`})
+	_, rc, err := NewHTTPClient().Pull(ctx, server.URL+"/Makefile")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readAndClose(t, rc)
+}
+
+func TestHTTPClientDebugLogging(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=abc123")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	viper.Set("registries."+config.NormalizeKey(u.Host)+".token", "supersecret")
+
+	var buf bytes.Buffer
+	cfg := &config.Config{Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	_, rc, err := NewClient(cfg, server.URL+"/Makefile?X-Amz-Signature=sig123&v=1").Pull(context.Background(), server.URL+"/Makefile?X-Amz-Signature=sig123&v=1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readAndClose(t, rc)
+
+	out := buf.String()
+	for _, want := range []string{"http request", "http response", "status=\"200 OK\"", "Authorization:REDACTED", "X-Amz-Signature=REDACTED", "v=1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in log output:\n%s", want, out)
+		}
+	}
+	for _, secret := range []string{"supersecret", "sig123", "abc123"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %q:\n%s", secret, out)
+		}
+	}
+
+	// tokens sent in a custom header are redacted whatever its name
+	buf.Reset()
+	viper.Set("registries."+config.NormalizeKey(u.Host)+".header", "X-Deploy")
+	_, rc, err = NewClient(cfg, server.URL).Pull(context.Background(), server.URL+"/Makefile")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readAndClose(t, rc)
+	if out := buf.String(); strings.Contains(out, "supersecret") || !strings.Contains(out, "X-Deploy:REDACTED") {
+		t.Errorf("expected the configured header to be redacted:\n%s", out)
+	}
+
+	// without debug logging the client is left untouched
+	if c := NewClient(&config.Config{}, server.URL).(*HTTPClient); c.httpClient != http.DefaultClient {
+		t.Error("expected default HTTP client without debug logging")
+	}
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	origNetrc := netrcPath
+	defer func() { netrcPath = origNetrc }()
+	netrc := t.TempDir() + "/netrc"
+	_ = os.WriteFile(netrc, []byte(`# comment
+machine a.example.com login alice password secret1
+macdef init
+cd /tmp
+put file
+
+default login anon password guest
+machine b.example.com login bob password secret2
+`), 0o600)
+	netrcPath = func() string { return netrc }
+
+	cases := map[string][2]string{
+		"a.example.com": {"alice", "secret1"},
+		"b.example.com": {"bob", "secret2"},
+		"c.example.com": {"anon", "guest"},
+	}
+	for host, want := range cases {
+		login, pass, ok := netrcCredentials(host)
+		if !ok || login != want[0] || pass != want[1] {
+			t.Errorf("%s: expected %v, got %q %q %v", host, want, login, pass, ok)
+		}
+	}
+
+	netrcPath = func() string { return netrc + ".missing" }
+	if _, _, ok := netrcCredentials("a.example.com"); ok {
+		t.Error("expected no credentials without a netrc file")
+	}
+}
+
+func TestHTTPClientLoginToken(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(t.TempDir() + "/config.yaml")
+
+	h := NewHTTPClient()
+	if err := h.Login(context.Background(), "https://files.example.com", "", "tok"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := viper.GetString("registries.files_example_com.token"); got != "tok" {
+		t.Errorf("expected stored token, got %q", got)
+	}
+	if err := h.Login(context.Background(), "https://files.example.com", "user", "pass"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := viper.GetString("registries.files_example_com.token"); got != "" {
+		t.Errorf("expected token to be cleared by basic login, got %q", got)
+	}
+}
+
+// newGitRepo creates a bare repository with two commits of make/ci.mk, the
+// first tagged v1, and returns its file:// URL and both commit ids.
+func newGitRepo(t *testing.T) (repoURL, first, second string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	work, bare := dir+"/work", dir+"/repo.git"
+	git := func(wd string, args ...string) string {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = wd
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git(dir, "init", "-q", "--bare", bare)
+	git(dir, "init", "-q", work)
+	_ = os.MkdirAll(work+"/make", 0o755)
+	_ = os.WriteFile(work+"/make/ci.mk", []byte("v1:\n"), 0o644)
+	git(work, "add", ".")
+	git(work, "commit", "-q", "-m", "first")
+	git(work, "tag", "-a", "v1", "-m", "v1")
+	first = git(work, "rev-parse", "HEAD")
+	_ = os.WriteFile(work+"/make/ci.mk", []byte("v2:\n"), 0o644)
+	git(work, "commit", "-q", "-am", "second")
+	second = git(work, "rev-parse", "HEAD")
+	git(work, "push", "-q", bare, "main", "v1")
+	return "file://" + bare, first, second
+}
+
+func TestGitClientPull(t *testing.T) {
+	repo, first, second := newGitRepo(t)
+	g := NewGitClient()
+	cases := map[string]string{
+		"git+" + repo + "//make/ci.mk":                "v2:\n",
+		"git+" + repo + "//make/ci.mk@main":           "v2:\n",
+		"git+" + repo + "//make/ci.mk@v1":             "v1:\n",
+		"git+" + repo + "//make/ci.mk@" + first:       "v1:\n",
+		"git+" + repo + "//make/ci.mk@" + second[:10]: "v2:\n",
+	}
+	for ref, want := range cases {
+		_, data, err := g.Pull(context.Background(), ref)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", ref, err)
+			continue
+		}
+		if got := readAndClose(t, data); got != want {
+			t.Errorf("%s: expected %q, got %q", ref, want, got)
+		}
+	}
+
+	if _, _, err := g.Pull(context.Background(), "git+"+repo+"//missing.mk@main"); err == nil {
+		t.Error("expected error for missing file")
+	}
+	if _, _, err := g.Pull(context.Background(), "git+"+repo+"//make/ci.mk@nope"); err == nil {
+		t.Error("expected error for unknown ref")
+	}
+	if _, _, err := g.Pull(context.Background(), "git+"+repo); err == nil {
+		t.Error("expected error for reference without path")
+	}
+
+	// without credentials, git ignores the user's configuration and netrc
+	orig := runGit
+	defer func() { runGit = orig }()
+	var envs [][]string
+	runGit = func(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+		envs = append(envs, env)
+		return orig(ctx, dir, env, args...)
+	}
+	_, data, err := g.Pull(WithoutCredentials(context.Background()), "git+"+repo+"//make/ci.mk@v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readAndClose(t, data)
+	for _, env := range envs {
+		if len(env) == 0 || !strings.HasPrefix(env[0], "HOME=") {
+			t.Errorf("expected HOME to be replaced, got %v", env)
+		}
+	}
+}
+
+func TestGitClientUnsupportedOperations(t *testing.T) {
+	g := NewGitClient()
+	ctx := context.Background()
+	if err := g.Login(ctx, "git+https://x", "u", "p"); err == nil {
+		t.Error("expected login error")
+	}
+	if _, err := g.Push(ctx, "git+https://x//a", "p"); err == nil {
+		t.Error("expected push error")
+	}
+	if err := g.Copy(ctx, "a", "b"); err == nil {
+		t.Error("expected copy error")
+	}
+	if err := g.Delete(ctx, "a"); err == nil {
+		t.Error("expected delete error")
+	}
+	if err := g.Untag(ctx, "a"); err == nil {
+		t.Error("expected untag error")
+	}
+	if _, ok := NewClient(&config.Config{}, "git+https://x//a").(*GitClient); !ok {
+		t.Error("expected GitClient for git reference")
+	}
+}
+
+func TestLayoutClientPushPull(t *testing.T) {
+	origPack := packManifest
+	defer func() { packManifest = origPack }()
+	packManifest = oras.PackManifest
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	path := dir + "/makefile"
+	_ = os.WriteFile(path, []byte("all:\n"), 0o644)
+	layout := config.LayoutScheme + dir + "/layout"
+
+	c := NewLayoutClient(&config.Config{})
+	manifestDesc, err := c.Push(ctx, layout+":v1", path)
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if manifestDesc.MediaType != v1.MediaTypeImageManifest {
+		t.Errorf("expected a manifest descriptor, got %+v", manifestDesc)
+	}
+	if _, err := os.Stat(dir + "/layout/index.json"); err != nil {
+		t.Errorf("expected index.json in layout: %v", err)
+	}
+	_, data, err := c.Pull(ctx, layout+":v1")
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if got := readAndClose(t, data); got != "all:\n" {
+		t.Errorf("unexpected data %q", got)
+	}
+	blob, err := LayoutBlobPath(ctx, layout+":v1")
+	if err != nil {
+		t.Fatalf("blob path: %v", err)
+	}
+	if b, _ := os.ReadFile(blob); string(b) != "all:\n" {
+		t.Errorf("unexpected blob content %q", b)
+	}
+
+	if _, _, err := c.Pull(ctx, layout+":missing"); err == nil {
+		t.Error("expected error for missing tag")
+	}
+	if _, err := c.Push(ctx, config.LayoutScheme+dir+"/x.tar:v1", path); err == nil {
+		t.Error("expected error pushing to tarball")
+	}
+	if _, err := LayoutBlobPath(ctx, config.LayoutScheme+dir+"/x.tar:v1"); err == nil {
+		t.Error("expected error for tarball blob path")
+	}
+	if err := c.Login(ctx, "x", "u", "p"); err == nil {
+		t.Error("expected login error")
+	}
+
+	if err := c.Untag(ctx, layout+":v1"); err != nil {
+		t.Fatalf("untag: %v", err)
+	}
+	if _, _, err := c.Pull(ctx, layout+":v1"); err == nil {
+		t.Error("expected tag to be removed")
+	}
+	if _, err := c.Push(ctx, layout+":v2", path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := c.Delete(ctx, layout+":v2"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, _, err := c.Pull(ctx, layout+":v2"); err == nil {
+		t.Error("expected manifest to be deleted")
+	}
+}
+
+func TestCopyBetweenRegistryAndLayouts(t *testing.T) {
+	viper.Reset()
+	origPack := packManifest
+	defer func() { packManifest = origPack }()
+	packManifest = oras.PackManifest
+	ctx := context.Background()
+	host := newTestRegistry(t)
+
+	dir := t.TempDir()
+	path := dir + "/makefile"
+	_ = os.WriteFile(path, []byte("all:\n"), 0o644)
+	c := NewOCIClient(&config.Config{})
+	if _, err := c.Push(ctx, host+"/team/make:v1", path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// registry -> tarball -> registry
+	tarball := config.LayoutScheme + dir + "/make.tar:v1"
+	if err := c.Copy(ctx, host+"/team/make:v1", tarball); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	_, data, err := NewLayoutClient(&config.Config{}).Pull(ctx, tarball)
+	if err != nil {
+		t.Fatalf("pull from tarball: %v", err)
+	}
+	if got := readAndClose(t, data); got != "all:\n" {
+		t.Errorf("unexpected data %q", got)
+	}
+	if err := NewLayoutClient(&config.Config{}).Copy(ctx, tarball, host+"/other/make:v1"); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	_, data, err = c.Pull(ctx, host+"/other/make:v1")
+	if err != nil {
+		t.Fatalf("expected imported artifact: %v", err)
+	}
+	if got := readAndClose(t, data); got != "all:\n" {
+		t.Errorf("unexpected imported data %q", got)
+	}
+
+	// exporting to an existing tarball adds to it
+	_ = os.WriteFile(path, []byte("all:\n\techo v2\n"), 0o644)
+	if _, err := c.Push(ctx, host+"/team/make:v2", path); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := c.Copy(ctx, host+"/team/make:v2", config.LayoutScheme+dir+"/make.tar:v2"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	for tag, want := range map[string]string{"v1": "all:\n", "v2": "all:\n\techo v2\n"} {
+		_, data, err := NewLayoutClient(&config.Config{}).Pull(ctx, config.LayoutScheme+dir+"/make.tar:"+tag)
+		if err != nil {
+			t.Fatalf("pull %s from tarball: %v", tag, err)
+		}
+		if got := readAndClose(t, data); got != want {
+			t.Errorf("unexpected data for %s: %q", tag, got)
+		}
+	}
+
+	// the staging directory is removed whether the export succeeds or not
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	if err := c.Copy(ctx, host+"/team/make:v1", config.LayoutScheme+dir+"/other.tar:v1"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := c.Copy(ctx, host+"/team/missing:v1", config.LayoutScheme+dir+"/other.tar:v2"); err == nil {
+		t.Error("expected error exporting a missing artifact")
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("expected no staging directory left, got %v", entries)
+	}
+
+	// registry -> directory
+	if err := c.Copy(ctx, host+"/team/make:v1", config.LayoutScheme+dir+"/layout:v1"); err != nil {
+		t.Fatalf("export to dir: %v", err)
+	}
+	if _, err := LayoutBlobPath(ctx, config.LayoutScheme+dir+"/layout:v1"); err != nil {
+		t.Errorf("expected artifact in layout: %v", err)
+	}
+	if err := c.Copy(ctx, config.LayoutScheme+dir+"/nope:v1", host+"/x/y:v1"); err == nil {
+		t.Error("expected error for missing source layout")
+	}
+}
+
+func TestMirrorRepository(t *testing.T) {
+	mirrored := MirrorRepository("localhost:5000", "org/make")
+	if mirrored != "localhost_5000/org/make" {
+		t.Errorf("unexpected mirrored repository %q", mirrored)
+	}
+	if registry, repo, err := ParseMirrorRepository(mirrored); err != nil || registry != "localhost:5000" || repo != "org/make" {
+		t.Errorf("ParseMirrorRepository(%q) = %q, %q, %v", mirrored, registry, repo, err)
+	}
+	if _, _, err := ParseMirrorRepository("make"); err == nil {
+		t.Error("expected error for repository without registry")
+	}
+}
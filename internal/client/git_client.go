@@ -0,0 +1,130 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cache"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+)
+
+// runGit allows tests to intercept git invocations. env is added to the
+// environment of git.
+var runGit = func(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never block on credential prompts; rely on configured helpers instead
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GitClient implements Client for git+<url>//<path>@<ref> references by
+// shelling out to the local git binary, so any transport and credential
+// helper configured for git works unchanged.
+type GitClient struct{}
+
+// NewGitClient returns a new GitClient.
+func NewGitClient() *GitClient {
+	return &GitClient{}
+}
+
+// Login is not supported for GitClient; git's own credential helpers are used.
+func (g *GitClient) Login(ctx context.Context, registry, user, pass string) error {
+	return fmt.Errorf("login is not supported for git references; configure git credentials instead")
+}
+
+// Push is not supported for GitClient as publishing requires a commit.
+func (g *GitClient) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
+	return v1.Descriptor{}, fmt.Errorf("pushing to git references is not supported")
+}
+
+// Copy is not supported for GitClient.
+func (g *GitClient) Copy(ctx context.Context, src, dst string) error {
+	return fmt.Errorf("copying git references is not supported")
+}
+
+// Delete is not supported for GitClient.
+func (g *GitClient) Delete(ctx context.Context, reference string) error {
+	return fmt.Errorf("deleting git references is not supported")
+}
+
+// Untag is not supported for GitClient.
+func (g *GitClient) Untag(ctx context.Context, reference string) error {
+	return fmt.Errorf("untagging git references is not supported")
+}
+
+// Pull fetches the commit named by the reference into a scratch repository
+// and returns the contents of the referenced file at that commit. A shallow
+// fetch of the ref is tried first; servers that refuse to serve the ref
+// directly (e.g., a commit id, which the store pins branches and tags to)
+// fall back to fetching all branches and tags. When ctx was marked by
+// WithoutCredentials, git runs without the user's configuration, credential
+// helpers and netrc.
+func (g *GitClient) Pull(ctx context.Context, reference string) (v1.Descriptor, io.ReadCloser, error) {
+	ref, err := config.ParseGitReference(reference)
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	dir, err := os.MkdirTemp("", "remake-git-")
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	var env []string
+	if withoutCredentials(ctx) {
+		// Point git and curl at the empty scratch repository for their
+		// user configuration, credential helpers and netrc
+		env = []string{"HOME=" + dir, "XDG_CONFIG_HOME=" + dir, "GIT_CONFIG_NOSYSTEM=1"}
+	}
+	if _, err := runGit(ctx, dir, env, "init", "-q", "--bare"); err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	commit := "FETCH_HEAD"
+	if _, err := runGit(ctx, dir, env, "fetch", "-q", "--depth=1", ref.Repository, ref.Ref); err != nil {
+		if _, err := runGit(ctx, dir, env, "fetch", "-q", ref.Repository,
+			"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"); err != nil {
+			return v1.Descriptor{}, nil, fmt.Errorf("fetching %s: %w", reference, err)
+		}
+		commit = ref.Ref
+	}
+	data, err := runGit(ctx, dir, env, "show", commit+"^{commit}:"+ref.Path)
+	if err != nil {
+		return v1.Descriptor{}, nil, fmt.Errorf("reading %s at %s: %w", ref.Path, ref.Ref, err)
+	}
+	return content.NewDescriptorFromBytes(cache.FileMediaType, data), io.NopCloser(bytes.NewReader(data)), nil
+}
@@ -2,13 +2,28 @@ package client
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cache"
+	"github.com/TrianaLab/remake/internal/progress"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/viper"
 )
 
-// HTTPClient provides basic HTTP(S) access for fetching remote Makefile artifacts.
-// It implements the Client interface with no-op Login and Push methods.
+// HTTPClient provides HTTP(S) access for fetching and publishing remote Makefile
+// artifacts. Pushes are performed with HTTP PUT, which is understood by generic
+// artifact repositories (Artifactory, Nexus), WebDAV servers and presigned
+// object storage URLs.
 type HTTPClient struct {
 	httpClient *http.Client
 }
@@ -18,27 +33,75 @@ func NewHTTPClient() *HTTPClient {
 	return &HTTPClient{httpClient: http.DefaultClient}
 }
 
-// Login is a no-op for HTTPClient since HTTP references do not require authentication.
+// Login stores the given credentials for the host of registry, which may be a
+// bare host or a full URL. When user is empty, pass is stored as a token and
+// sent as a bearer token; otherwise later requests to that host use HTTP
+// basic auth with these credentials.
 func (h *HTTPClient) Login(ctx context.Context, registry, user, pass string) error {
-	return nil
-}
-
-// Push is a no-op for HTTPClient as pushing over HTTP is not supported.
-func (h *HTTPClient) Push(ctx context.Context, reference, path string) error {
-	return nil
+	host := registry
+	if u, err := url.Parse(registry); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if host == "" {
+		return fmt.Errorf("invalid HTTP endpoint: %s", registry)
+	}
+	key := "registries." + config.NormalizeKey(host)
+	if user == "" {
+		viper.Set(key+".token", pass)
+	} else {
+		viper.Set(key+".token", "")
+		viper.Set(key+".username", user)
+		viper.Set(key+".password", pass)
+	}
+	return viper.WriteConfig()
 }
 
-// Pull performs an HTTP GET request to fetch the artifact data from the given URL.
-// It returns the raw response body bytes or an error on non-200 status codes or failures.
-func (h *HTTPClient) Pull(ctx context.Context, reference string) (data []byte, err error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reference, nil)
+// Push uploads the local file at path to the reference URL with an HTTP PUT.
+// Credentials configured for the URL host are applied as in Pull, and when
+// 'checksums' is enabled for the host the SHA-1 and SHA-256 of the file are
+// sent in X-Checksum-* headers so the server can verify the upload.
+// The file is streamed as the request body rather than read into memory, and
+// hashed on the way to return its descriptor.
+func (h *HTTPClient) Push(ctx context.Context, reference, path string) (desc v1.Descriptor, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	digester := digest.Canonical.Digester()
+	var body io.Reader = io.TeeReader(f, digester.Hash())
+	if rep := progress.FromContext(ctx); rep != nil {
+		body = rep.Start(filepath.Base(path), info.Size()).Reader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, reference, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request for %s: %w", reference, err)
+		return v1.Descriptor{}, fmt.Errorf("failed to create HTTP request for %s: %w", reference, err)
 	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
 
-	resp, err := h.httpClient.Do(req)
+	setAuthorization(req)
+	httpClient := *h.httpClient
+	httpClient.CheckRedirect = authRedirect
+	if viper.GetBool("registries." + config.NormalizeKey(req.URL.Host) + ".checksums") {
+		sum1, sum256 := sha1.New(), sha256.New()
+		if _, err := io.Copy(io.MultiWriter(sum1, sum256), f); err != nil {
+			return v1.Descriptor{}, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return v1.Descriptor{}, err
+		}
+		req.Header.Set("X-Checksum-Sha1", hex.EncodeToString(sum1.Sum(nil)))
+		req.Header.Set("X-Checksum-Sha256", hex.EncodeToString(sum256.Sum(nil)))
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch %s: %w", reference, err)
+		return v1.Descriptor{}, fmt.Errorf("failed to upload %s: %w", reference, err)
 	}
 	defer func() {
 		closeErr := resp.Body.Close()
@@ -47,15 +110,153 @@ func (h *HTTPClient) Pull(ctx context.Context, reference string) (data []byte, e
 		}
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code %d when fetching %s", resp.StatusCode, reference)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return v1.Descriptor{MediaType: cache.FileMediaType, Digest: digester.Digest(), Size: info.Size()}, nil
+	default:
+		return v1.Descriptor{}, fmt.Errorf("unexpected status code %d when uploading %s", resp.StatusCode, reference)
+	}
+}
+
+// setAuthorization adds the credentials configured for req's host. Sources
+// are tried in order: a 'token' (or the env var named by 'tokenEnv'), then
+// 'username'/'password', then the user's netrc file. Tokens are sent as a
+// bearer token, or verbatim in the header named by 'header' (e.g.,
+// PRIVATE-TOKEN for GitLab); passwords are sent with HTTP basic auth.
+// Redirects to another host never carry them (see authRedirect).
+func setAuthorization(req *http.Request) {
+	key := "registries." + config.NormalizeKey(req.URL.Host)
+
+	token := viper.GetString(key + ".token")
+	if env := viper.GetString(key + ".tokenEnv"); token == "" && env != "" {
+		token = os.Getenv(env)
+	}
+	if token != "" {
+		if header := viper.GetString(key + ".header"); header != "" {
+			authHeaders.Store(http.CanonicalHeaderKey(header), true)
+			req.Header.Set(header, token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return
+	}
+
+	user := viper.GetString(key + ".username")
+	pass := viper.GetString(key + ".password")
+	if user != "" || pass != "" {
+		req.SetBasicAuth(user, pass)
+		return
+	}
+
+	if login, password, ok := netrcCredentials(req.URL.Hostname()); ok {
+		req.SetBasicAuth(login, password)
+	}
+}
+
+// Copy is not supported for HTTPClient as plain URLs have no registry API.
+func (h *HTTPClient) Copy(ctx context.Context, src, dst string) error {
+	return fmt.Errorf("copying HTTP(s) references is not supported")
+}
+
+// Delete is not supported for HTTPClient as plain URLs have no registry API.
+func (h *HTTPClient) Delete(ctx context.Context, reference string) error {
+	return fmt.Errorf("deleting HTTP(s) references is not supported")
+}
+
+// Untag is not supported for HTTPClient as plain URLs have no registry API.
+func (h *HTTPClient) Untag(ctx context.Context, reference string) error {
+	return fmt.Errorf("untagging HTTP(s) references is not supported")
+}
+
+// Pull performs an HTTP GET request to fetch the artifact data from the given URL,
+// authenticated with any credentials configured for its host (see setAuthorization)
+// unless ctx was marked by WithoutCredentials.
+// It returns the response body unread, or an error on non-200 status codes or failures.
+// The returned descriptor carries the Content-Length as its size, if sent,
+// and records the response ETag and Last-Modified headers as annotations. A
+// '#sha256:<hex>' fragment pins the expected digest, which is set on the
+// descriptor so that content that does not match is rejected as it is read
+// into the cache. When ctx carries validators (see WithValidators), the
+// request is conditional and a 304 response yields ErrNotModified.
+func (h *HTTPClient) Pull(ctx context.Context, reference string) (v1.Descriptor, io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reference, nil)
+	if err != nil {
+		return v1.Descriptor{}, nil, fmt.Errorf("failed to create HTTP request for %s: %w", reference, err)
+	}
+	httpClient := *h.httpClient
+	if withoutCredentials(ctx) {
+		httpClient.CheckRedirect = sameHostRedirect
+	} else {
+		httpClient.CheckRedirect = authRedirect
+		setAuthorization(req)
+	}
+	if v := validators(ctx); v != nil {
+		if etag := v[cache.AnnotationETag]; etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := v[cache.AnnotationLastModified]; modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
 	}
 
-	// Read body using named return variable so defer CloseErr can override
-	data, err = io.ReadAll(resp.Body)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read HTTP response body for %s: %w", reference, err)
+		return v1.Descriptor{}, nil, fmt.Errorf("failed to fetch %s: %w", reference, err)
+	}
+	if resp.StatusCode == http.StatusNotModified && validators(ctx) != nil {
+		_ = resp.Body.Close()
+		return v1.Descriptor{}, nil, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return v1.Descriptor{}, nil, fmt.Errorf("unexpected status code %d when fetching %s", resp.StatusCode, reference)
 	}
 
-	return
+	desc := v1.Descriptor{MediaType: cache.FileMediaType, Digest: digest.Digest(cache.PinnedDigest(reference))}
+	if resp.ContentLength > 0 {
+		desc.Size = resp.ContentLength
+	}
+	annotations := map[string]string{}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		annotations[cache.AnnotationETag] = etag
+	}
+	if modified := resp.Header.Get("Last-Modified"); modified != "" {
+		annotations[cache.AnnotationLastModified] = modified
+	}
+	if len(annotations) > 0 {
+		desc.Annotations = annotations
+	}
+	if rep := progress.FromContext(ctx); rep != nil {
+		return desc, rep.Start(req.URL.Host+req.URL.Path, desc.Size).Reader(resp.Body), nil
+	}
+	return desc, resp.Body, nil
+}
+
+// authRedirect is the http.Client CheckRedirect function for requests made
+// with credentials. It follows at most 10 redirects, and strips the custom
+// token headers set by setAuthorization from redirects that leave the host
+// of the original request, as net/http only strips Authorization itself.
+func authRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		authHeaders.Range(func(name, _ any) bool {
+			req.Header.Del(name.(string))
+			return true
+		})
+	}
+	return nil
+}
+
+// sameHostRedirect is an http.Client CheckRedirect function that follows at
+// most 10 redirects, all on the host of the original request.
+func sameHostRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("refusing redirect from %s to %s", via[0].URL.Host, req.URL.Host)
+	}
+	return nil
 }
@@ -0,0 +1,370 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package client
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	oras "oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+// LayoutClient implements Client for oci-layout://<path>[:<tag>|@<digest>]
+// references, reading and writing artifacts in an on-disk OCI image layout.
+// Layout paths ending in ".tar" are tarballs of a layout; they can be read
+// directly and written as the destination of a copy.
+type LayoutClient struct {
+	cfg *config.Config
+}
+
+// NewLayoutClient returns a new LayoutClient using the provided configuration.
+func NewLayoutClient(cfg *config.Config) Client {
+	return &LayoutClient{cfg: cfg}
+}
+
+// Login is not supported for LayoutClient as layouts are plain directories.
+func (c *LayoutClient) Login(ctx context.Context, registry, user, pass string) error {
+	return fmt.Errorf("login is not supported for OCI layout references")
+}
+
+// Push packs the local file at path as a Remake artifact and stores it in the
+// layout directory under the reference tag, creating the layout if needed.
+// It returns the descriptor of the stored manifest.
+func (c *LayoutClient) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if isTarball(l.Path) {
+		return v1.Descriptor{}, fmt.Errorf("pushing to tarball layouts is not supported: %s", l.Path)
+	}
+	store, err := oci.New(l.Path)
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("opening OCI layout %s: %w", l.Path, err)
+	}
+
+	fs, manifestDesc, err := packFile(ctx, path)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	defer func() { _ = fs.Close() }()
+
+	_ = fs.Tag(ctx, manifestDesc, l.Reference)
+	if _, err := copyFunc(ctx, fs, l.Reference, store, l.Reference, oras.DefaultCopyOptions); err != nil {
+		return v1.Descriptor{}, fmt.Errorf("writing to OCI layout: %w", err)
+	}
+	return manifestDesc, nil
+}
+
+// Pull returns a reader for the first layer of the artifact stored in the
+// layout under the reference tag or digest.
+func (c *LayoutClient) Pull(ctx context.Context, reference string) (v1.Descriptor, io.ReadCloser, error) {
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	store, err := openLayout(ctx, l.Path)
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	manifestDesc, err := store.Resolve(ctx, l.Reference)
+	if err != nil {
+		return v1.Descriptor{}, nil, fmt.Errorf("resolving %s: %w", reference, err)
+	}
+	return fetchLayer(ctx, store, manifestDesc, reference)
+}
+
+// Copy transfers an artifact between any combination of registries and
+// layouts; see copyArtifact.
+func (c *LayoutClient) Copy(ctx context.Context, src, dst string) error {
+	return copyArtifact(ctx, c.cfg, src, dst)
+}
+
+// Delete removes the manifest behind reference from the layout directory.
+func (c *LayoutClient) Delete(ctx context.Context, reference string) error {
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return err
+	}
+	store, err := oci.New(l.Path)
+	if err != nil {
+		return fmt.Errorf("opening OCI layout %s: %w", l.Path, err)
+	}
+	desc, err := store.Resolve(ctx, l.Reference)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", reference, err)
+	}
+	return store.Delete(ctx, desc)
+}
+
+// Untag removes the tag in reference from the layout index.
+func (c *LayoutClient) Untag(ctx context.Context, reference string) error {
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return err
+	}
+	store, err := oci.New(l.Path)
+	if err != nil {
+		return fmt.Errorf("opening OCI layout %s: %w", l.Path, err)
+	}
+	return store.Untag(ctx, l.Reference)
+}
+
+// LayoutBlobPath returns the path of the Makefile layer of the artifact that
+// reference points to inside a layout directory, so it can be used in place
+// without copying it into the cache.
+func LayoutBlobPath(ctx context.Context, reference string) (string, error) {
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return "", err
+	}
+	if isTarball(l.Path) {
+		return "", fmt.Errorf("cannot use tarball layout %s directly; import it first", l.Path)
+	}
+	store, err := oci.NewFromFS(ctx, os.DirFS(l.Path))
+	if err != nil {
+		return "", fmt.Errorf("opening OCI layout %s: %w", l.Path, err)
+	}
+	manifestDesc, err := store.Resolve(ctx, l.Reference)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", reference, err)
+	}
+	manifestBytes, err := contentFetcher(ctx, store, manifestDesc)
+	if err != nil {
+		return "", err
+	}
+	var manifest v1.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return "", err
+	}
+	if len(manifest.Layers) == 0 {
+		return "", fmt.Errorf("no layers found in artifact %s", reference)
+	}
+	dig := manifest.Layers[0].Digest
+	return filepath.Join(l.Path, "blobs", dig.Algorithm().String(), dig.Encoded()), nil
+}
+
+// copyArtifact transfers the artifact at src to dst, where each side is
+// either an OCI registry reference or an OCI layout reference. The manifest
+// is copied verbatim together with its referrers, so the digest, annotations
+// and attached signatures are preserved.
+func copyArtifact(ctx context.Context, cfg *config.Config, src, dst string) error {
+	srcTarget, srcRef, err := readTarget(ctx, cfg, src)
+	if err != nil {
+		return err
+	}
+	dstTarget, dstRef, commit, cleanup, err := writeTarget(ctx, cfg, dst)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if _, err := extendedCopy(ctx, srcTarget, srcRef, dstTarget, dstRef, oras.DefaultExtendedCopyOptions); err != nil {
+		return fmt.Errorf("copying %s to %s: %w", src, dst, err)
+	}
+	return commit()
+}
+
+// readTarget opens the source side of a copy.
+func readTarget(ctx context.Context, cfg *config.Config, reference string) (oras.ReadOnlyGraphTarget, string, error) {
+	if !strings.HasPrefix(reference, config.LayoutScheme) {
+		repo, ref, err := (&OCIClient{cfg: cfg}).repository(ctx, reference)
+		if err != nil {
+			return nil, "", err
+		}
+		return repo, ref.Identifier(), nil
+	}
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return nil, "", err
+	}
+	store, err := openLayout(ctx, l.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	return store, l.Reference, nil
+}
+
+// writeTarget opens the destination side of a copy. The returned commit
+// function must be called once the copy succeeded; for tarball layouts it
+// archives the staged layout directory into the tarball. The returned
+// cleanup function must be called in all cases once the copy is over.
+// Tarball layouts are staged with the artifacts the tarball already holds,
+// so that writing to it adds to them.
+func writeTarget(ctx context.Context, cfg *config.Config, reference string) (oras.Target, string, func() error, func(), error) {
+	noop := func() error { return nil }
+	if !strings.HasPrefix(reference, config.LayoutScheme) {
+		repo, ref, err := (&OCIClient{cfg: cfg}).repository(ctx, reference)
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+		return repo, ref.Identifier(), noop, func() {}, nil
+	}
+	l, err := config.ParseLayoutReference(reference)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if !isTarball(l.Path) {
+		store, err := oci.New(l.Path)
+		if err != nil {
+			return nil, "", nil, nil, fmt.Errorf("opening OCI layout %s: %w", l.Path, err)
+		}
+		return store, l.Reference, noop, func() {}, nil
+	}
+
+	staging, err := os.MkdirTemp("", "remake-layout-")
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(staging) }
+	store, err := oci.New(staging)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, nil, err
+	}
+	if _, err := os.Stat(l.Path); err == nil {
+		if err := seedLayout(ctx, l.Path, store); err != nil {
+			cleanup()
+			return nil, "", nil, nil, err
+		}
+	}
+	commit := func() error {
+		return writeTarball(staging, l.Path)
+	}
+	return store, l.Reference, commit, cleanup, nil
+}
+
+// seedLayout copies every tagged artifact of the layout tarball at path into
+// dst, together with its referrers.
+func seedLayout(ctx context.Context, path string, dst oras.Target) error {
+	src, err := oci.NewFromTar(ctx, path)
+	if err != nil {
+		return fmt.Errorf("opening OCI layout %s: %w", path, err)
+	}
+	var tags []string
+	if err := src.Tags(ctx, "", func(page []string) error {
+		tags = append(tags, page...)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("reading tags of %s: %w", path, err)
+	}
+	for _, tag := range tags {
+		if _, err := oras.ExtendedCopy(ctx, src, tag, dst, tag, oras.DefaultExtendedCopyOptions); err != nil {
+			return fmt.Errorf("reading %s from %s: %w", tag, path, err)
+		}
+	}
+	return nil
+}
+
+// openLayout opens a layout directory or tarball for reading.
+func openLayout(ctx context.Context, path string) (oras.ReadOnlyGraphTarget, error) {
+	var (
+		store oras.ReadOnlyGraphTarget
+		err   error
+	)
+	if isTarball(path) {
+		store, err = oci.NewFromTar(ctx, path)
+	} else {
+		store, err = oci.NewFromFS(ctx, os.DirFS(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening OCI layout %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// isTarball reports whether a layout path names a tarball instead of a directory.
+func isTarball(path string) bool {
+	return strings.HasSuffix(path, ".tar")
+}
+
+// writeTarball archives the contents of dir into a tar file at path. The
+// archive is written next to path and renamed into place, so path is left
+// untouched on failure.
+func writeTarball(dir, path string) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), path)
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || p == dir {
+			return walkErr
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = src.Close() }()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,120 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package client
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcPath allows tests to point netrc lookups at a fixture file.
+var netrcPath = func() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcCredentials returns the login and password for host from the user's
+// netrc file. Entries for a specific machine take precedence over a
+// 'default' entry. ok is false when no file or matching entry exists.
+func netrcCredentials(host string) (login, password string, ok bool) {
+	path := netrcPath()
+	if path == "" {
+		return "", "", false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", false
+	}
+	defer func() { _ = f.Close() }()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Macro definitions run until the next blank line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, fields[i])
+		}
+	}
+
+	type entry struct{ login, password string }
+	var (
+		current  *entry
+		matched  *entry
+		fallback *entry
+	)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			current = &entry{}
+			if i+1 < len(tokens) {
+				i++
+				if tokens[i] == host && matched == nil {
+					matched = current
+				}
+			}
+		case "default":
+			current = &entry{}
+			if fallback == nil {
+				fallback = current
+			}
+		case "login", "password", "account":
+			if current == nil || i+1 >= len(tokens) {
+				continue
+			}
+			i++
+			if tokens[i-1] == "login" {
+				current.login = tokens[i]
+			} else if tokens[i-1] == "password" {
+				current.password = tokens[i]
+			}
+		}
+	}
+	if matched == nil {
+		matched = fallback
+	}
+	if matched == nil {
+		return "", "", false
+	}
+	return matched.login, matched.password, true
+}
@@ -25,6 +25,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -34,12 +38,13 @@ import (
 	oras "oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/content/file"
-	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/content/oci"
 	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
-	"oras.land/oras-go/v2/registry/remote/retry"
 
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/cache"
+	"github.com/TrianaLab/remake/internal/makefile"
 )
 
 // These vars allows us to override functions in tests.
@@ -48,14 +53,22 @@ var (
 	newFileStore   = file.New
 	packManifest   = oras.PackManifest
 	copyFunc       = oras.Copy
+	extendedCopy   = oras.ExtendedCopy
 	contentFetcher = content.FetchAll
 	absPathFunc    = filepath.Abs
+	blobFetcher    = func(ctx context.Context, f content.Fetcher, desc v1.Descriptor) (io.ReadCloser, error) {
+		return f.Fetch(ctx, desc)
+	}
 )
 
 // OCIClient provides an implementation of Client for OCI registries.
 // It uses oras and go-containerregistry to authenticate, push, and pull artifacts.
 type OCIClient struct {
 	cfg *config.Config
+
+	// mirror is the URL of a cache server to pull through (see
+	// NewMirrorClient), or empty to use the artifact's own registry.
+	mirror string
 }
 
 // NewOCIClient returns a new OCIClient initialized with the given configuration.
@@ -63,6 +76,33 @@ func NewOCIClient(cfg *config.Config) Client {
 	return &OCIClient{cfg: cfg}
 }
 
+// NewMirrorClient returns an OCIClient that pulls artifacts through the cache
+// server at mirror, which serves them under MirrorRepository names with the
+// registry API. Manifests and blobs are copied verbatim, so artifacts keep
+// the digest they have in their registry. Credentials configured for the
+// server host are used.
+func NewMirrorClient(cfg *config.Config, mirror string) Client {
+	return &OCIClient{cfg: cfg, mirror: mirror}
+}
+
+// MirrorRepository returns the repository under which a cache server serves
+// repository of registry, e.g. "localhost_5000/org/make" for
+// localhost:5000/org/make. Ports are joined with '_', as repository names
+// cannot hold ':'.
+func MirrorRepository(registry, repository string) string {
+	return strings.ReplaceAll(registry, ":", "_") + "/" + repository
+}
+
+// ParseMirrorRepository splits a repository name built by MirrorRepository
+// into the registry and the repository in it.
+func ParseMirrorRepository(mirrored string) (registry, repository string, err error) {
+	registry, repository, ok := strings.Cut(mirrored, "/")
+	if !ok || registry == "" || repository == "" {
+		return "", "", fmt.Errorf("invalid mirrored repository %s", mirrored)
+	}
+	return strings.ReplaceAll(registry, "_", ":"), repository, nil
+}
+
 // Login authenticates to the specified OCI registry using the provided credentials.
 // Successful login is persisted in the configuration file for future operations.
 func (c *OCIClient) Login(ctx context.Context, registry, user, pass string) error {
@@ -71,7 +111,7 @@ func (c *OCIClient) Login(ctx context.Context, registry, user, pass string) erro
 		return err
 	}
 	clientAuth := &auth.Client{
-		Client:     retry.DefaultClient,
+		Client:     registryClient(c.cfg),
 		Cache:      auth.NewCache(),
 		Credential: auth.StaticCredential(registry, auth.Credential{Username: user, Password: pass}),
 	}
@@ -87,123 +127,305 @@ func (c *OCIClient) Login(ctx context.Context, registry, user, pass string) erro
 
 // Push uploads the local file at path as an OCI artifact to the given reference.
 // It tags the artifact with the reference identifier and pushes it to the remote repository.
-func (c *OCIClient) Push(ctx context.Context, reference, path string) error {
-	// Validate and parse reference
-	if strings.Contains(reference, "://") && !strings.HasPrefix(reference, "oci://") {
-		return fmt.Errorf("invalid OCI reference: %s", reference)
-	}
-	raw := strings.ToLower(strings.TrimPrefix(reference, "oci://"))
-	ref, err := name.ParseReference(raw, name.WithDefaultRegistry(c.cfg.DefaultRegistry))
+// The pushed manifest is also written to the cache layout on a best-effort basis.
+// The returned descriptor is that of the pushed manifest.
+func (c *OCIClient) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
+	repo, ref, err := c.repository(ctx, reference)
 	if err != nil {
-		return err
+		return v1.Descriptor{}, err
 	}
-	repoRef := ref.Context()
 
-	repo, err := newRepository(repoRef.RegistryStr() + "/" + repoRef.RepositoryStr())
+	fs, manifestDesc, err := packFile(ctx, path)
 	if err != nil {
-		return err
+		return v1.Descriptor{}, err
 	}
+	defer func() { _ = fs.Close() }()
 
-	// Authenticate if credentials present
-	key := config.NormalizeKey(repoRef.RegistryStr())
-	user := viper.GetString("registries." + key + ".username")
-	pass := viper.GetString("registries." + key + ".password")
-	if user != "" {
-		repo.Client = &auth.Client{
-			Client:     retry.DefaultClient,
-			Cache:      auth.NewCache(),
-			Credential: auth.StaticCredential(repoRef.RegistryStr(), auth.Credential{Username: user, Password: pass}),
+	tag := ref.Identifier()
+	_ = fs.Tag(ctx, manifestDesc, tag)
+
+	// Push to remote using injected function
+	dst, opts := withProgress(ctx, repo, oras.DefaultCopyOptions)
+	if _, err := copyFunc(ctx, fs, tag, dst, tag, opts); err != nil {
+		return v1.Descriptor{}, fmt.Errorf("pushing to remote: %w", err)
+	}
+	if c.cfg.CacheDir != "" {
+		if cacheTag, err := cache.LayoutTag(c.cfg, reference); err == nil {
+			_ = cache.SaveToLayout(ctx, c.cfg, fs, tag, cacheTag)
 		}
 	}
+	return manifestDesc, nil
+}
 
-	// Resolve absolute path and split directory
-	absPath, err := absPathFunc(path)
+// Pull downloads the artifact data for the given reference from the OCI registry.
+// It retrieves the manifest and returns the contents of the first layer (Makefile data).
+// The manifest and its blobs are copied verbatim into the cache layout, so the
+// cached artifact keeps the digest it has in the registry. Manifests and
+// blobs larger than cfg.MaxArtifactSize are refused before they are fetched.
+func (c *OCIClient) Pull(ctx context.Context, reference string) (v1.Descriptor, io.ReadCloser, error) {
+	repo, ref, err := c.repository(ctx, reference)
 	if err != nil {
-		return fmt.Errorf("failed to resolve absolute path %s: %w", path, err)
+		return v1.Descriptor{}, nil, err
 	}
-	dir := filepath.Dir(absPath)
 
-	// Prepare a file store rooted at the file's directory
-	fs, err := newFileStore(dir)
+	store, cleanup, err := c.pullStore()
 	if err != nil {
-		return fmt.Errorf("creating file store: %w", err)
+		return v1.Descriptor{}, nil, err
 	}
-	defer func() { _ = fs.Close() }()
+	dst, opts := withProgress(ctx, store, oras.DefaultCopyOptions)
+	opts = withSizeLimit(opts, c.cfg.MaxArtifactSize)
+	manifestDesc, err := copyFunc(ctx, repo, ref.Identifier(), dst, ref.Identifier(), opts)
+	if err != nil {
+		cleanup()
+		return v1.Descriptor{}, nil, err
+	}
+	layerDesc, rc, err := fetchLayer(ctx, store, manifestDesc, reference)
+	if err != nil {
+		cleanup()
+		return v1.Descriptor{}, nil, err
+	}
+	if c.cfg.CacheDir != "" {
+		tag, err := cache.LayoutTag(c.cfg, reference)
+		if err == nil {
+			err = cache.TagLayout(ctx, c.cfg, manifestDesc, tag)
+		}
+		if err != nil {
+			_ = rc.Close()
+			return v1.Descriptor{}, nil, err
+		}
+	}
+	return layerDesc, &cleanupReader{ReadCloser: rc, cleanup: cleanup}, nil
+}
 
-	// Add the file using its absolute path to ensure tests find it
-	mediaType := "application/vnd.remake.file"
-	fileDesc, err := fs.Add(ctx, absPath, mediaType, "")
+// pullStore returns the OCI layout that pulled artifacts are streamed into:
+// the cache layout, or a temporary layout removed by cleanup when caching
+// is disabled. Either way blobs go straight to disk rather than memory.
+func (c *OCIClient) pullStore() (*oci.Store, func(), error) {
+	if c.cfg.CacheDir != "" {
+		store, err := cache.StagingLayout(c.cfg)
+		return store, func() {}, err
+	}
+	dir, err := os.MkdirTemp("", "remake-pull-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	store, err := oci.New(dir)
 	if err != nil {
-		return fmt.Errorf("adding file to store: %w", err)
+		cleanup()
+		return nil, nil, err
 	}
+	return store, cleanup, nil
+}
 
-	// Pack manifest using injected function
-	artifactType := "application/vnd.remake.artifact"
-	opts := oras.PackManifestOptions{Layers: []v1.Descriptor{fileDesc}}
-	manifestDesc, err := packManifest(ctx, fs, oras.PackManifestVersion1_1, artifactType, opts)
+// cleanupReader is an io.ReadCloser that calls cleanup once closed.
+type cleanupReader struct {
+	io.ReadCloser
+	cleanup func()
+}
+
+// Close closes the underlying reader and then calls cleanup.
+func (r *cleanupReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.cleanup()
+	return err
+}
+
+// Copy transfers the artifact at src to dst directly between the two remote
+// repositories, without staging it on the local filesystem. The manifest is
+// copied verbatim, so digest and annotations are preserved, and any referrers
+// of the artifact (signatures, SBOMs, attestations) are copied along with it.
+// Either side may also be an oci-layout:// reference.
+func (c *OCIClient) Copy(ctx context.Context, src, dst string) error {
+	return copyArtifact(ctx, c.cfg, src, dst)
+}
+
+// Delete resolves reference to its manifest digest and deletes that manifest
+// from the registry through the manifest-delete API.
+func (c *OCIClient) Delete(ctx context.Context, reference string) error {
+	repo, ref, err := c.repository(ctx, reference)
 	if err != nil {
-		return fmt.Errorf("packing manifest: %w", err)
+		return err
 	}
-	if manifestDesc.Digest.String() == "" {
-		return fmt.Errorf("invalid manifest descriptor: empty digest")
+	desc, err := repo.Resolve(ctx, ref.Identifier())
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", reference, err)
 	}
+	if err := repo.Delete(ctx, desc); err != nil {
+		return fmt.Errorf("deleting %s: %w", reference, err)
+	}
+	return nil
+}
 
-	tag := ref.Identifier()
-	_ = fs.Tag(ctx, manifestDesc, tag)
+// Untag removes the tag in reference by issuing a manifest DELETE against the
+// tag itself, as allowed by the OCI distribution spec. Registries that only
+// accept deletes by digest will reject the request.
+func (c *OCIClient) Untag(ctx context.Context, reference string) (err error) {
+	repo, ref, err := c.repository(ctx, reference)
+	if err != nil {
+		return err
+	}
+	if _, ok := ref.(name.Digest); ok {
+		return fmt.Errorf("cannot untag digest reference %s", reference)
+	}
+	repoRef := ref.Context()
+	endpoint := fmt.Sprintf("%s://%s/v2/%s/manifests/%s",
+		repoRef.Scheme(), repoRef.RegistryStr(), repoRef.RepositoryStr(), ref.Identifier())
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
 
-	// Push to remote using injected function
-	if _, err := copyFunc(ctx, fs, tag, repo, tag, oras.DefaultCopyOptions); err != nil {
-		return fmt.Errorf("pushing to remote: %w", err)
+	client := repo.Client
+	if client == nil {
+		client = auth.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("untagging %s: %w", reference, err)
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d when untagging %s", resp.StatusCode, reference)
 	}
 	return nil
 }
 
-// Pull downloads the artifact data for the given reference from the OCI registry.
-// It retrieves the manifest and returns the contents of the first layer (Makefile data).
-func (c *OCIClient) Pull(ctx context.Context, reference string) ([]byte, error) {
+// withSizeLimit returns opts with a PreCopy hook that refuses any manifest or
+// blob larger than limit before it is downloaded. Zero means no limit.
+func withSizeLimit(opts oras.CopyOptions, limit int64) oras.CopyOptions {
+	if limit <= 0 {
+		return opts
+	}
+	preCopy := opts.PreCopy
+	opts.PreCopy = func(ctx context.Context, desc v1.Descriptor) error {
+		if desc.Size > limit {
+			return fmt.Errorf("%s of %d bytes exceeds maxArtifactSize of %d bytes", desc.Digest, desc.Size, limit)
+		}
+		if preCopy != nil {
+			return preCopy(ctx, desc)
+		}
+		return nil
+	}
+	return opts
+}
+
+// repository parses an OCI reference and returns the remote repository it
+// points to, authenticated with any credentials stored for its registry
+// unless ctx was marked by WithoutCredentials.
+func (c *OCIClient) repository(ctx context.Context, reference string) (*remote.Repository, name.Reference, error) {
 	if strings.Contains(reference, "://") && !strings.HasPrefix(reference, "oci://") {
-		return nil, fmt.Errorf("invalid OCI reference: %s", reference)
+		return nil, nil, fmt.Errorf("invalid OCI reference: %s", reference)
 	}
 	raw := strings.ToLower(strings.TrimPrefix(reference, "oci://"))
 	ref, err := name.ParseReference(raw, name.WithDefaultRegistry(c.cfg.DefaultRegistry))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	repoRef := ref.Context()
-	repo, err := newRepository(repoRef.RegistryStr() + "/" + repoRef.RepositoryStr())
+	host, repository := repoRef.RegistryStr(), repoRef.RepositoryStr()
+	plainHTTP := false
+	if c.mirror != "" {
+		u, err := url.Parse(c.mirror)
+		if err != nil || u.Host == "" {
+			return nil, nil, fmt.Errorf("invalid cache server URL %s", c.mirror)
+		}
+		host, repository, plainHTTP = u.Host, MirrorRepository(host, repository), u.Scheme == "http"
+	}
+	repo, err := newRepository(host + "/" + repository)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if plainHTTP {
+		// Cache servers given as http:// URLs are served over plain HTTP
+		repo.PlainHTTP = true
 	}
-	key := config.NormalizeKey(repoRef.RegistryStr())
+
+	key := config.NormalizeKey(host)
 	user := viper.GetString("registries." + key + ".username")
 	pass := viper.GetString("registries." + key + ".password")
-	if user != "" || pass != "" {
-		repo.Client = &auth.Client{Client: retry.DefaultClient, Cache: auth.NewCache(),
-			Credential: auth.StaticCredential(repoRef.RegistryStr(), auth.Credential{Username: user, Password: pass})}
+	client := &auth.Client{Client: registryClient(c.cfg), Cache: auth.NewCache()}
+	if (user != "" || pass != "") && !withoutCredentials(ctx) {
+		client.Credential = auth.StaticCredential(host, auth.Credential{Username: user, Password: pass})
+	}
+	repo.Client = client
+	c.cfg.Log().Info("resolved reference", "reference", reference, "repository", repoRef.Name(),
+		"identifier", ref.Identifier(), "plainHTTP", repo.PlainHTTP, "credentials", client.Credential != nil)
+	return repo, ref, nil
+}
+
+// packFile adds the file at path to a file store rooted at its directory and
+// packs a Remake artifact manifest around it. The caller must close the store.
+func packFile(ctx context.Context, path string) (*file.Store, v1.Descriptor, error) {
+	// Resolve absolute path and split directory
+	absPath, err := absPathFunc(path)
+	if err != nil {
+		return nil, v1.Descriptor{}, fmt.Errorf("failed to resolve absolute path %s: %w", path, err)
 	}
+	dir := filepath.Dir(absPath)
 
-	store := memory.New()
-	manifestDesc, err := copyFunc(ctx, repo, ref.Identifier(), store, ref.Identifier(), oras.DefaultCopyOptions)
+	// Prepare a file store rooted at the file's directory
+	fs, err := newFileStore(dir)
 	if err != nil {
-		return nil, err
+		return nil, v1.Descriptor{}, fmt.Errorf("creating file store: %w", err)
 	}
 
+	// Add the file using its absolute path to ensure tests find it
+	fileDesc, err := fs.Add(ctx, absPath, cache.FileMediaType, "")
+	if err != nil {
+		_ = fs.Close()
+		return nil, v1.Descriptor{}, fmt.Errorf("adding file to store: %w", err)
+	}
+
+	// Pack manifest using injected function, declaring the make version
+	// and container image the Makefile requires, if any
+	opts := oras.PackManifestOptions{Layers: []v1.Descriptor{fileDesc}}
+	annotations := map[string]string{}
+	if version, err := makefile.RequiredMakeVersion(absPath); err == nil && version != "" {
+		annotations[makefile.AnnotationRequiresMake] = version
+	}
+	if image, err := makefile.Image(absPath); err == nil && image != "" {
+		annotations[makefile.AnnotationImage] = image
+	}
+	if len(annotations) > 0 {
+		opts.ManifestAnnotations = annotations
+	}
+	manifestDesc, err := packManifest(ctx, fs, oras.PackManifestVersion1_1, cache.ArtifactType, opts)
+	if err != nil {
+		_ = fs.Close()
+		return nil, v1.Descriptor{}, fmt.Errorf("packing manifest: %w", err)
+	}
+	if manifestDesc.Digest.String() == "" {
+		_ = fs.Close()
+		return nil, v1.Descriptor{}, fmt.Errorf("invalid manifest descriptor: empty digest")
+	}
+	return fs, manifestDesc, nil
+}
+
+// fetchLayer reads the manifest described by manifestDesc from store and
+// returns the descriptor of its first layer (the Makefile data) along with a
+// reader for it.
+func fetchLayer(ctx context.Context, store content.Fetcher, manifestDesc v1.Descriptor, reference string) (v1.Descriptor, io.ReadCloser, error) {
 	manifestBytes, err := contentFetcher(ctx, store, manifestDesc)
 	if err != nil {
-		return nil, err
+		return v1.Descriptor{}, nil, err
 	}
 	var manifest v1.Manifest
 	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
-		return nil, err
+		return v1.Descriptor{}, nil, err
 	}
 	if len(manifest.Layers) == 0 {
-		return nil, fmt.Errorf("no layers found in artifact %s", reference)
+		return v1.Descriptor{}, nil, fmt.Errorf("no layers found in artifact %s", reference)
 	}
-
-	layerDesc := manifest.Layers[0]
-	data, err := contentFetcher(ctx, store, layerDesc)
+	rc, err := blobFetcher(ctx, store, manifest.Layers[0])
 	if err != nil {
-		return nil, err
+		return v1.Descriptor{}, nil, err
 	}
-	return data, nil
+	return manifest.Layers[0], rc, nil
 }
@@ -0,0 +1,134 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/TrianaLab/remake/internal/progress"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	oras "oras.land/oras-go/v2"
+)
+
+// withProgress arranges for the blobs oras copies into dst to be reported to
+// the progress reporter in ctx, if any. The PreCopy and PostCopy hooks of
+// opts start and finish a transfer for each layer, blobs dst already has are
+// reported as skipped, and the returned target counts the bytes pushed.
+// Manifests and empty configs are too small to be worth reporting.
+func withProgress(ctx context.Context, dst oras.Target, opts oras.CopyOptions) (oras.Target, oras.CopyOptions) {
+	rep := progress.FromContext(ctx)
+	if rep == nil {
+		return dst, opts
+	}
+	target := &progressTarget{Target: dst, transfers: map[digest.Digest]*progress.Transfer{}}
+	opts.PreCopy = func(ctx context.Context, desc v1.Descriptor) error {
+		if reported(desc) {
+			target.set(desc.Digest, rep.Start(blobName(desc), desc.Size))
+		}
+		return nil
+	}
+	opts.PostCopy = func(ctx context.Context, desc v1.Descriptor) error {
+		target.set(desc.Digest, nil).Finish(nil)
+		return nil
+	}
+	opts.OnCopySkipped = func(ctx context.Context, desc v1.Descriptor) error {
+		if reported(desc) {
+			rep.Skip(blobName(desc), desc.Size)
+		}
+		return nil
+	}
+	return target, opts
+}
+
+// progressTarget is an oras.Target that records the bytes of each blob
+// pushed to it in the transfer started for the blob by withProgress.
+type progressTarget struct {
+	oras.Target
+
+	mu        sync.Mutex
+	transfers map[digest.Digest]*progress.Transfer
+}
+
+// set records t as the transfer of the blob with digest d and returns the
+// transfer it replaces. A nil t removes the blob's transfer.
+func (p *progressTarget) set(d digest.Digest, t *progress.Transfer) *progress.Transfer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev := p.transfers[d]
+	if t == nil {
+		delete(p.transfers, d)
+	} else {
+		p.transfers[d] = t
+	}
+	return prev
+}
+
+// Push pushes the blob to the wrapped target, counting the bytes read from r.
+func (p *progressTarget) Push(ctx context.Context, desc v1.Descriptor, r io.Reader) error {
+	p.mu.Lock()
+	t := p.transfers[desc.Digest]
+	p.mu.Unlock()
+	if t != nil {
+		r = &countingReader{r: r, t: t}
+	}
+	return p.Target.Push(ctx, desc, r)
+}
+
+// countingReader records the bytes read from r in a transfer; unlike
+// progress.Transfer.Reader it leaves finishing the transfer to PostCopy.
+type countingReader struct {
+	r io.Reader
+	t *progress.Transfer
+}
+
+// Read reads from the wrapped reader and records the bytes read.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.t.Add(int64(n))
+	return n, err
+}
+
+// reported reports whether copies of desc are shown as progress.
+func reported(desc v1.Descriptor) bool {
+	switch desc.MediaType {
+	case v1.MediaTypeImageManifest, v1.MediaTypeImageIndex, v1.MediaTypeEmptyJSON:
+		return false
+	}
+	return true
+}
+
+// blobName returns the name shown for a blob: the base name of its title
+// annotation, set to the file path when pushing, or its digest shortened to
+// 12 hex digits.
+func blobName(desc v1.Descriptor) string {
+	if title := desc.Annotations[v1.AnnotationTitle]; title != "" {
+		return filepath.Base(title)
+	}
+	if enc := desc.Digest.Encoded(); len(enc) > 12 {
+		return desc.Digest.Algorithm().String() + ":" + enc[:12]
+	}
+	return desc.Digest.String()
+}
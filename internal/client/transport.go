@@ -0,0 +1,112 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/redact"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// sensitiveHeaders are headers whose values are never logged.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// authHeaders holds the names of the custom headers setAuthorization sends
+// tokens in (the 'header' registry setting), whose values are never logged
+// whatever they are called.
+var authHeaders sync.Map
+
+// loggingTransport is an http.RoundTripper that logs every request and
+// response at debug level, with credentials redacted.
+type loggingTransport struct {
+	base http.RoundTripper
+	log  *slog.Logger
+}
+
+// RoundTrip logs req, sends it with the base transport and logs the outcome.
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	target := redact.URL(req.URL)
+	t.log.Debug("http request", "method", req.Method, "url", target, "headers", redactHeaders(req.Header))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.log.Debug("http request failed", "method", req.Method, "url", target, "error", err)
+		return nil, err
+	}
+	t.log.Debug("http response", "method", req.Method, "url", target, "status", resp.Status,
+		"duration", time.Since(start), "headers", redactHeaders(resp.Header))
+	return resp, nil
+}
+
+// httpClient returns base with its transport wrapped in a loggingTransport
+// when cfg logs at debug level, and base itself otherwise.
+func httpClient(cfg *config.Config, base *http.Client) *http.Client {
+	log := cfg.Log()
+	if !log.Enabled(context.Background(), slog.LevelDebug) {
+		return base
+	}
+	transport := base.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client := *base
+	client.Transport = &loggingTransport{base: transport, log: log}
+	return &client
+}
+
+// registryClient returns the HTTP client used for registry requests: the
+// oras retrying client, which logs every attempt when debug logging is on.
+func registryClient(cfg *config.Config) *http.Client {
+	if !cfg.Log().Enabled(context.Background(), slog.LevelDebug) {
+		return retry.DefaultClient
+	}
+	transport := &loggingTransport{base: http.DefaultTransport, log: cfg.Log()}
+	return &http.Client{Transport: retry.NewTransport(transport)}
+}
+
+// redactHeaders returns h as a flat map for logging, with the values of
+// credentials replaced.
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		canonical := http.CanonicalHeaderKey(name)
+		_, auth := authHeaders.Load(canonical)
+		if sensitiveHeaders[canonical] || auth || redact.IsSensitive(name) {
+			out[name] = redact.Redacted
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
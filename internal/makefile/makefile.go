@@ -0,0 +1,277 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+// Package makefile reads the metadata Remake understands from Makefiles.
+package makefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AnnotationRequiresMake is the manifest annotation holding the minimum GNU
+// make version an artifact needs, e.g. "4.3". Pushes set it from the
+// Makefile's requires comment (see RequiredMakeVersion).
+const AnnotationRequiresMake = "dev.remake.requires.make"
+
+// AnnotationImage is the manifest annotation holding the container image an
+// artifact runs in, e.g. "golang:1.24". Pushes set it from the Makefile's
+// image comment (see Image).
+const AnnotationImage = "dev.remake.image"
+
+// requiresPattern matches a "# remake: requires make >= 4.3" comment.
+var requiresPattern = regexp.MustCompile(`^#\s*remake:\s*requires\s+make\s*>=\s*([0-9]+(?:\.[0-9]+)*)\s*$`)
+
+// imagePattern matches a "# remake: image golang:1.24" comment.
+var imagePattern = regexp.MustCompile(`^#\s*remake:\s*image\s+(\S+)\s*$`)
+
+// Target is a target defined by a rule in a Makefile.
+type Target struct {
+	// Name is the target name.
+	Name string
+
+	// Description is the '##' comment documenting the target, if any.
+	Description string
+
+	// Phony reports whether the target is listed as a prerequisite of .PHONY.
+	Phony bool
+}
+
+// Variable is a variable a Makefile assigns with '?=', which can be
+// overridden from the command line or the environment.
+type Variable struct {
+	// Name is the variable name.
+	Name string
+
+	// Default is the value assigned when the variable is not set, unexpanded.
+	Default string
+
+	// Description is the '##' comment documenting the variable, if any.
+	Description string
+}
+
+// Info is what Parse reads from a Makefile.
+type Info struct {
+	// Targets are the targets defined in the Makefile, in order of first
+	// definition. Special targets (such as .PHONY) and pattern rules are
+	// left out.
+	Targets []Target
+
+	// Variables are the variables with '?=' defaults, in order of first
+	// assignment.
+	Variables []Variable
+}
+
+var (
+	// rulePattern matches a rule line, capturing its targets and what
+	// follows the colon, but not variable assignments such as 'A := b'.
+	// Rules whose targets are computed from variables are left out by Parse.
+	rulePattern = regexp.MustCompile(`^([^:=#\t][^:=#]*?)\s*::?((?:[^=:].*)?)$`)
+
+	// defaultPattern matches a '?=' assignment, with an optional trailing
+	// '##' description.
+	defaultPattern = regexp.MustCompile(`^(?:(?:export|override)\s+)*([A-Za-z_][A-Za-z0-9_.-]*)\s*\?=\s*(.*?)\s*(?:##\s*(.*?))?\s*$`)
+)
+
+// Parse reads the targets and overridable variables of the Makefile at path.
+// Descriptions follow the common '## comment' convention: a comment starting
+// with '##' at the end of the rule or assignment line, or on the lines just
+// before it. Lines continued with a trailing backslash are joined, and
+// define blocks and recipe lines are skipped. Makefiles that are included or
+// generated by functions are not followed.
+func Parse(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var (
+		info     Info
+		targets  = map[string]int{}
+		vars     = map[string]bool{}
+		phony    = map[string]bool{}
+		comment  []string
+		line     string
+		inDefine bool
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		line, text = "", line+text
+
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case inDefine:
+			inDefine = trimmed != "endef"
+			continue
+		case strings.HasPrefix(text, "\t"):
+			continue
+		case strings.HasPrefix(trimmed, "##"):
+			comment = append(comment, strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			continue
+		case strings.HasPrefix(trimmed, "define ") || strings.Contains(trimmed, " define "):
+			inDefine = true
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		default:
+			description := strings.Join(comment, " ")
+			if m := defaultPattern.FindStringSubmatch(trimmed); m != nil {
+				if !vars[m[1]] {
+					vars[m[1]] = true
+					if m[3] != "" {
+						description = m[3]
+					}
+					info.Variables = append(info.Variables, Variable{Name: m[1], Default: m[2], Description: description})
+				}
+			} else if m := rulePattern.FindStringSubmatch(trimmed); m != nil && !strings.Contains(m[1], "$") {
+				rest, lineDescription, _ := strings.Cut(m[2], "##")
+				if lineDescription = strings.TrimSpace(lineDescription); lineDescription != "" {
+					description = lineDescription
+				}
+				for _, name := range strings.Fields(m[1]) {
+					if name == ".PHONY" {
+						for _, p := range strings.Fields(rest) {
+							phony[p] = true
+						}
+						continue
+					}
+					if (strings.HasPrefix(name, ".") && strings.ToUpper(name) == name) || strings.Contains(name, "%") {
+						continue
+					}
+					if i, ok := targets[name]; ok {
+						if info.Targets[i].Description == "" {
+							info.Targets[i].Description = description
+						}
+						continue
+					}
+					targets[name] = len(info.Targets)
+					info.Targets = append(info.Targets, Target{Name: name, Description: description})
+				}
+			}
+		}
+		comment = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return Info{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for i := range info.Targets {
+		info.Targets[i].Phony = phony[info.Targets[i].Name]
+	}
+	return info, nil
+}
+
+// databaseRulePattern matches a rule in the database printed by 'make -p'.
+var databaseRulePattern = regexp.MustCompile(`^([^#\t%=.:][^:=]*?)::?(?:[^=]|$)`)
+
+// DatabaseTargets returns the targets in the database printed by
+// 'make -pRrq', which unlike Parse includes targets from included Makefiles
+// and computed names. Special targets, pattern rules and files make only
+// considered (such as the Makefile itself) are left out. Targets are sorted,
+// as make prints them in no particular order.
+func DatabaseTargets(r io.Reader) ([]string, error) {
+	var (
+		targets   []string
+		seen      = map[string]bool{}
+		inFiles   bool
+		notTarget bool
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "# Files":
+			inFiles = true
+		case strings.HasPrefix(line, "# Finished Make data base"):
+			inFiles = false
+		case !inFiles:
+		case line == "# Not a target:":
+			notTarget = true
+			continue
+		default:
+			if m := databaseRulePattern.FindStringSubmatch(line); m != nil && !notTarget {
+				for _, name := range strings.Fields(m[1]) {
+					if !seen[name] && !strings.Contains(name, "%") {
+						seen[name] = true
+						targets = append(targets, name)
+					}
+				}
+			}
+		}
+		notTarget = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading make database: %w", err)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// RequiredMakeVersion returns the minimum GNU make version declared in the
+// Makefile at path with a comment line such as
+//
+//	# remake: requires make >= 4.3
+//
+// or "" when it declares none.
+func RequiredMakeVersion(path string) (string, error) {
+	return directive(path, requiresPattern)
+}
+
+// Image returns the container image the Makefile at path declares it runs
+// in with a comment line such as
+//
+//	# remake: image golang:1.24
+//
+// or "" when it declares none.
+func Image(path string) (string, error) {
+	return directive(path, imagePattern)
+}
+
+// directive returns the first submatch of pattern on a line of the Makefile
+// at path, or "" when no line matches.
+func directive(path string, pattern *regexp.Regexp) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if m := pattern.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	return "", nil
+}
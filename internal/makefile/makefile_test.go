@@ -0,0 +1,192 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package makefile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequiredMakeVersion(t *testing.T) {
+	tests := map[string]string{
+		"# remake: requires make >= 4.3\nall:\n": "4.3",
+		"all:\n#remake:requires make>=3.82\n":    "3.82",
+		"# requires make >= 4.3\nall:\n":         "",
+		"all:\n\t@echo ok\n":                     "",
+	}
+	dir := t.TempDir()
+	for content, want := range tests {
+		path := filepath.Join(dir, "Makefile")
+		_ = os.WriteFile(path, []byte(content), 0o644)
+		got, err := RequiredMakeVersion(path)
+		if err != nil {
+			t.Fatalf("RequiredMakeVersion error: %v", err)
+		}
+		if got != want {
+			t.Errorf("RequiredMakeVersion(%q) = %q, want %q", content, got, want)
+		}
+	}
+
+	if _, err := RequiredMakeVersion(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestImage(t *testing.T) {
+	tests := map[string]string{
+		"# remake: image golang:1.24\nall:\n":                 "golang:1.24",
+		"all:\n#remake:image ghcr.io/org/tools@sha256:abc \n": "ghcr.io/org/tools@sha256:abc",
+		"# remake: image\nall:\n":                             "",
+		"# image golang:1.24\nall:\n":                         "",
+	}
+	dir := t.TempDir()
+	for content, want := range tests {
+		path := filepath.Join(dir, "Makefile")
+		_ = os.WriteFile(path, []byte(content), 0o644)
+		got, err := Image(path)
+		if err != nil {
+			t.Fatalf("Image error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Image(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Makefile")
+	content := `# Redis helpers
+REDIS_PORT ?= 6379 ## Port Redis listens on
+## Redis image tag
+REDIS_VERSION ?= 7
+IMAGE := redis:$(REDIS_VERSION)
+A ::= b
+export PASSWORD ?=
+
+.PHONY: up down \
+	logs
+
+define HELP
+usage: make up
+endef
+
+## Start Redis
+up:
+	docker run -p $(REDIS_PORT):6379 $(IMAGE)
+
+down: ## Stop Redis
+	docker stop redis
+
+logs down:
+	docker logs redis
+
+%.o: %.c
+	cc -c $<
+
+$(BIN): main.go
+	go build
+
+dump.rdb: up
+	touch $@
+`
+	_ = os.WriteFile(path, []byte(content), 0o644)
+	info, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	wantTargets := []Target{
+		{Name: "up", Description: "Start Redis", Phony: true},
+		{Name: "down", Description: "Stop Redis", Phony: true},
+		{Name: "logs", Phony: true},
+		{Name: "dump.rdb"},
+	}
+	if len(info.Targets) != len(wantTargets) {
+		t.Fatalf("expected targets %+v, got %+v", wantTargets, info.Targets)
+	}
+	for i, want := range wantTargets {
+		if info.Targets[i] != want {
+			t.Errorf("expected target %+v, got %+v", want, info.Targets[i])
+		}
+	}
+
+	wantVars := []Variable{
+		{Name: "REDIS_PORT", Default: "6379", Description: "Port Redis listens on"},
+		{Name: "REDIS_VERSION", Default: "7", Description: "Redis image tag"},
+		{Name: "PASSWORD"},
+	}
+	if len(info.Variables) != len(wantVars) {
+		t.Fatalf("expected variables %+v, got %+v", wantVars, info.Variables)
+	}
+	for i, want := range wantVars {
+		if info.Variables[i] != want {
+			t.Errorf("expected variable %+v, got %+v", want, info.Variables[i])
+		}
+	}
+
+	if _, err := Parse(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestDatabaseTargets(t *testing.T) {
+	db := `# GNU Make 4.3
+hey
+# Variables
+
+X = 1
+MAKEFILE_LIST :=  Makefile
+
+# Files
+
+# Not a target:
+Makefile:
+#  Implicit rule search has been done.
+
+up: down
+#  Phony target (prerequisite of .PHONY).
+	true
+
+::
+
+.PHONY: up
+
+%.o: %.c
+	cc -c $<
+
+down:
+	true
+
+up: extra
+
+# Finished Make data base on Mon Jan  1 00:00:00 2024
+`
+	targets, err := DatabaseTargets(strings.NewReader(db))
+	if err != nil {
+		t.Fatalf("DatabaseTargets error: %v", err)
+	}
+	if got := strings.Join(targets, " "); got != "down up" {
+		t.Errorf("expected targets 'down up', got %q", got)
+	}
+}
@@ -0,0 +1,264 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+// Package progress reports the progress of artifact transfers: a status line
+// with a bar, rate and ETA that is redrawn in place on terminals, and plain
+// lines suitable for CI logs otherwise.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// ttyInterval is how often the status line is redrawn on a terminal.
+	ttyInterval = 100 * time.Millisecond
+
+	// lineInterval is how often a progress line is printed otherwise.
+	lineInterval = 5 * time.Second
+
+	// barWidth is the number of cells in the progress bar.
+	barWidth = 20
+)
+
+// Reporter writes progress for transfers to a terminal or log. A nil
+// *Reporter is valid and reports nothing, so callers need not check for one.
+type Reporter struct {
+	w        io.Writer
+	tty      bool
+	interval time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+// New returns a Reporter writing to w, which is treated as a terminal if it
+// is a file connected to one.
+func New(w io.Writer) *Reporter {
+	tty := false
+	if f, ok := w.(*os.File); ok {
+		tty = term.IsTerminal(int(f.Fd()))
+	}
+	r := &Reporter{w: w, tty: tty, interval: lineInterval, now: time.Now}
+	if tty {
+		r.interval = ttyInterval
+	}
+	return r
+}
+
+type contextKey struct{}
+
+// WithReporter returns a copy of ctx carrying r.
+func WithReporter(ctx context.Context, r *Reporter) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the Reporter carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Reporter {
+	r, _ := ctx.Value(contextKey{}).(*Reporter)
+	return r
+}
+
+// Transfer tracks the progress of a single blob or file. A nil *Transfer is
+// valid and ignores all updates.
+type Transfer struct {
+	r     *Reporter
+	name  string
+	total int64
+
+	mu       sync.Mutex
+	current  int64
+	start    time.Time
+	lastDraw time.Time
+	finished bool
+}
+
+// Start begins reporting a transfer of total bytes named name. A total of
+// zero or less means the size is unknown.
+func (r *Reporter) Start(name string, total int64) *Transfer {
+	if r == nil {
+		return nil
+	}
+	now := r.now()
+	t := &Transfer{r: r, name: name, total: total, start: now, lastDraw: now}
+	if !r.tty {
+		r.printf("%s: started (%s)\n", name, formatTotal(total))
+	}
+	return t
+}
+
+// Skip reports that a transfer of total bytes named name was not needed
+// because the destination already has the data.
+func (r *Reporter) Skip(name string, total int64) {
+	if r == nil {
+		return
+	}
+	r.printf("%s%s: already exists (%s)\n", r.clear(), name, formatTotal(total))
+}
+
+// Add records n more bytes transferred and redraws the progress if it was
+// last drawn long enough ago.
+func (t *Transfer) Add(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current += n
+	now := t.r.now()
+	if t.finished || now.Sub(t.lastDraw) < t.r.interval {
+		return
+	}
+	t.lastDraw = now
+	if t.r.tty {
+		t.r.printf("\r\x1b[K%s", t.status(now))
+	} else {
+		t.r.printf("%s\n", t.status(now))
+	}
+}
+
+// Finish reports the transfer as done, or as failed if err is not nil.
+// Calls after the first are ignored.
+func (t *Transfer) Finish(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return
+	}
+	t.finished = true
+	elapsed := t.r.now().Sub(t.start).Round(100 * time.Millisecond)
+	if err != nil {
+		t.r.printf("%s%s: failed after %s: %v\n", t.r.clear(), t.name, formatBytes(t.current), err)
+		return
+	}
+	t.r.printf("%s%s: done %s in %s\n", t.r.clear(), t.name, formatBytes(t.current), elapsed)
+}
+
+// Reader returns a reader that records the bytes read from rd in t. The
+// transfer finishes when rd returns io.EOF or an error, or when the reader
+// is closed; closing also closes rd if it is an io.Closer.
+func (t *Transfer) Reader(rd io.Reader) io.ReadCloser {
+	return &reader{rd: rd, t: t}
+}
+
+// reader is the io.ReadCloser returned by Transfer.Reader.
+type reader struct {
+	rd io.Reader
+	t  *Transfer
+}
+
+// Read reads from the wrapped reader and records the bytes read.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	r.t.Add(int64(n))
+	switch {
+	case err == io.EOF:
+		r.t.Finish(nil)
+	case err != nil:
+		r.t.Finish(err)
+	}
+	return n, err
+}
+
+// Close finishes the transfer and closes the wrapped reader.
+func (r *reader) Close() error {
+	var err error
+	if c, ok := r.rd.(io.Closer); ok {
+		err = c.Close()
+	}
+	r.t.Finish(nil)
+	return err
+}
+
+// status returns the progress line of t: bytes transferred, rate and, when
+// the total is known, a bar, percentage and ETA.
+func (t *Transfer) status(now time.Time) string {
+	elapsed := now.Sub(t.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(t.current) / elapsed
+	}
+	var b strings.Builder
+	b.WriteString(t.name)
+	b.WriteString(": ")
+	if t.total > 0 {
+		done := min(t.current, t.total)
+		filled := int(done * barWidth / t.total)
+		fmt.Fprintf(&b, "[%s%s] %3d%% ", strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), done*100/t.total)
+		fmt.Fprintf(&b, "%s/%s", formatBytes(t.current), formatBytes(t.total))
+	} else {
+		b.WriteString(formatBytes(t.current))
+	}
+	fmt.Fprintf(&b, " %s/s", formatBytes(int64(rate)))
+	if t.total > 0 && rate > 0 {
+		eta := time.Duration(float64(t.total-min(t.current, t.total)) / rate * float64(time.Second))
+		fmt.Fprintf(&b, " ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+// printf writes a formatted message, serializing concurrent transfers.
+func (r *Reporter) printf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintf(r.w, format, args...)
+}
+
+// clear returns the sequence that erases the status line on a terminal.
+func (r *Reporter) clear() string {
+	if r.tty {
+		return "\r\x1b[K"
+	}
+	return ""
+}
+
+// formatTotal formats a transfer size, which may be unknown.
+func formatTotal(total int64) string {
+	if total <= 0 {
+		return "unknown size"
+	}
+	return formatBytes(total)
+}
+
+// formatBytes formats n bytes with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
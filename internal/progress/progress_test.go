@@ -0,0 +1,151 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package progress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestReporter returns a Reporter writing to buf whose clock advances by
+// step on every reading.
+func newTestReporter(buf *bytes.Buffer, tty bool, step time.Duration) *Reporter {
+	now := time.Unix(0, 0)
+	r := &Reporter{w: buf, tty: tty, interval: time.Second, now: func() time.Time {
+		now = now.Add(step)
+		return now
+	}}
+	return r
+}
+
+func TestReporterLines(t *testing.T) {
+	var buf bytes.Buffer
+	r := newTestReporter(&buf, false, time.Second)
+	tr := r.Start("layer", 4096)
+	tr.Add(1024)
+	tr.Add(1024)
+	tr.Finish(nil)
+	tr.Finish(nil)
+	r.Skip("cached", 10)
+
+	want := []string{
+		"layer: started (4.0 KiB)",
+		"layer: [=====               ]  25% 1.0 KiB/4.0 KiB 1.0 KiB/s ETA 3s",
+		"layer: [==========          ]  50% 2.0 KiB/4.0 KiB 1.0 KiB/s ETA 2s",
+		"layer: done 2.0 KiB in 3s",
+		"cached: already exists (10 B)",
+	}
+	if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReporterTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	r := newTestReporter(&buf, true, 2*time.Second)
+	tr := r.Start("make.mk", 0)
+	tr.Add(2048)
+	tr.Finish(errors.New("boom"))
+
+	out := buf.String()
+	if strings.Contains(out, "started") {
+		t.Errorf("expected no start line on a terminal, got %q", out)
+	}
+	if !strings.HasPrefix(out, "\r\x1b[Kmake.mk: 2.0 KiB 1.0 KiB/s") {
+		t.Errorf("expected status line redrawn in place, got %q", out)
+	}
+	if !strings.HasSuffix(out, "\r\x1b[Kmake.mk: failed after 2.0 KiB: boom\n") {
+		t.Errorf("expected failure line, got %q", out)
+	}
+}
+
+func TestReporterThrottles(t *testing.T) {
+	var buf bytes.Buffer
+	r := newTestReporter(&buf, false, time.Millisecond)
+	tr := r.Start("layer", 100)
+	for i := 0; i < 100; i++ {
+		tr.Add(1)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+		t.Errorf("expected only the start line, got %d lines:\n%s", lines, buf.String())
+	}
+}
+
+func TestReaderFinishes(t *testing.T) {
+	var buf bytes.Buffer
+	r := newTestReporter(&buf, false, time.Millisecond)
+	rc := r.Start("blob", 5).Reader(strings.NewReader("hello"))
+	data, err := io.ReadAll(rc)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("unexpected read %q: %v", data, err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if got := strings.Count(buf.String(), "blob: done 5 B"); got != 1 {
+		t.Errorf("expected one done line, got:\n%s", buf.String())
+	}
+}
+
+func TestNilReporter(t *testing.T) {
+	if r := FromContext(context.Background()); r != nil {
+		t.Fatalf("expected no reporter, got %v", r)
+	}
+	var r *Reporter
+	tr := r.Start("x", 1)
+	tr.Add(1)
+	tr.Finish(nil)
+	r.Skip("x", 1)
+	data, err := io.ReadAll(tr.Reader(strings.NewReader("ok")))
+	if err != nil || string(data) != "ok" {
+		t.Errorf("unexpected read %q: %v", data, err)
+	}
+
+	r = New(&bytes.Buffer{})
+	if r.tty {
+		t.Error("expected a buffer not to be treated as a terminal")
+	}
+	if got := FromContext(WithReporter(context.Background(), r)); got != r {
+		t.Errorf("expected reporter from context, got %v", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:                      "0 B",
+		1023:                   "1023 B",
+		1536:                   "1.5 KiB",
+		5 << 20:                "5.0 MiB",
+		3 << 30:                "3.0 GiB",
+		int64(1.5 * (1 << 40)): "1.5 TiB",
+	}
+	for n, want := range cases {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
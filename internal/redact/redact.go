@@ -0,0 +1,77 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+// Package redact removes credentials from URLs, references and HTTP headers
+// before they are logged.
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secret header and query values in logs.
+const Redacted = "REDACTED"
+
+// sensitiveWords mark header and query parameter names, such as
+// PRIVATE-TOKEN or X-Amz-Signature, whose values are never logged.
+var sensitiveWords = []string{"token", "secret", "password", "signature", "credential", "key"}
+
+// URL returns u as a string with its password and the values of sensitive
+// query parameters (e.g., presigned URL signatures) replaced.
+func URL(u *url.URL) string {
+	clean := *u
+	if clean.RawQuery != "" {
+		query := clean.Query()
+		for name := range query {
+			if IsSensitive(name) {
+				query[name] = []string{Redacted}
+			}
+		}
+		clean.RawQuery = query.Encode()
+	}
+	return clean.Redacted()
+}
+
+// Reference returns reference with the credentials of HTTP and git+ URLs
+// removed as URL does. Other references are returned unchanged.
+func Reference(reference string) string {
+	raw, prefix := reference, ""
+	if strings.HasPrefix(raw, "git+") {
+		raw, prefix = strings.TrimPrefix(raw, "git+"), "git+"
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.User == nil && u.RawQuery == "") {
+		return reference
+	}
+	return prefix + URL(u)
+}
+
+// IsSensitive reports whether a header or parameter name suggests a secret.
+func IsSensitive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, word := range sensitiveWords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+// ContainerRuntimes are the container CLIs looked up in PATH, in order, when
+// no 'containerRuntime' is configured. Podman comes first, as it is the one
+// the make-podman catalog entry installs.
+var ContainerRuntimes = []string{"podman", "docker"}
+
+// containerRuntime returns the path of the configured container CLI, or of
+// the first of ContainerRuntimes found in PATH.
+func containerRuntime(cfg *config.Config) (string, error) {
+	names := ContainerRuntimes
+	if cfg != nil && cfg.ContainerRuntime != "" {
+		names = []string{cfg.ContainerRuntime}
+	}
+	for _, name := range names {
+		if bin, err := exec.LookPath(name); err == nil {
+			return bin, nil
+		}
+	}
+	return "", fmt.Errorf("container runtime %s not found: install podman (e.g., with 'remake run -f ghcr.io/trianalab/make-podman install') or docker, or set 'containerRuntime' in the config file", strings.Join(names, " or "))
+}
+
+// containerArgs returns the arguments of the container CLI at runtime that
+// run a command in image, up to and including the image. The Makefile and
+// dir are bind-mounted at the same paths, the Makefile read-only and dir
+// as the working directory, read-write unless readOnly is set, and env is
+// set in the container.
+// With sb, the container has no network unless allowed and a read-only root
+// file system with a private /tmp, and the sb.Env variables are passed
+// through from the environment of the runtime.
+// Paths containing a comma are rejected, as --mount options are separated by
+// commas.
+func containerArgs(runtime, image, makefile, dir string, readOnly bool, env []string, sb *config.Sandbox) ([]string, error) {
+	for _, path := range []string{makefile, dir} {
+		if strings.Contains(path, ",") {
+			return nil, fmt.Errorf("cannot mount %s into a container: the path contains a comma", path)
+		}
+	}
+	mount := "type=bind,source=" + dir + ",target=" + dir
+	if readOnly {
+		mount += ",readonly"
+	}
+	args := []string{"run", "--rm",
+		"--mount", "type=bind,source=" + makefile + ",target=" + makefile + ",readonly",
+		"--mount", mount,
+		"--workdir", dir,
+	}
+	if strings.HasPrefix(filepath.Base(runtime), "docker") && os.Getuid() >= 0 {
+		// files make creates in dir would otherwise belong to root; rootless
+		// podman maps root in the container to the user already
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	for _, kv := range env {
+		args = append(args, "--env", kv)
+	}
+	if sb != nil {
+		if !sb.Network {
+			args = append(args, "--network", "none")
+		}
+		args = append(args, "--read-only", "--tmpfs", "/tmp")
+		for _, name := range sb.Env {
+			args = append(args, "--env", name)
+		}
+	}
+	return append(args, image), nil
+}
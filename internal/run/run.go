@@ -22,23 +22,80 @@
 package run
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/TrianaLab/remake/config"
+	"github.com/TrianaLab/remake/internal/makefile"
 )
 
+// Job describes one invocation of make.
+type Job struct {
+	// Makefile is the path of the Makefile to run.
+	Makefile string
+
+	// Reference is the reference the Makefile was resolved from; it is the
+	// same as Makefile for local files.
+	Reference string
+
+	// Digest is the digest of the Makefile content, if known.
+	Digest string
+
+	// Remote reports whether Makefile is a cached copy of a remote
+	// artifact, in which case it is run under a name derived from Reference
+	// rather than its cache file name.
+	Remote bool
+
+	// Workdir is the directory make runs in. Empty means the current
+	// directory.
+	Workdir string
+
+	// MakeFlags are passed to make before the targets.
+	MakeFlags []string
+
+	// Vars are passed to make as command-line variables, after MakeFlags.
+	// When a name is assigned more than once, the last assignment wins.
+	Vars []Var
+
+	// Targets are the make targets to build.
+	Targets []string
+
+	// Sandbox, when set, runs make confined to the workdir with the given
+	// settings (see sandboxCommand).
+	Sandbox *config.Sandbox
+
+	// Image is the container image make runs in, e.g. "golang:1.24". When
+	// empty, the image declared by an image comment in the Makefile, if
+	// any, is used instead, and otherwise make runs on the host.
+	Image string
+
+	// DryRun prints the make command line instead of running it, followed by
+	// the recipes make would run as shown by 'make -n'.
+	DryRun bool
+
+	// MinMakeVersion is the minimum GNU make version declared by the
+	// artifact's annotations, e.g. "4.3". When empty, the version declared
+	// by a requires comment in the Makefile, if any, is used instead.
+	MinMakeVersion string
+}
+
 // Runner defines the interface for executing Makefile targets.
-// Implementations of Runner take a path to a Makefile, flags for make,
-// and target names to execute.
 type Runner interface {
-	// Run executes the provided make targets using the Makefile at path.
-	// makeFlags are passed to the make command, and targets specify which targets to run.
-	Run(ctx context.Context, path string, makeFlags, targets []string) error
+	// Run executes the make invocation described by job.
+	Run(ctx context.Context, job Job) error
 }
 
-// ExecRunner is the default Runner implementation that invokes the system 'make' command.
+// ExecRunner is the default Runner implementation that invokes the system 'make' command,
+// or the one configured with 'makeBinary'.
 // It constructs the command line to include the '-f' flag for the Makefile path, any
 // additional flags, and the specified targets. Standard output and error are forwarded.
 type ExecRunner struct {
@@ -46,23 +103,346 @@ type ExecRunner struct {
 }
 
 // New returns a Runner implementation based on the given configuration.
-// Currently, it returns an ExecRunner that runs the 'make' binary.
+// Currently, it returns an ExecRunner that runs the configured make binary.
 func New(cfg *config.Config) Runner {
 	return &ExecRunner{cfg: cfg}
 }
 
-// Run executes the make command with the specified Makefile path, flags, and targets.
-// It builds arguments as: make -f <path> <makeFlags...> <targets...>.
-// The command's stdout and stderr are connected to the current process.
-func (r *ExecRunner) Run(ctx context.Context, path string, makeFlags, targets []string) error {
+// Run executes the make command with the Makefile, flags, and targets of job.
+// It builds arguments as: make -f <path> <makeFlags...> <vars...> <targets...>,
+// run in job.Workdir. Remote Makefiles are first materialized under a meaningful
+// name (see Materialize), so that $(MAKEFILE_LIST) reads naturally. The
+// REMAKE_REF, REMAKE_DIGEST and REMAKE_CACHE_DIR variables are exported to make.
+// The values of secret variables are masked in the logged command line.
+// The make binary must exist and, when the artifact or Makefile declares a
+// minimum version, be GNU make of at least that version.
+// The command's stdout and stderr are connected to the current process, except
+// that with JSON output make's stdout goes to stderr to keep stdout parseable.
+// With job.DryRun, the command line and directory are printed and make runs
+// with -n, which prints recipes without running them. As make still runs
+// recipe lines prefixed with '+' or using $(MAKE), as well as $(shell) calls
+// made while reading the Makefile, dry runs of remote Makefiles are always
+// sandboxed, and sandboxed dry runs have no network and a read-only workdir.
+// Where no sandbox is available, the command line is still printed but make
+// does not run, with a warning.
+// With job.Sandbox, make runs in Linux namespaces where only the workdir is
+// writable, the network is unshared unless allowed, and only the allowlisted
+// environment variables are set (see DefaultSandboxEnv).
+// With an image, make runs in a container started with the configured
+// container CLI, podman or docker, where the Makefile and the workdir are
+// bind-mounted at the same paths (see containerArgs); sandbox settings then
+// apply to the container.
+func (r *ExecRunner) Run(ctx context.Context, job Job) error {
+	path := job.Makefile
+	if job.Remote {
+		materialized, err := Materialize(r.cfg, job)
+		if err != nil {
+			return err
+		}
+		path = materialized
+	}
+	image := job.Image
+	if image == "" {
+		var err error
+		if image, err = makefile.Image(path); err != nil {
+			return err
+		}
+	}
+	if job.Sandbox != nil || image != "" {
+		// the Makefile is mounted into the sandbox or container at the same path
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	if job.Workdir != "" {
+		info, err := os.Stat(job.Workdir)
+		if err != nil {
+			return fmt.Errorf("invalid workdir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid workdir: %s is not a directory", job.Workdir)
+		}
+		// make resolves -f relative to the directory it runs in
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	// Images bring their own make, which cannot be checked up front
+	bin := config.DefaultMakeBinary
+	if image == "" {
+		minVersion := job.MinMakeVersion
+		var err error
+		if minVersion == "" {
+			if minVersion, err = makefile.RequiredMakeVersion(path); err != nil {
+				return err
+			}
+		}
+		if bin, err = r.makeBinary(ctx, minVersion); err != nil {
+			return err
+		}
+	}
+
 	// Build make command arguments
 	args := []string{"-f", path}
-	args = append(args, makeFlags...)
-	args = append(args, targets...)
+	args = append(args, job.MakeFlags...)
+	vars := mergeVars(job.Vars)
+	for _, v := range vars {
+		args = append(args, v.String())
+	}
+	args = append(args, job.Targets...)
+
+	// make -n still runs $(shell) calls, '+' recipe lines and $(MAKE), so
+	// dry runs are sandboxed without network and with a read-only workdir,
+	// and remote Makefiles are never dry-run on the host
+	sandbox := job.Sandbox
+	if job.DryRun && sandbox == nil && job.Remote {
+		sandbox = &config.Sandbox{}
+	} else if job.DryRun && sandbox != nil {
+		dry := *sandbox
+		dry.Network = false
+		sandbox = &dry
+	}
+
+	// In an image, make is run by the container CLI
+	name, prefix := bin, []string(nil)
+	if image != "" {
+		runtime, err := containerRuntime(r.cfg)
+		if err != nil {
+			return err
+		}
+		dir, err := sandboxDir(job.Workdir)
+		if err != nil {
+			return err
+		}
+		runArgs, err := containerArgs(runtime, image, path, dir, job.DryRun, Env(r.cfg, job), sandbox)
+		if err != nil {
+			return err
+		}
+		name, prefix = runtime, append(runArgs, bin)
+	}
+
+	var stdout io.Writer = os.Stdout
+	if r.cfg != nil && r.cfg.Output == config.OutputJSON {
+		stdout = os.Stderr
+	}
+	command := maskedCommand(name, append(append([]string{}, prefix...), args...), vars)
+	if job.DryRun {
+		args = append([]string{args[0], args[1], "-n"}, args[2:]...)
+	}
 
-	// Execute 'make' with context
-	cmd := exec.CommandContext(ctx, "make", args...)
-	cmd.Stdout = os.Stdout
+	// Execute make with context
+	cmd := exec.CommandContext(ctx, name, append(prefix, args...)...)
+	cmd.Dir = job.Workdir
+	cmd.Env = append(os.Environ(), Env(r.cfg, job)...)
+	var unsandboxed error
+	if sandbox != nil && image == "" {
+		dir, err := sandboxDir(job.Workdir)
+		if err != nil {
+			return err
+		}
+		sandboxed, err := sandboxCommand(ctx, bin, args, path, dir, sandboxHidden(r.cfg), job.DryRun, sandbox, os.Stderr)
+		switch {
+		case err == nil:
+			cmd = sandboxed
+			cmd.Env = append(sandboxEnv(os.Environ(), sandbox.Env), Env(r.cfg, job)...)
+		case job.Sandbox == nil:
+			// remote Makefiles are dry-run in a sandbox or not at all
+			unsandboxed = err
+		default:
+			return err
+		}
+	}
+	if job.DryRun {
+		dir := job.Workdir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		_, _ = fmt.Fprintf(stdout, "Command:   %s\nDirectory: %s\n", command, dir)
+		if unsandboxed != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: not running make -n, as it still runs $(shell) calls and '+' recipe lines and remote Makefiles are only dry-run in a sandbox: %v\n", unsandboxed)
+			return nil
+		}
+		_, _ = fmt.Fprintln(stdout, "Recipes (make -n):")
+	}
+	r.cfg.Log().Info("running make", "command", command, "dir", job.Workdir, "dryRun", job.DryRun, "sandbox", sandbox != nil, "image", image)
+	cmd.Stdout = stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// makeBinary returns the path of the configured make binary, checking that
+// it is GNU make of at least minVersion when set.
+func (r *ExecRunner) makeBinary(ctx context.Context, minVersion string) (string, error) {
+	name := binaryName(r.cfg)
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("make binary %q not found: install GNU make, or set 'makeBinary' in the config file or --make to its path (e.g., gmake on BSD and macOS)", name)
+	}
+	if minVersion == "" {
+		return bin, nil
+	}
+	out, err := exec.CommandContext(ctx, bin, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("checking the version of %s: %w", name, err)
+	}
+	m := gnuMakeVersion.FindSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("%s is not GNU make, but the Makefile requires GNU make >= %s", name, minVersion)
+	}
+	if version := string(m[1]); compareVersions(version, minVersion) < 0 {
+		return "", fmt.Errorf("the Makefile requires GNU make >= %s, but %s is version %s", minVersion, name, version)
+	}
+	return bin, nil
+}
+
+// binaryName returns the configured make binary, or DefaultMakeBinary.
+func binaryName(cfg *config.Config) string {
+	if cfg != nil && cfg.MakeBinary != "" {
+		return cfg.MakeBinary
+	}
+	return config.DefaultMakeBinary
+}
+
+// Targets returns the targets make knows for the Makefile at path when run
+// in workdir, including those from included Makefiles, by reading the
+// database printed by 'make -pRrq' (see makefile.DatabaseTargets). No
+// recipe is run, but the Makefile is read, so its $(shell) calls are.
+func Targets(ctx context.Context, cfg *config.Config, path, workdir string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, binaryName(cfg), "-pRrq", "-f", path, ":")
+	cmd.Dir = workdir
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	// -q exits non-zero as the ':' target is not up to date
+	return makefile.DatabaseTargets(bytes.NewReader(out))
+}
+
+// gnuMakeVersion matches the version in the output of 'make --version'.
+var gnuMakeVersion = regexp.MustCompile(`GNU Make ([0-9]+(?:\.[0-9]+)*)`)
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1 as
+// a is older than, the same as or newer than b. Missing components count as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Env returns the REMAKE_* variables exported to make for job.
+func Env(cfg *config.Config, job Job) []string {
+	cacheDir := ""
+	if cfg != nil {
+		cacheDir = cfg.CacheDir
+	}
+	return []string{
+		"REMAKE_REF=" + job.Reference,
+		"REMAKE_DIGEST=" + job.Digest,
+		"REMAKE_CACHE_DIR=" + cacheDir,
+	}
+}
+
+// Materialize returns the path of a copy of job.Makefile named after
+// job.Reference (see MakefileName), e.g. <cacheDir>/run/<digest>/make-redis.mk.
+// Cache blobs are content addressed, so the copy is made once per digest and
+// hard-linked when possible.
+func Materialize(cfg *config.Config, job Job) (string, error) {
+	if cfg == nil || cfg.CacheDir == "" || job.Digest == "" {
+		return job.Makefile, nil
+	}
+	_, hex, _ := strings.Cut(job.Digest, ":")
+	dir := filepath.Join(cfg.CacheDir, "run", hex)
+	path := filepath.Join(dir, MakefileName(job.Reference))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("materializing Makefile: %w", err)
+	}
+	src, err := filepath.EvalSymlinks(job.Makefile)
+	if err != nil {
+		return "", fmt.Errorf("materializing Makefile: %w", err)
+	}
+	if err := os.Link(src, path); err == nil || os.IsExist(err) {
+		return path, nil
+	}
+	if err := copyFile(src, path); err != nil {
+		return "", fmt.Errorf("materializing Makefile: %w", err)
+	}
+	return path, nil
+}
+
+// copyFile atomically copies src to dst through a temporary file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "materialize.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// unsafeName matches runs of characters not kept in Makefile names.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// MakefileName derives a file name for the Makefile behind reference: the
+// file name of HTTP(S) URLs and git paths, or the repository name of OCI
+// references with ".mk" appended, e.g. "make-redis.mk" for
+// ghcr.io/trianalab/make-redis:latest.
+func MakefileName(reference string) string {
+	name := reference
+	if git, err := config.ParseGitReference(reference); err == nil {
+		name = git.Path
+	}
+	if base, _, ok := strings.Cut(name, "#"); ok {
+		name = base
+	}
+	if base, _, ok := strings.Cut(name, "?"); ok {
+		name = base
+	}
+	name = strings.TrimPrefix(name, config.LayoutScheme)
+	name = strings.TrimRight(name, "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	if colon := strings.Index(name, ":"); colon >= 0 {
+		name = name[:colon]
+	}
+	name = strings.Trim(unsafeName.ReplaceAllString(name, "-"), ".-")
+	if name == "" {
+		return "Makefile"
+	}
+	if !strings.EqualFold(name, "makefile") && !strings.EqualFold(name, "gnumakefile") && filepath.Ext(name) == "" {
+		name += ".mk"
+	}
+	return name
+}
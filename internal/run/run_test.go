@@ -22,14 +22,356 @@
 package run
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/TrianaLab/remake/config"
 )
 
 func TestExecRunnerError(t *testing.T) {
 	r := New(nil)
-	err := r.Run(context.Background(), "nonexistent", nil, []string{"all"})
+	err := r.Run(context.Background(), Job{Makefile: "nonexistent", Targets: []string{"all"}})
 	if err == nil {
 		t.Error("expected error for missing file")
 	}
 }
+
+func TestMakefileName(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io/trianalab/make-redis:latest":              "make-redis.mk",
+		"trianalab/make-redis":                             "make-redis.mk",
+		"localhost:5000/team/make@sha256:abc":              "make.mk",
+		"https://example.com/ci/go.mk?ref=v1#sha256:abc":   "go.mk",
+		"https://example.com/Makefile":                     "Makefile",
+		"git+https://github.com/org/make.git//ci/go.mk@v1": "go.mk",
+		config.LayoutScheme + "/tmp/layout:v1":             "layout.mk",
+	}
+	for ref, want := range tests {
+		if got := MakefileName(ref); got != want {
+			t.Errorf("MakefileName(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestMaterialize(t *testing.T) {
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	blob := filepath.Join(t.TempDir(), "sha256:abc")
+	_ = os.WriteFile(blob, []byte("all:\n"), 0o644)
+	job := Job{Makefile: blob, Reference: "ghcr.io/org/make-redis:v1", Digest: "sha256:abc"}
+
+	path, err := Materialize(cfg, job)
+	if err != nil {
+		t.Fatalf("Materialize error: %v", err)
+	}
+	if want := filepath.Join(cfg.CacheDir, "run", "abc", "make-redis.mk"); path != want {
+		t.Errorf("expected %s, got %s", want, path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "all:\n" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if again, err := Materialize(cfg, job); err != nil || again != path {
+		t.Errorf("expected the same path again, got %s (%v)", again, err)
+	}
+
+	// without a digest there is nothing to key the copy on
+	job.Digest = ""
+	if path, err := Materialize(cfg, job); err != nil || path != blob {
+		t.Errorf("expected the blob itself, got %s (%v)", path, err)
+	}
+}
+
+func TestExecRunnerWorkdirAndEnv(t *testing.T) {
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make not installed")
+	}
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	blob := filepath.Join(t.TempDir(), "sha256:abc")
+	_ = os.WriteFile(blob, []byte("all:\n\t@echo \"$$REMAKE_REF $$REMAKE_DIGEST $$REMAKE_CACHE_DIR $(notdir $(MAKEFILE_LIST)) $(CURDIR)\" > out.txt\n"), 0o644)
+	workdir := t.TempDir()
+
+	job := Job{Makefile: blob, Reference: "ghcr.io/org/make-redis:v1", Digest: "sha256:abc", Remote: true, Workdir: workdir}
+	if err := New(cfg).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(workdir, "out.txt"))
+	if err != nil {
+		t.Fatalf("expected make to run in the workdir: %v", err)
+	}
+	want := "ghcr.io/org/make-redis:v1 sha256:abc " + cfg.CacheDir + " make-redis.mk " + workdir
+	if strings.TrimSpace(string(out)) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+
+	job.Workdir = filepath.Join(workdir, "out.txt")
+	if err := New(cfg).Run(context.Background(), job); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("expected invalid workdir error, got %v", err)
+	}
+}
+
+// fakeMake writes a make stand-in that prints version for --version and
+// otherwise touches ran in its working directory.
+func fakeMake(t *testing.T, version string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "fakemake")
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo '" + version + "'; exit 0; fi\ntouch ran\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestExecRunnerMakeVersion(t *testing.T) {
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("# remake: requires make >= 4.3\nall:\n"), 0o644)
+	workdir := t.TempDir()
+	ctx := context.Background()
+
+	cfg := &config.Config{MakeBinary: fakeMake(t, "GNU Make 4.4.1")}
+	if err := New(cfg).Run(ctx, Job{Makefile: mk, Workdir: workdir}); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "ran")); err != nil {
+		t.Errorf("expected the configured make binary to run: %v", err)
+	}
+
+	cfg.MakeBinary = fakeMake(t, "GNU Make 4.2.1")
+	if err := New(cfg).Run(ctx, Job{Makefile: mk}); err == nil || !strings.Contains(err.Error(), "requires GNU make >= 4.3") {
+		t.Errorf("expected too old error, got %v", err)
+	}
+	// annotations take precedence over the comment
+	if err := New(cfg).Run(ctx, Job{Makefile: mk, MinMakeVersion: "4.0", Workdir: workdir}); err != nil {
+		t.Errorf("expected annotated version to be satisfied, got %v", err)
+	}
+
+	cfg.MakeBinary = fakeMake(t, "bmake 20240711")
+	if err := New(cfg).Run(ctx, Job{Makefile: mk}); err == nil || !strings.Contains(err.Error(), "is not GNU make") {
+		t.Errorf("expected not GNU make error, got %v", err)
+	}
+
+	cfg.MakeBinary = "remake-missing-make"
+	if err := New(cfg).Run(ctx, Job{Makefile: mk}); err == nil || !strings.Contains(err.Error(), "makeBinary") {
+		t.Errorf("expected missing binary error, got %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"4.3", "4.3", 0},
+		{"4.3", "4.3.0", 0},
+		{"4.2.1", "4.3", -1},
+		{"4.10", "4.9", 1},
+		{"3.81", "4", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseVarAndReadEnvFile(t *testing.T) {
+	if v, err := ParseVar("REDIS_PORT=6380"); err != nil || v != (Var{Name: "REDIS_PORT", Value: "6380"}) {
+		t.Errorf("unexpected var %+v (%v)", v, err)
+	}
+	if v, err := ParseVar("OPTS=a=b"); err != nil || v.Value != "a=b" {
+		t.Errorf("expected the value to keep '=', got %+v (%v)", v, err)
+	}
+	for _, bad := range []string{"PORT", "=1", "-j=4", "A B=1"} {
+		if _, err := ParseVar(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), ".env")
+	_ = os.WriteFile(path, []byte("# credentials\n\nTOKEN=abc\nexport USER='me'\nGREETING=\"hello world\"\n"), 0o644)
+	vars, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile error: %v", err)
+	}
+	want := []Var{{"TOKEN", "abc", true}, {"USER", "me", true}, {"GREETING", "hello world", true}}
+	if len(vars) != len(want) {
+		t.Fatalf("expected %v, got %v", want, vars)
+	}
+	for i := range want {
+		if vars[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], vars[i])
+		}
+	}
+
+	_ = os.WriteFile(path, []byte("TOKEN=abc\nnot a var\n"), 0o644)
+	if _, err := ReadEnvFile(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected error with line number, got %v", err)
+	}
+}
+
+func TestExecRunnerVars(t *testing.T) {
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make not installed")
+	}
+	var logs bytes.Buffer
+	cfg := &config.Config{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("PORT ?= 6379\nall:\n\t@echo \"$(PORT) $(TOKEN)\" > out.txt\n"), 0o644)
+	workdir := t.TempDir()
+
+	job := Job{Makefile: mk, Workdir: workdir, Vars: []Var{
+		{Name: "PORT", Value: "1"},
+		{Name: "TOKEN", Value: "s3cret", Secret: true},
+		{Name: "PORT", Value: "6380"},
+	}}
+	if err := New(cfg).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if out, _ := os.ReadFile(filepath.Join(workdir, "out.txt")); strings.TrimSpace(string(out)) != "6380 s3cret" {
+		t.Errorf("expected the last assignment and the secret to reach make, got %q", out)
+	}
+	if strings.Contains(logs.String(), "s3cret") || !strings.Contains(logs.String(), "TOKEN=***") {
+		t.Errorf("expected the secret to be masked in %q", logs.String())
+	}
+}
+
+func TestTargets(t *testing.T) {
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make not installed")
+	}
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "extra.mk"), []byte("extra:\n\ttrue\n"), 0o644)
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte(".PHONY: up\nup: down\n\ttouch ran\ndown:\n\ttouch ran\ninclude extra.mk\n"), 0o644)
+
+	// included Makefiles are resolved relative to the workdir
+	targets, err := Targets(context.Background(), nil, mk, dir)
+	if err != nil {
+		t.Fatalf("Targets error: %v", err)
+	}
+	if got := strings.Join(targets, " "); got != "down extra up" {
+		t.Errorf("expected targets 'down extra up', got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Error("expected no recipe to run")
+	}
+}
+
+func TestExecRunnerDryRun(t *testing.T) {
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make not installed")
+	}
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("all:\n\ttouch ran\n"), 0o644)
+	workdir := t.TempDir()
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	err := New(nil).Run(context.Background(), Job{Makefile: mk, Workdir: workdir, DryRun: true, Vars: []Var{{Name: "TOKEN", Value: "s3cret", Secret: true}}})
+	_ = w.Close()
+	os.Stdout = old
+	out, _ := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "ran")); err == nil {
+		t.Error("expected the recipe not to run")
+	}
+	for _, want := range []string{"-f " + mk + " TOKEN=***\n", "Directory: " + workdir + "\n", "Recipes (make -n):\ntouch ran\n"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+}
+
+// fakeRuntime writes a container CLI stand-in named name that records its
+// arguments, one per line, in the args file next to it.
+func fakeRuntime(t *testing.T, name string) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, name)
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + filepath.Join(dir, "args") + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestExecRunnerImage(t *testing.T) {
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("# remake: image golang:1.24\nall:\n"), 0o644)
+	workdir := t.TempDir()
+	ctx := context.Background()
+
+	podman := fakeRuntime(t, "podman")
+	cfg := &config.Config{ContainerRuntime: podman, MakeBinary: filepath.Join(t.TempDir(), "missing")}
+	job := Job{Makefile: mk, Reference: mk, Workdir: workdir, Image: "alpine:3", Targets: []string{"all"}, Vars: []Var{{Name: "V", Value: "1"}}}
+	if err := New(cfg).Run(ctx, job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(filepath.Dir(podman), "args"))
+	want := "run\n--rm\n--mount\ntype=bind,source=" + mk + ",target=" + mk + ",readonly\n" +
+		"--mount\ntype=bind,source=" + workdir + ",target=" + workdir + "\n--workdir\n" + workdir + "\n" +
+		"--env\nREMAKE_REF=" + mk + "\n--env\nREMAKE_DIGEST=\n--env\nREMAKE_CACHE_DIR=\n" +
+		"alpine:3\nmake\n-f\n" + mk + "\nV=1\nall\n"
+	if string(args) != want {
+		t.Errorf("expected container arguments %q, got %q", want, args)
+	}
+
+	// the image comment applies without Job.Image, sandbox settings apply
+	// to the container, and docker runs as the current user
+	docker := fakeRuntime(t, "docker")
+	t.Setenv("PATH", filepath.Dir(docker))
+	job.Image, job.Sandbox = "", &config.Sandbox{Env: []string{"GOCACHE"}}
+	if err := New(&config.Config{}).Run(ctx, job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	args, _ = os.ReadFile(filepath.Join(filepath.Dir(docker), "args"))
+	for _, want := range []string{"--user\n", "--network\nnone\n", "--read-only\n--tmpfs\n/tmp\n", "--env\nGOCACHE\ngolang:1.24\nmake\n"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("expected %q in container arguments %q", want, args)
+		}
+	}
+
+	// dry runs get a read-only workdir and no network, even when allowed
+	job.DryRun, job.Sandbox = true, &config.Sandbox{Network: true}
+	if err := New(&config.Config{}).Run(ctx, job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	args, _ = os.ReadFile(filepath.Join(filepath.Dir(docker), "args"))
+	for _, want := range []string{"target=" + workdir + ",readonly\n", "--network\nnone\n", "make\n-f\n" + mk + "\n-n\n"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("expected %q in container arguments %q", want, args)
+		}
+	}
+	job.DryRun = false
+
+	// --mount options are comma-separated, so paths with commas are refused
+	comma := filepath.Join(t.TempDir(), "a,b")
+	if err := os.Mkdir(comma, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	commaJob := job
+	commaJob.Workdir = comma
+	if err := New(&config.Config{}).Run(ctx, commaJob); err == nil || !strings.Contains(err.Error(), "contains a comma") {
+		t.Errorf("expected comma path error, got %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := New(&config.Config{}).Run(ctx, job); err == nil || !strings.Contains(err.Error(), "podman or docker not found") {
+		t.Errorf("expected missing runtime error, got %v", err)
+	}
+}
+
+func TestSandboxEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "AWS_SECRET_ACCESS_KEY=x", "GOCACHE=/c", "HOME=/root"}
+	if got := strings.Join(sandboxEnv(env, []string{"GOCACHE"}), " "); got != "PATH=/bin GOCACHE=/c HOME=/root" {
+		t.Errorf("unexpected sandbox environment %q", got)
+	}
+}
@@ -0,0 +1,100 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+// DefaultSandboxEnv lists the environment variables passed into sandboxed
+// runs, on top of those allowed by config.Sandbox.Env and the REMAKE_*
+// variables.
+var DefaultSandboxEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_ALL", "TERM"}
+
+// sandboxEnv returns the variables of env, in KEY=VALUE form, whose names are
+// in DefaultSandboxEnv or allow.
+func sandboxEnv(env, allow []string) []string {
+	allowed := map[string]bool{}
+	for _, name := range append(DefaultSandboxEnv, allow...) {
+		allowed[name] = true
+	}
+	var filtered []string
+	for _, kv := range env {
+		if name, _, _ := strings.Cut(kv, "="); allowed[name] {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// sandboxDir returns the absolute path of the directory a sandboxed or
+// containerized make runs in, which is the only one it can write to: the
+// workdir, or the current directory.
+func sandboxDir(workdir string) (string, error) {
+	if workdir == "" {
+		return os.Getwd()
+	}
+	return filepath.Abs(workdir)
+}
+
+// sandboxHidden returns the existing directories that sandboxed runs see as
+// empty, as they hold credentials such as ~/.ssh and the Remake
+// configuration: the home directory, and the Remake base, configuration and
+// cache directories wherever they are configured.
+func sandboxHidden(cfg *config.Config) []string {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, home)
+	}
+	if cfg != nil {
+		paths = append(paths, cfg.BaseDir, cfg.CacheDir)
+		if cfg.ConfigFile != "" {
+			paths = append(paths, filepath.Dir(cfg.ConfigFile))
+		}
+	}
+	var hidden []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil || abs == "/" || seen[abs] {
+			continue
+		}
+		if info, err := os.Stat(abs); err == nil && info.IsDir() {
+			seen[abs] = true
+			hidden = append(hidden, abs)
+		}
+	}
+	return hidden
+}
+
+// within reports whether path is dir or lies under it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,109 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+//go:build linux
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+// lookBwrap finds the bubblewrap binary. It is a variable so tests can
+// exercise the fallback.
+var lookBwrap = func() (string, error) {
+	return exec.LookPath("bwrap")
+}
+
+// sandboxCommand returns the command running bin with args confined to dir.
+// With bubblewrap installed, make sees a read-only view of the root file
+// system with a private /tmp, /dev and /proc, and only dir is writable,
+// unless readOnly is set. The hidden directories, such as the home
+// directory, are replaced by empty ones, except for dir, the make binary and
+// the Makefile themselves (see sandboxHidden).
+// Otherwise it fails, unless sb.WritableRoot allows starting the command in
+// new user, mount, PID, IPC and UTS namespaces through SysProcAttr, which
+// cannot make the file system read-only; a warning is then written to
+// stderr. In both cases the network is unshared unless sb.Network is set.
+func sandboxCommand(ctx context.Context, bin string, args []string, makefile, dir string, hidden []string, readOnly bool, sb *config.Sandbox, stderr io.Writer) (*exec.Cmd, error) {
+	bwrap, err := lookBwrap()
+	if err != nil {
+		if !sb.WritableRoot {
+			return nil, fmt.Errorf("sandboxed runs need bwrap (bubblewrap) to make the file system read-only: install it, or set 'writableRoot: true' in the sandbox settings of the reference to run with a writable file system")
+		}
+		_, _ = fmt.Fprintln(stderr, "Warning: bwrap (bubblewrap) not found; the sandbox isolates the network, processes and environment, but not the file system")
+		cmd := exec.CommandContext(ctx, bin, args...)
+		flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		if !sb.Network {
+			flags |= syscall.CLONE_NEWNET
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:  uintptr(flags),
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+			Pdeathsig:   syscall.SIGKILL,
+		}
+		cmd.Dir = dir
+		return cmd, nil
+	}
+
+	bind := "--bind"
+	if readOnly {
+		bind = "--ro-bind"
+	}
+	bwrapArgs := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	}
+	for _, path := range hidden {
+		bwrapArgs = append(bwrapArgs, "--tmpfs", path)
+	}
+	bwrapArgs = append(bwrapArgs, bind, dir, dir)
+	// hidden directories stay hidden when dir contains them
+	for _, path := range hidden {
+		if path != dir && within(path, dir) {
+			bwrapArgs = append(bwrapArgs, "--tmpfs", path)
+		}
+	}
+	bwrapArgs = append(bwrapArgs,
+		// the make binary and Makefile may live under the private /tmp or a
+		// hidden directory
+		"--ro-bind", bin, bin,
+		"--ro-bind", makefile, makefile,
+		"--chdir", dir,
+		"--unshare-pid", "--unshare-ipc", "--unshare-uts",
+		"--die-with-parent",
+	)
+	if !sb.Network {
+		bwrapArgs = append(bwrapArgs, "--unshare-net")
+	}
+	bwrapArgs = append(bwrapArgs, "--", bin)
+	return exec.CommandContext(ctx, bwrap, append(bwrapArgs, args...)...), nil
+}
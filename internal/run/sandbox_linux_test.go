@@ -0,0 +1,196 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+//go:build linux
+
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrianaLab/remake/config"
+)
+
+func TestExecRunnerSandboxBwrap(t *testing.T) {
+	orig := lookBwrap
+	defer func() { lookBwrap = orig }()
+	dir := t.TempDir()
+	bwrap := filepath.Join(dir, "bwrap")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + filepath.Join(dir, "args") + "\nenv > " + filepath.Join(dir, "env") + "\n"
+	_ = os.WriteFile(bwrap, []byte(script), 0o755)
+	lookBwrap = func() (string, error) { return bwrap, nil }
+	t.Setenv("REMAKE_TEST_SECRET", "s3cret")
+	t.Setenv("GOCACHE", "/cache")
+
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("all:\n"), 0o644)
+	workdir := t.TempDir()
+	cfg := &config.Config{MakeBinary: fakeMake(t, "GNU Make 4.4")}
+	job := Job{Makefile: mk, Workdir: workdir, Targets: []string{"all"}, Sandbox: &config.Sandbox{Env: []string{"GOCACHE"}}}
+	if err := New(cfg).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	for _, want := range []string{"--ro-bind\n/\n/\n", "--bind\n" + workdir + "\n" + workdir + "\n", "--unshare-net\n", "--\n" + cfg.MakeBinary + "\n-f\n" + mk + "\nall\n"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("expected %q in bwrap arguments %q", want, args)
+		}
+	}
+	env, _ := os.ReadFile(filepath.Join(dir, "env"))
+	if strings.Contains(string(env), "s3cret") || !strings.Contains(string(env), "GOCACHE=/cache") || !strings.Contains(string(env), "REMAKE_REF=") {
+		t.Errorf("expected only allowlisted variables, got %q", env)
+	}
+
+	job.Sandbox.Network = true
+	if err := New(cfg).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); strings.Contains(string(args), "--unshare-net") {
+		t.Error("expected network access when allowed")
+	}
+}
+
+func TestExecRunnerSandboxHidesHome(t *testing.T) {
+	orig := lookBwrap
+	defer func() { lookBwrap = orig }()
+	dir := t.TempDir()
+	bwrap := filepath.Join(dir, "bwrap")
+	_ = os.WriteFile(bwrap, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+filepath.Join(dir, "args")+"\n"), 0o755)
+	lookBwrap = func() (string, error) { return bwrap, nil }
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	base := filepath.Join(home, ".remake")
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	for _, d := range []string{base, cacheDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mk := filepath.Join(cacheDir, "Makefile")
+	_ = os.WriteFile(mk, []byte("all:\n"), 0o644)
+	cfg := &config.Config{BaseDir: base, ConfigFile: filepath.Join(base, "config.yaml"), CacheDir: cacheDir, MakeBinary: fakeMake(t, "GNU Make 4.4")}
+
+	// the home directory and remake's directories are replaced by empty
+	// ones, and the remake directories stay hidden when the workdir is home
+	job := Job{Makefile: mk, Workdir: home, Sandbox: &config.Sandbox{}}
+	if err := New(cfg).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	want := "--tmpfs\n" + home + "\n--tmpfs\n" + base + "\n--tmpfs\n" + cacheDir + "\n" +
+		"--bind\n" + home + "\n" + home + "\n--tmpfs\n" + base + "\n" +
+		"--ro-bind\n" + cfg.MakeBinary + "\n" + cfg.MakeBinary + "\n--ro-bind\n" + mk + "\n" + mk + "\n"
+	if !strings.Contains(string(args), want) {
+		t.Errorf("expected %q in bwrap arguments %q", want, args)
+	}
+}
+
+func TestExecRunnerDryRunSandbox(t *testing.T) {
+	orig := lookBwrap
+	defer func() { lookBwrap = orig }()
+	dir := t.TempDir()
+	bwrap := filepath.Join(dir, "bwrap")
+	_ = os.WriteFile(bwrap, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+filepath.Join(dir, "args")+"\n"), 0o755)
+	lookBwrap = func() (string, error) { return bwrap, nil }
+
+	blob := filepath.Join(t.TempDir(), "sha256:abc")
+	_ = os.WriteFile(blob, []byte("X := $(shell touch ran)\nall:\n"), 0o644)
+	workdir := t.TempDir()
+	cfg := &config.Config{CacheDir: t.TempDir(), MakeBinary: fakeMake(t, "GNU Make 4.4")}
+	job := Job{Makefile: blob, Reference: "ghcr.io/org/make:v1", Digest: "sha256:abc", Remote: true, Workdir: workdir, DryRun: true}
+
+	// remote Makefiles are dry-run in a sandbox with a read-only workdir
+	if err := New(cfg).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	for _, want := range []string{"--ro-bind\n" + workdir + "\n" + workdir + "\n", "--unshare-net\n", "\n-n\n"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("expected %q in bwrap arguments %q", want, args)
+		}
+	}
+
+	// and never on the host: without a sandbox only the command is printed
+	lookBwrap = func() (string, error) { return "", errors.New("not found") }
+	oldOut, oldErr := os.Stdout, os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stdout, os.Stderr = w, w
+	err := New(cfg).Run(context.Background(), job)
+	_ = w.Close()
+	os.Stdout, os.Stderr = oldOut, oldErr
+	out, _ := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	for _, want := range []string{"Command:   " + cfg.MakeBinary + " -f ", "Directory: " + workdir + "\n", "Warning: not running make -n"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+	if strings.Contains(string(out), "Recipes (make -n)") {
+		t.Errorf("expected no recipes without a sandbox, got %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "ran")); err == nil {
+		t.Error("expected make not to run on the host")
+	}
+}
+
+func TestExecRunnerSandboxNamespaces(t *testing.T) {
+	if _, err := exec.LookPath("make"); err != nil {
+		t.Skip("make not installed")
+	}
+	orig := lookBwrap
+	defer func() { lookBwrap = orig }()
+	lookBwrap = func() (string, error) { return "", errors.New("not found") }
+	t.Setenv("REMAKE_TEST_SECRET", "s3cret")
+
+	mk := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(mk, []byte("all:\n\t@echo \"$$REMAKE_TEST_SECRET\" $$(tail -n +3 /proc/net/dev | cut -d: -f1) > out.txt\n"), 0o644)
+	workdir := t.TempDir()
+	job := Job{Makefile: mk, Workdir: workdir, Sandbox: &config.Sandbox{}}
+	if err := New(nil).Run(context.Background(), job); err == nil || !strings.Contains(err.Error(), "writableRoot") {
+		t.Fatalf("expected sandboxed runs to fail without bwrap, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "out.txt")); err == nil {
+		t.Fatal("expected make not to run")
+	}
+
+	job.Sandbox.WritableRoot = true
+	if err := New(nil).Run(context.Background(), job); err != nil {
+		t.Skipf("user namespaces unavailable: %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(workdir, "out.txt"))
+	if err != nil {
+		t.Fatalf("expected make to write to the workdir: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "lo" {
+		t.Errorf("expected no secret and only the loopback interface, got %q", out)
+	}
+}
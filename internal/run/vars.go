@@ -0,0 +1,136 @@
+// The MIT License (MIT)
+//
+// Copyright © 2025 TrianaLab - Eduardo Diaz <edudiazasencio@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// THE SOFTWARE.
+
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// secretMask replaces the values of secret variables in logged command lines.
+const secretMask = "***"
+
+// Var is a variable passed to make on its command line, which overrides any
+// assignment to it in the Makefile.
+type Var struct {
+	// Name is the variable name.
+	Name string
+
+	// Value is the variable value.
+	Value string
+
+	// Secret marks values that must not be logged, such as those read
+	// from env files.
+	Secret bool
+}
+
+// String returns the NAME=VALUE argument passed to make.
+func (v Var) String() string {
+	return v.Name + "=" + v.Value
+}
+
+// ParseVar parses a KEY=VALUE assignment as given to --set.
+func ParseVar(s string) (Var, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t:#") {
+		return Var{}, fmt.Errorf("invalid variable %q: must be KEY=VALUE", s)
+	}
+	return Var{Name: name, Value: value}, nil
+}
+
+// ReadEnvFile reads variables from a .env file: one KEY=VALUE per line, with
+// an optional 'export ' prefix and optionally quoted values. Blank lines and
+// lines starting with '#' are skipped. The variables are marked secret.
+func ReadEnvFile(path string) ([]Var, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var vars []Var
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := ParseVar(strings.TrimPrefix(line, "export "))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		v.Value = strings.TrimSpace(v.Value)
+		if len(v.Value) >= 2 && (v.Value[0] == '"' || v.Value[0] == '\'') && v.Value[len(v.Value)-1] == v.Value[0] {
+			if v.Value[0] == '\'' {
+				v.Value = v.Value[1 : len(v.Value)-1]
+			} else if v.Value, err = strconv.Unquote(v.Value); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value for %s", path, n, v.Name)
+			}
+		}
+		v.Secret = true
+		vars = append(vars, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// mergeVars returns vars with later assignments to a name replacing earlier
+// ones, in the order the names were first assigned.
+func mergeVars(vars []Var) []Var {
+	index := map[string]int{}
+	var merged []Var
+	for _, v := range vars {
+		if i, ok := index[v.Name]; ok {
+			merged[i] = v
+			continue
+		}
+		index[v.Name] = len(merged)
+		merged = append(merged, v)
+	}
+	return merged
+}
+
+// maskedCommand returns the command line of bin with args for logging, with
+// the values of secret variables masked.
+func maskedCommand(bin string, args []string, vars []Var) string {
+	secret := map[string]bool{}
+	for _, v := range vars {
+		if v.Secret {
+			secret[v.String()] = true
+		}
+	}
+	parts := []string{bin}
+	for _, arg := range args {
+		if secret[arg] {
+			name, _, _ := strings.Cut(arg, "=")
+			arg = name + "=" + secretMask
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
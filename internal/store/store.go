@@ -2,12 +2,21 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/TrianaLab/remake/config"
 	"github.com/TrianaLab/remake/internal/cache"
+	"github.com/TrianaLab/remake/internal/cacheserver"
 	"github.com/TrianaLab/remake/internal/client"
+	"github.com/TrianaLab/remake/internal/redact"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // overrideable constructors for testing
@@ -17,6 +26,8 @@ var (
 	parseReference = func(cfg *config.Config, ref string) config.ReferenceType {
 		return cfg.ParseReference(ref)
 	}
+	layoutBlobPath = client.LayoutBlobPath
+	fetchCached    = cacheserver.Fetch
 )
 
 // Store defines the interface for login, push, and pull operations
@@ -25,12 +36,63 @@ type Store interface {
 	// Login authenticates against the given registry endpoint.
 	Login(ctx context.Context, registry, user, pass string) error
 
-	// Push uploads the local Makefile at path to the specified reference.
-	Push(ctx context.Context, reference, path string) error
+	// Push uploads the local Makefile at path to the specified reference
+	// and returns the descriptor of the pushed manifest or file.
+	Push(ctx context.Context, reference, path string) (v1.Descriptor, error)
 
-	// Pull retrieves a Makefile artifact by reference and returns
-	// the local filesystem path where it is stored.
-	Pull(ctx context.Context, reference string) (string, error)
+	// Pull retrieves a Makefile artifact by reference and returns where it
+	// is stored on the local filesystem.
+	Pull(ctx context.Context, reference string) (Artifact, error)
+
+	// Lookup returns the local path of the Makefile for reference without
+	// network access: local files and OCI layouts are read in place and
+	// remote references are served from the cache only.
+	Lookup(ctx context.Context, reference string) (string, error)
+
+	// References returns the remote references with an artifact in the
+	// local cache, sorted.
+	References(ctx context.Context) ([]string, error)
+
+	// Copy promotes the artifact at src to dst directly between registries.
+	Copy(ctx context.Context, src, dst string) error
+
+	// Delete removes the manifest behind reference from its registry and
+	// drops the matching local cache entry.
+	Delete(ctx context.Context, reference string) error
+
+	// Untag removes the tag in reference from its registry and drops the
+	// matching local cache entry.
+	Untag(ctx context.Context, reference string) error
+
+	// Export copies the artifact at reference into an OCI layout directory
+	// or tarball at path.
+	Export(ctx context.Context, reference, path string) error
+
+	// Import copies an artifact from the OCI layout directory or tarball at
+	// path to reference.
+	Import(ctx context.Context, path, reference string) error
+}
+
+// Artifact is a Makefile artifact resolved to a local file by Store.Pull.
+type Artifact struct {
+	// Path is the local file holding the Makefile.
+	Path string
+
+	// Digest is the digest of the Makefile content.
+	Digest digest.Digest
+
+	// Cached reports whether the artifact was served from the local cache
+	// without contacting a remote.
+	Cached bool
+
+	// Annotations are the annotations of the artifact, for caches that keep
+	// them (see cache.Annotator).
+	Annotations map[string]string
+
+	// Resolved is the fully qualified reference the artifact was resolved
+	// from, e.g. ghcr.io/org/repo:latest for org/repo. Other references are
+	// used as-is.
+	Resolved string
 }
 
 // ArtifactStore implements the Store interface by delegating to
@@ -51,56 +113,288 @@ func (s *ArtifactStore) Login(ctx context.Context, reg, user, pass string) error
 }
 
 // Push uploads and caches a Makefile artifact based on its reference type.
-// For OCI references, it pushes to the registry and then caches the data locally.
-// HTTP and local references are not supported for push operations.
-func (s *ArtifactStore) Push(ctx context.Context, reference, path string) error {
+// For OCI and HTTP(S) references, it pushes to the remote endpoint and then
+// caches the data locally. Local references are not supported for push operations.
+func (s *ArtifactStore) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
 	switch parseReference(s.cfg, reference) {
-	case config.ReferenceHTTP:
-		return fmt.Errorf("pushing to HTTP(s) references is not supported")
 	case config.ReferenceLocal:
-		return fmt.Errorf("pushing local references is not supported")
-	case config.ReferenceOCI:
+		return v1.Descriptor{}, fmt.Errorf("pushing local references is not supported")
+	case config.ReferenceGit:
+		return v1.Descriptor{}, fmt.Errorf("pushing to git references is not supported")
+	case config.ReferenceOCILayout:
+		// Layouts are already local; there is nothing to cache
+		return newClient(s.cfg, reference).Push(ctx, reference, path)
+	case config.ReferenceHTTP, config.ReferenceOCI:
 		c := newClient(s.cfg, reference)
-		if err := c.Push(ctx, reference, path); err != nil {
-			return err
+		desc, err := c.Push(ctx, reference, path)
+		if err != nil {
+			return v1.Descriptor{}, err
 		}
-		// Read file data for caching
-		data, err := os.ReadFile(path)
+		// Stream the file into the cache
+		f, err := os.Open(path)
 		if err != nil {
-			return err
+			return v1.Descriptor{}, err
 		}
+		defer func() { _ = f.Close() }()
 		cacheRepo := newCache(s.cfg, reference)
-		return cacheRepo.Push(ctx, reference, data)
+		if err := cacheRepo.Push(ctx, reference, v1.Descriptor{MediaType: cache.FileMediaType}, f); err != nil {
+			return v1.Descriptor{}, err
+		}
+		return desc, nil
 	default:
-		return fmt.Errorf("unknown reference type for %s", reference)
+		return v1.Descriptor{}, fmt.Errorf("unknown reference type for %s", reference)
 	}
 }
 
 // Pull retrieves a Makefile artifact, using cache when enabled.
-// For local references, it returns the path directly. For other types,
-// it attempts to read from cache (unless NoCache is set), otherwise fetches
-// from the registry and then caches the result.
-func (s *ArtifactStore) Pull(ctx context.Context, reference string) (string, error) {
+// For local references, it returns the path directly, and for OCI layout
+// references the path of the Makefile blob inside the layout. For other types,
+// it attempts to read from cache (unless NoCache is set), then from the
+// configured cache server, otherwise fetches from the registry, and then
+// caches the result.
+func (s *ArtifactStore) Pull(ctx context.Context, reference string) (Artifact, error) {
 	switch parseReference(s.cfg, reference) {
 	case config.ReferenceLocal:
-		return reference, nil
+		artifact, err := newArtifact(reference, false)
+		artifact.Resolved = reference
+		return artifact, err
+	case config.ReferenceOCILayout:
+		path, err := layoutBlobPath(ctx, reference)
+		if err != nil {
+			return Artifact{}, err
+		}
+		artifact, err := newArtifact(path, false)
+		artifact.Resolved = reference
+		return artifact, err
 	default:
 		// Attempt cache lookup
+		log := s.cfg.Log()
 		cacheRepo := newCache(s.cfg, reference)
+		// Pin moving references, such as git branches, once so that the
+		// fetched artifact is the one the cache keys it by
+		pinned := reference
+		if resolver, ok := cacheRepo.(cache.Resolver); ok {
+			var err error
+			if pinned, err = resolver.Resolve(ctx, reference); err != nil {
+				return Artifact{}, err
+			}
+		}
 		if !s.cfg.NoCache {
-			if path, err := cacheRepo.Pull(ctx, reference); err == nil {
-				return path, nil
+			path, err := cacheRepo.Pull(ctx, pinned)
+			if err == nil {
+				log.Info("cache hit", "reference", redact.Reference(reference), "path", path)
+				return s.cachedArtifact(ctx, cacheRepo, reference, path, true)
 			}
+			log.Info("cache miss", "reference", redact.Reference(reference), "reason", err)
+		}
+		// A cached version with validators is only fetched again if changed
+		var validators map[string]string
+		if revalidator, ok := cacheRepo.(cache.Revalidator); ok {
+			var err error
+			if validators, err = revalidator.Validators(ctx, pinned); err != nil {
+				log.Warn("reading cached validators", "reference", redact.Reference(reference), "error", err)
+			}
+		}
+		desc, rc, err := s.fetch(ctx, pinned, validators)
+		if errors.Is(err, client.ErrNotModified) {
+			log.Info("not modified", "reference", redact.Reference(reference))
+			path, err := cacheRepo.Pull(ctx, pinned)
+			if err != nil {
+				return Artifact{}, err
+			}
+			return s.cachedArtifact(ctx, cacheRepo, reference, path, true)
 		}
-		c := newClient(s.cfg, reference)
-		data, err := c.Pull(ctx, reference)
 		if err != nil {
-			return "", err
+			return Artifact{}, err
+		}
+		// Stream into the cache and return
+		err = cacheRepo.Push(ctx, pinned, desc, rc)
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
 		}
-		// Cache and return
-		if err := cacheRepo.Push(ctx, reference, data); err != nil {
+		if err != nil {
+			return Artifact{}, err
+		}
+		log.Info("cached artifact", "reference", redact.Reference(reference), "digest", desc.Digest)
+		path, err := cacheRepo.Pull(ctx, pinned)
+		if err != nil {
+			return Artifact{}, err
+		}
+		return s.cachedArtifact(ctx, cacheRepo, reference, path, false)
+	}
+}
+
+// Lookup resolves reference to a local file like Pull, but never fetches a
+// missing artifact. Git references are only looked up when pinned to a full
+// commit id, as resolving branches and tags needs the remote.
+func (s *ArtifactStore) Lookup(ctx context.Context, reference string) (string, error) {
+	switch parseReference(s.cfg, reference) {
+	case config.ReferenceLocal:
+		return reference, nil
+	case config.ReferenceOCILayout:
+		return layoutBlobPath(ctx, reference)
+	case config.ReferenceGit:
+		ref, err := config.ParseGitReference(reference)
+		if err != nil {
 			return "", err
 		}
-		return cacheRepo.Pull(ctx, reference)
+		if !commitPattern.MatchString(ref.Ref) {
+			return "", fmt.Errorf("cannot look up %s without resolving %s", reference, ref.Ref)
+		}
+	}
+	return newCache(s.cfg, reference).Pull(ctx, reference)
+}
+
+// commitPattern matches full SHA-1 and SHA-256 commit ids, which git
+// references are cached by.
+var commitPattern = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// References lists the references held by the caches that can enumerate
+// them (see cache.Lister). Git references are not listed, as the cache
+// keeps them by commit.
+func (s *ArtifactStore) References(ctx context.Context) ([]string, error) {
+	var refs []string
+	for _, c := range []cache.CacheRepository{cache.NewOCIRepository(s.cfg), cache.NewHTTPCache(s.cfg)} {
+		lister, ok := c.(cache.Lister)
+		if !ok {
+			continue
+		}
+		cached, err := lister.References(ctx)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, cached...)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// cachedArtifact returns the Artifact for the file at path cached for
+// reference in cacheRepo, with the annotations the cache keeps for it.
+func (s *ArtifactStore) cachedArtifact(ctx context.Context, cacheRepo cache.CacheRepository, reference, path string, cached bool) (Artifact, error) {
+	artifact, err := newArtifact(path, cached)
+	if err != nil {
+		return Artifact{}, err
+	}
+	artifact.Resolved = reference
+	if parseReference(s.cfg, reference) == config.ReferenceOCI {
+		if tag, err := cache.LayoutTag(s.cfg, reference); err == nil {
+			artifact.Resolved = tag
+		}
+	}
+	if annotator, ok := cacheRepo.(cache.Annotator); ok {
+		annotations, err := annotator.Annotations(ctx, reference)
+		if err != nil {
+			s.cfg.Log().Warn("reading cached annotations", "reference", redact.Reference(reference), "error", err)
+		}
+		artifact.Annotations = annotations
+	}
+	return artifact, nil
+}
+
+// newArtifact returns the Artifact for the Makefile at path, hashing it to
+// fill in its digest.
+func newArtifact(path string, cached bool) (Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer func() { _ = f.Close() }()
+	dgst, err := digest.Canonical.FromReader(f)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return Artifact{Path: path, Digest: dgst, Cached: cached}, nil
+}
+
+// fetch downloads reference from the cache server when one is configured and
+// has it, and from its upstream registry otherwise. With validators, the
+// upstream fetch is conditional and returns client.ErrNotModified when the
+// cached version is current.
+func (s *ArtifactStore) fetch(ctx context.Context, reference string, validators map[string]string) (v1.Descriptor, io.ReadCloser, error) {
+	if s.cfg.CacheServer != "" && !s.cfg.NoCache {
+		desc, rc, err := fetchCached(ctx, s.cfg, reference)
+		if err == nil {
+			s.cfg.Log().Info("fetched from cache server", "reference", redact.Reference(reference), "server", s.cfg.CacheServer)
+			return desc, rc, nil
+		}
+		s.cfg.Log().Warn("cache server unavailable, fetching from upstream", "reference", redact.Reference(reference),
+			"server", s.cfg.CacheServer, "error", err)
+	}
+	s.cfg.Log().Info("fetching from upstream", "reference", redact.Reference(reference))
+	if validators != nil {
+		ctx = client.WithValidators(ctx, validators)
+	}
+	return newClient(s.cfg, reference).Pull(ctx, reference)
+}
+
+// Copy transfers an artifact from src to dst without going through the cache.
+// Each side must be an OCI registry or OCI layout reference; credentials for
+// each registry are taken from configuration.
+func (s *ArtifactStore) Copy(ctx context.Context, src, dst string) error {
+	for _, ref := range []string{src, dst} {
+		switch parseReference(s.cfg, ref) {
+		case config.ReferenceOCI, config.ReferenceOCILayout:
+		default:
+			return fmt.Errorf("copying is only supported between OCI references: %s", ref)
+		}
+	}
+	c := newClient(s.cfg, src)
+	return c.Copy(ctx, src, dst)
+}
+
+// Export copies the artifact at reference into the OCI layout at path,
+// tagged with the same tag or digest as reference.
+func (s *ArtifactStore) Export(ctx context.Context, reference, path string) error {
+	return s.Copy(ctx, reference, config.LayoutScheme+path+identifier(reference))
+}
+
+// Import copies the artifact tagged like reference in the OCI layout at path
+// to reference.
+func (s *ArtifactStore) Import(ctx context.Context, path, reference string) error {
+	return s.Copy(ctx, config.LayoutScheme+path+identifier(reference), reference)
+}
+
+// identifier returns the ":<tag>" or "@<digest>" suffix of an OCI reference,
+// defaulting to ":latest" like the registry clients do.
+func identifier(reference string) string {
+	name := reference[strings.LastIndex(reference, "/")+1:]
+	if at := strings.Index(name, "@"); at >= 0 {
+		return name[at:]
+	}
+	if colon := strings.Index(name, ":"); colon >= 0 {
+		return name[colon:]
+	}
+	return ":latest"
+}
+
+// Delete removes an OCI artifact from its registry and evicts it from the
+// local cache under all its tags and its digest, so it can no longer be run
+// from there (see cache.Evicter).
+func (s *ArtifactStore) Delete(ctx context.Context, reference string) error {
+	if parseReference(s.cfg, reference) != config.ReferenceOCI {
+		return fmt.Errorf("deleting is only supported for OCI references: %s", reference)
+	}
+	c := newClient(s.cfg, reference)
+	if err := c.Delete(ctx, reference); err != nil {
+		return err
+	}
+	cacheRepo := newCache(s.cfg, reference)
+	if evicter, ok := cacheRepo.(cache.Evicter); ok {
+		return evicter.Evict(ctx, reference)
+	}
+	return cacheRepo.Delete(ctx, reference)
+}
+
+// Untag removes a tag from its registry and evicts the matching reference
+// from the local cache.
+func (s *ArtifactStore) Untag(ctx context.Context, reference string) error {
+	if parseReference(s.cfg, reference) != config.ReferenceOCI {
+		return fmt.Errorf("untagging is only supported for OCI references: %s", reference)
+	}
+	c := newClient(s.cfg, reference)
+	if err := c.Untag(ctx, reference); err != nil {
+		return err
 	}
+	return newCache(s.cfg, reference).Delete(ctx, reference)
 }
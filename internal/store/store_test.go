@@ -26,42 +26,78 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/TrianaLab/remake/config"
 	"github.com/TrianaLab/remake/internal/cache"
+	"github.com/TrianaLab/remake/internal/cacheserver"
 	"github.com/TrianaLab/remake/internal/client"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/viper"
+	"oras.land/oras-go/v2/content"
 )
 
 type fakeClient struct {
 	pullFunc func(ctx context.Context, reference string) ([]byte, error)
 	pushFunc func(ctx context.Context, reference, path string) error
+	copyFunc func(ctx context.Context, src, dst string) error
+	delFunc  func(ctx context.Context, reference string) error
 }
 
 func (f *fakeClient) Login(ctx context.Context, registry, user, pass string) error {
 	return nil
 }
 
-func (f *fakeClient) Push(ctx context.Context, reference, path string) error {
-	return f.pushFunc(ctx, reference, path)
+func (f *fakeClient) Push(ctx context.Context, reference, path string) (v1.Descriptor, error) {
+	if err := f.pushFunc(ctx, reference, path); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return fakeManifest, nil
 }
 
-func (f *fakeClient) Pull(ctx context.Context, reference string) ([]byte, error) {
-	return f.pullFunc(ctx, reference)
+// fakeManifest is the descriptor returned by fakeClient.Push.
+var fakeManifest = v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("manifest"), Size: 42}
+
+func (f *fakeClient) Pull(ctx context.Context, reference string) (v1.Descriptor, io.ReadCloser, error) {
+	data, err := f.pullFunc(ctx, reference)
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	return content.NewDescriptorFromBytes(cache.FileMediaType, data), io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *fakeClient) Copy(ctx context.Context, src, dst string) error {
+	return f.copyFunc(ctx, src, dst)
+}
+
+func (f *fakeClient) Delete(ctx context.Context, reference string) error {
+	return f.delFunc(ctx, reference)
+}
+
+func (f *fakeClient) Untag(ctx context.Context, reference string) error {
+	return f.delFunc(ctx, reference)
 }
 
 type fakeCache struct {
 	pushFunc func(ctx context.Context, reference string, data []byte) error
 	pullFunc func(ctx context.Context, reference string) (string, error)
+	delFunc  func(ctx context.Context, reference string) error
 }
 
-func (f *fakeCache) Push(ctx context.Context, reference string, data []byte) error {
+func (f *fakeCache) Push(ctx context.Context, reference string, desc v1.Descriptor, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
 	return f.pushFunc(ctx, reference, data)
 }
 
@@ -69,7 +105,14 @@ func (f *fakeCache) Pull(ctx context.Context, reference string) (string, error)
 	return f.pullFunc(ctx, reference)
 }
 
+func (f *fakeCache) Delete(ctx context.Context, reference string) error {
+	return f.delFunc(ctx, reference)
+}
+
 func TestStoreLoginHTTP(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(filepath.Join(t.TempDir(), "config.yaml"))
 	cfg := &config.Config{}
 	s := New(cfg)
 	if err := s.Login(context.Background(), "http://example.com", "user", "pass"); err != nil {
@@ -80,21 +123,21 @@ func TestStoreLoginHTTP(t *testing.T) {
 func TestStorePushErrors(t *testing.T) {
 	cfg := &config.Config{}
 	s := New(cfg)
-	// HTTP reference not supported
-	if err := s.Push(context.Background(), "http://example.com", "path"); err == nil {
-		t.Error("expected error for HTTP push")
+	// HTTP reference with missing file
+	if _, err := s.Push(context.Background(), "http://example.com", "path"); err == nil {
+		t.Error("expected error for HTTP push of missing file")
 	}
 	// Local reference not supported
 	tmp, _ := os.CreateTemp("", "f*")
 	_, _ = tmp.WriteString("x")
 	_ = tmp.Close()
 	defer func() { _ = os.Remove(tmp.Name()) }()
-	if err := s.Push(context.Background(), tmp.Name(), "path"); err == nil {
+	if _, err := s.Push(context.Background(), tmp.Name(), "path"); err == nil {
 		t.Error("expected error for local push")
 	}
 	// OCI missing file
 	ref := "reg.io/repo:tag"
-	if err := s.Push(context.Background(), ref, "nofile"); err == nil {
+	if _, err := s.Push(context.Background(), ref, "nofile"); err == nil {
 		t.Error("expected error for missing file push")
 	}
 }
@@ -111,12 +154,12 @@ func TestStorePullLocal(t *testing.T) {
 
 	cfg := &config.Config{}
 	s := New(cfg)
-	path, err := s.Pull(context.Background(), tmp.Name())
+	artifact, err := s.Pull(context.Background(), tmp.Name())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if path != tmp.Name() {
-		t.Errorf("expected path %q, got %q", tmp.Name(), path)
+	if artifact.Path != tmp.Name() || artifact.Cached || artifact.Resolved != tmp.Name() {
+		t.Errorf("expected uncached path %q, got %+v", tmp.Name(), artifact)
 	}
 }
 
@@ -137,20 +180,15 @@ func TestStorePullHTTP(t *testing.T) {
 	cfg := &config.Config{CacheDir: tmpDir, NoCache: true}
 	s := New(cfg)
 
-	// Pre-create refs/latest symlink to allow cache push
-	u, _ := url.Parse(server.URL)
-	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
-	base := append([]string{cfg.CacheDir, u.Host}, segments...)
-	refDir := filepath.Join(append(base, "refs")...)
-	_ = os.MkdirAll(refDir, 0o755)
-	_ = os.Symlink("dummy", filepath.Join(refDir, "latest"))
-
 	// Pull should fetch, cache, and return file path
-	path, err := s.Pull(context.Background(), server.URL)
+	artifact, err := s.Pull(context.Background(), server.URL)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	data, err := os.ReadFile(path)
+	if artifact.Digest != digest.FromString("hello") {
+		t.Errorf("expected content digest, got %s", artifact.Digest)
+	}
+	data, err := os.ReadFile(artifact.Path)
 	if err != nil {
 		t.Fatalf("failed to read cached file: %v", err)
 	}
@@ -188,16 +226,20 @@ func TestStorePushOCICacheSuccess(t *testing.T) {
 			},
 		}
 	}
-	err = s.Push(context.Background(), "oci://ghcr.io/test/repo:latest", tmpFile.Name())
+	desc, err := s.Push(context.Background(), "oci://ghcr.io/test/repo:latest", tmpFile.Name())
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
+	if desc.Digest != fakeManifest.Digest {
+		t.Errorf("expected the pushed manifest descriptor, got %v", desc)
+	}
 }
 
 func TestStorePullCacheHit(t *testing.T) {
 	cfg := &config.Config{NoCache: false}
 	s := &ArtifactStore{cfg: cfg}
-	expectedPath := "/tmp/dummy.mk"
+	expectedPath := filepath.Join(t.TempDir(), "dummy.mk")
+	_ = os.WriteFile(expectedPath, []byte("all:\n"), 0o644)
 
 	newCache = func(cfg *config.Config, reference string) cache.CacheRepository {
 		return &fakeCache{
@@ -206,12 +248,20 @@ func TestStorePullCacheHit(t *testing.T) {
 			},
 		}
 	}
-	path, err := s.Pull(context.Background(), "oci://ghcr.io/test/repo:latest")
+	artifact, err := s.Pull(context.Background(), "oci://ghcr.io/test/repo:latest")
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
-	if path != expectedPath {
-		t.Errorf("expected path %s, got %s", expectedPath, path)
+	if artifact.Path != expectedPath || !artifact.Cached || artifact.Digest != digest.FromString("all:\n") {
+		t.Errorf("expected cache hit on %s, got %+v", expectedPath, artifact)
+	}
+	if artifact.Resolved != "ghcr.io/test/repo:latest" {
+		t.Errorf("expected the fully qualified reference, got %q", artifact.Resolved)
+	}
+
+	cfg.DefaultRegistry = "ghcr.io"
+	if artifact, err := s.Pull(context.Background(), "test/repo"); err != nil || artifact.Resolved != "ghcr.io/test/repo:latest" {
+		t.Errorf("expected the short form to resolve to the same reference, got %q (%v)", artifact.Resolved, err)
 	}
 }
 
@@ -280,7 +330,7 @@ func TestPushReadFileError(t *testing.T) {
 
 	reference := "oci://ghcr.io/test/repo:tag"
 	path := "no_existe.mk"
-	err := s.Push(context.Background(), reference, path)
+	_, err := s.Push(context.Background(), reference, path)
 	if err == nil {
 		t.Fatalf("expected error for missing file, got nil")
 	}
@@ -303,9 +353,507 @@ func TestPushUnknownReferenceType(t *testing.T) {
 	}()
 
 	reference := "wei://example.com/whatever"
-	err := s.Push(context.Background(), reference, "makefile")
+	_, err := s.Push(context.Background(), reference, "makefile")
 	expected := fmt.Sprintf("unknown reference type for %s", reference)
 	if err == nil || err.Error() != expected {
 		t.Fatalf("expected error %q, got %v", expected, err)
 	}
 }
+
+func TestStoreCopy(t *testing.T) {
+	cfg := &config.Config{}
+	s := &ArtifactStore{cfg: cfg}
+	if err := s.Copy(context.Background(), "http://example.com/mk", "reg.io/repo:tag"); err == nil {
+		t.Error("expected error for HTTP source")
+	}
+	if err := s.Copy(context.Background(), "reg.io/repo:tag", "https://example.com/mk"); err == nil {
+		t.Error("expected error for HTTP destination")
+	}
+
+	orig := newClient
+	defer func() { newClient = orig }()
+	var got []string
+	newClient = func(cfg *config.Config, ref string) client.Client {
+		return &fakeClient{
+			copyFunc: func(ctx context.Context, src, dst string) error {
+				got = []string{src, dst}
+				return nil
+			},
+		}
+	}
+	if err := s.Copy(context.Background(), "reg.io/a:1", "other.io/b:1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0] != "reg.io/a:1" || got[1] != "other.io/b:1" {
+		t.Errorf("unexpected copy args: %v", got)
+	}
+}
+
+func TestStoreDeleteAndUntagEvictCache(t *testing.T) {
+	cfg := &config.Config{}
+	s := &ArtifactStore{cfg: cfg}
+	if err := s.Delete(context.Background(), "http://example.com/mk"); err == nil {
+		t.Error("expected error deleting HTTP reference")
+	}
+	if err := s.Untag(context.Background(), "http://example.com/mk"); err == nil {
+		t.Error("expected error untagging HTTP reference")
+	}
+
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	var remote, evicted []string
+	clientErr := errors.New("denied")
+	newClient = func(cfg *config.Config, ref string) client.Client {
+		return &fakeClient{delFunc: func(ctx context.Context, reference string) error {
+			remote = append(remote, reference)
+			if reference == "reg.io/repo:denied" {
+				return clientErr
+			}
+			return nil
+		}}
+	}
+	newCache = func(cfg *config.Config, ref string) cache.CacheRepository {
+		return &fakeCache{delFunc: func(ctx context.Context, reference string) error {
+			evicted = append(evicted, reference)
+			return nil
+		}}
+	}
+
+	if err := s.Delete(context.Background(), "reg.io/repo:bad"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Untag(context.Background(), "reg.io/repo:old"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Delete(context.Background(), "reg.io/repo:denied"); !errors.Is(err, clientErr) {
+		t.Fatalf("expected client error, got %v", err)
+	}
+	if len(remote) != 3 {
+		t.Errorf("expected 3 registry calls, got %v", remote)
+	}
+	if len(evicted) != 2 || evicted[0] != "reg.io/repo:bad" || evicted[1] != "reg.io/repo:old" {
+		t.Errorf("unexpected cache evictions: %v", evicted)
+	}
+}
+
+func TestStoreDeleteEvictsAllReferences(t *testing.T) {
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newCache = cache.NewCache
+	newClient = func(cfg *config.Config, ref string) client.Client {
+		return &fakeClient{delFunc: func(ctx context.Context, reference string) error { return nil }}
+	}
+	ctx := context.Background()
+	cfg := &config.Config{CacheDir: t.TempDir(), DefaultRegistry: "reg.io"}
+	c := cache.NewOCIRepository(cfg)
+	if err := c.Push(ctx, "reg.io/repo:v1", v1.Descriptor{}, strings.NewReader("all:\n")); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := cache.ResolveLayout(ctx, cfg, "reg.io/repo:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"reg.io/repo:v2", "reg.io/repo:v3"} {
+		tag, err := cache.LayoutTag(cfg, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cache.TagLayout(ctx, cfg, desc, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := New(cfg)
+	if err := s.Untag(ctx, "reg.io/repo:v3"); err != nil {
+		t.Fatalf("untag: %v", err)
+	}
+	if _, err := c.Pull(ctx, "reg.io/repo:v2"); err != nil {
+		t.Errorf("expected untag to keep the other tags: %v", err)
+	}
+	if err := s.Delete(ctx, "reg.io/repo:v1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	for _, ref := range []string{"reg.io/repo:v1", "reg.io/repo:v2", "reg.io/repo@" + desc.Digest.String()} {
+		if _, err := c.Pull(ctx, ref); err == nil {
+			t.Errorf("expected %s to miss the cache after delete", ref)
+		}
+	}
+}
+
+func TestStorePushHTTPCaches(t *testing.T) {
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newClient, newCache = client.NewClient, cache.NewCache
+
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "makefile")
+	_ = os.WriteFile(path, []byte("all:\n\techo ok\n"), 0o644)
+
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	s := New(cfg)
+	ref := server.URL + "/generic/make.mk"
+	if _, err := s.Push(context.Background(), ref, path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(uploaded) != "all:\n\techo ok\n" {
+		t.Errorf("unexpected uploaded body %q", uploaded)
+	}
+	cached, err := cache.NewHTTPCache(cfg).Pull(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("expected cached artifact: %v", err)
+	}
+	if data, _ := os.ReadFile(cached); string(data) != string(uploaded) {
+		t.Errorf("cached data mismatch: %q", data)
+	}
+}
+
+func TestStorePullMaxArtifactSize(t *testing.T) {
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newClient, newCache = client.NewClient, cache.NewCache
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{CacheDir: t.TempDir(), MaxArtifactSize: 32}
+	s := New(cfg)
+	if _, err := s.Pull(context.Background(), server.URL+"/big.mk"); err == nil || !strings.Contains(err.Error(), "maxArtifactSize") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+	cfg.MaxArtifactSize = 64
+	artifact, err := s.Pull(context.Background(), server.URL+"/big.mk")
+	if err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+	if info, err := os.Stat(artifact.Path); err != nil || info.Size() != 64 {
+		t.Errorf("expected 64 byte artifact, got %v (%v)", info, err)
+	}
+}
+
+func TestStorePullLogsCacheDecisions(t *testing.T) {
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newClient, newCache = client.NewClient, cache.NewCache
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("all:\n"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	cfg := &config.Config{CacheDir: t.TempDir(), Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+	s := New(cfg)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Pull(context.Background(), server.URL+"/Makefile?private_token=secret123"); err != nil {
+			t.Fatalf("Pull error: %v", err)
+		}
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret123") {
+		t.Errorf("log output leaks the token:\n%s", out)
+	}
+	for _, want := range []string{"msg=\"cache miss\"", "msg=\"fetching from upstream\"", "msg=\"cached artifact\"", "msg=\"cache hit\""} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in log output:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "fetching from upstream") != 1 {
+		t.Errorf("expected a single upstream fetch:\n%s", out)
+	}
+}
+
+func TestStorePullHTTPVersions(t *testing.T) {
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newClient, newCache = client.NewClient, cache.NewCache
+
+	body := map[string]string{"v1": "one", "v2": "two"}
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + body[r.URL.Query().Get("ref")] + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body[r.URL.Query().Get("ref")]))
+	}))
+
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	s := New(cfg)
+	ctx := context.Background()
+	for ref, want := range body {
+		artifact, err := s.Pull(ctx, server.URL+"/make.mk?ref="+ref)
+		if err != nil {
+			t.Fatalf("Pull error: %v", err)
+		}
+		if data, _ := os.ReadFile(artifact.Path); string(data) != want {
+			t.Errorf("%s: expected %q, got %q", ref, want, data)
+		}
+	}
+
+	// A new version replaces latest, and the old one stays reachable by digest
+	body["v1"] = "uno"
+	cfg.NoCache = true
+	if _, err := s.Pull(ctx, server.URL+"/make.mk?ref=v1"); err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+
+	// Fetching an unchanged version again is a conditional request
+	before := downloads
+	artifact, err := s.Pull(ctx, server.URL+"/make.mk?ref=v1")
+	if err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+	if data, _ := os.ReadFile(artifact.Path); string(data) != "uno" || !artifact.Cached || downloads != before {
+		t.Errorf("expected the cached 'uno' to be revalidated, got %q (cached %v, %d downloads)", data, artifact.Cached, downloads-before)
+	}
+	server.Close()
+	cfg.NoCache = false
+	pinned := fmt.Sprintf("%s/make.mk?ref=v1#%s", server.URL, content.NewDescriptorFromBytes("", []byte("one")).Digest)
+	artifact, err = s.Pull(ctx, pinned)
+	if err != nil {
+		t.Fatalf("pinned Pull error: %v", err)
+	}
+	if data, _ := os.ReadFile(artifact.Path); string(data) != "one" {
+		t.Errorf("expected pinned version 'one', got %q", data)
+	}
+	artifact, err = s.Pull(ctx, server.URL+"/make.mk?ref=v1")
+	if err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+	if data, _ := os.ReadFile(artifact.Path); string(data) != "uno" {
+		t.Errorf("expected latest 'uno', got %q", data)
+	}
+}
+
+func TestStorePullCacheServer(t *testing.T) {
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newCache = cache.NewCache
+	upstream := 0
+	newClient = func(cfg *config.Config, reference string) client.Client {
+		return &fakeClient{pullFunc: func(ctx context.Context, reference string) ([]byte, error) {
+			upstream++
+			return []byte("from registry"), nil
+		}}
+	}
+
+	// The server holds reg.io/team/make:v1 in its cache layout
+	ctx := context.Background()
+	serverCfg := &config.Config{CacheDir: t.TempDir(), ServeCacheHosts: []string{"reg.io"}}
+	if err := cache.NewOCIRepository(serverCfg).Push(ctx, "reg.io/team/make:v1", v1.Descriptor{}, strings.NewReader("from cache server")); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := cache.ResolveLayout(ctx, serverCfg, "reg.io/team/make:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := 0
+	server := httptest.NewServer(cacheserver.NewHandler(serverCfg, cacheserver.PullFunc(func(ctx context.Context, reference string) (string, error) {
+		served++
+		return cache.NewOCIRepository(serverCfg).Pull(ctx, reference)
+	})))
+	defer server.Close()
+
+	cfg := &config.Config{CacheDir: t.TempDir(), DefaultRegistry: "reg.io", CacheServer: server.URL}
+	s := New(cfg)
+	artifact, err := s.Pull(ctx, "reg.io/team/make:v1")
+	if err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+	if data, _ := os.ReadFile(artifact.Path); string(data) != "from cache server" || served == 0 || upstream != 0 {
+		t.Errorf("expected artifact from cache server, got %q (served=%d, upstream=%d)", data, served, upstream)
+	}
+	if got, err := cache.ResolveLayout(ctx, cfg, "reg.io/team/make:v1"); err != nil || got.Digest != manifest.Digest {
+		t.Errorf("expected the server's manifest %s, got %s (%v)", manifest.Digest, got.Digest, err)
+	}
+
+	// Local cache hits do not reach the server
+	served = 0
+	if _, err := s.Pull(ctx, "reg.io/team/make:v1"); err != nil || served != 0 {
+		t.Errorf("expected local cache hit, got err=%v served=%d", err, served)
+	}
+
+	// Misses on the server fall back to the registry
+	artifact, err = s.Pull(ctx, "reg.io/team/other:v1")
+	if err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+	if data, _ := os.ReadFile(artifact.Path); string(data) != "from registry" || upstream != 1 {
+		t.Errorf("expected fallback to registry, got %q", data)
+	}
+}
+
+func TestStorePullGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	origClient, origCache := newClient, newCache
+	defer func() { newClient, newCache = origClient, origCache }()
+	newClient, newCache = client.NewClient, cache.NewCache
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main", "repo")
+	_ = os.WriteFile(filepath.Join(dir, "repo", "Makefile"), []byte("all:\n"), 0o644)
+	git("-C", "repo", "add", ".")
+	git("-C", "repo", "commit", "-q", "-m", "init")
+
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	s := New(cfg)
+	ref := "git+file://" + filepath.Join(dir, "repo") + "//Makefile@main"
+	artifact, err := s.Pull(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := artifact.Path
+	if data, _ := os.ReadFile(path); string(data) != "all:\n" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if !strings.HasPrefix(path, cfg.CacheDir) {
+		t.Errorf("expected cached path, got %q", path)
+	}
+	if _, err := s.Push(context.Background(), ref, path); err == nil {
+		t.Error("expected error pushing to git reference")
+	}
+
+	// A tag named like a branch wins, as it does for git itself, and the
+	// file is fetched from exactly the commit the cache keys it by
+	git("-C", "repo", "tag", "main")
+	_ = os.WriteFile(filepath.Join(dir, "repo", "Makefile"), []byte("all: two\n"), 0o644)
+	git("-C", "repo", "commit", "-q", "-am", "two")
+	s = New(&config.Config{CacheDir: t.TempDir()})
+	artifact, err = s.Pull(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(artifact.Path); string(data) != "all:\n" {
+		t.Errorf("expected the tagged content, got %q", data)
+	}
+	tagged, err := exec.Command("git", "-C", filepath.Join(dir, "repo"), "rev-parse", "main^{commit}").Output()
+	if err != nil {
+		t.Fatalf("git rev-parse: %v", err)
+	}
+	pinned := strings.TrimSuffix(ref, "main") + strings.TrimSpace(string(tagged))
+	if path, err := s.Lookup(context.Background(), pinned); err != nil || path != artifact.Path {
+		t.Errorf("expected the file to be cached under the tagged commit, got %q, %v", path, err)
+	}
+}
+
+func TestStoreExportImport(t *testing.T) {
+	origClient := newClient
+	defer func() { newClient = origClient }()
+	var got [][]string
+	newClient = func(cfg *config.Config, ref string) client.Client {
+		return &fakeClient{copyFunc: func(ctx context.Context, src, dst string) error {
+			got = append(got, []string{src, dst})
+			return nil
+		}}
+	}
+	s := &ArtifactStore{cfg: &config.Config{}}
+	ctx := context.Background()
+	if err := s.Export(ctx, "ghcr.io/org/make:1.0.0", "out.tar"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Import(ctx, "/srv/layout", "reg.io/org/make@sha256:abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Export(ctx, "org/make", "layout"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]string{
+		{"ghcr.io/org/make:1.0.0", "oci-layout://out.tar:1.0.0"},
+		{"oci-layout:///srv/layout@sha256:abc", "reg.io/org/make@sha256:abc"},
+		{"org/make", "oci-layout://layout:latest"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if err := s.Export(ctx, "https://example.com/mk", "out"); err == nil {
+		t.Error("expected error exporting HTTP reference")
+	}
+}
+
+func TestStorePullLayout(t *testing.T) {
+	origLayout := layoutBlobPath
+	defer func() { layoutBlobPath = origLayout }()
+	blob := filepath.Join(t.TempDir(), "abc")
+	_ = os.WriteFile(blob, []byte("all:\n"), 0o644)
+	layoutBlobPath = func(ctx context.Context, reference string) (string, error) {
+		return blob, nil
+	}
+	s := New(&config.Config{})
+	artifact, err := s.Pull(context.Background(), "oci-layout:///layout:v1")
+	if err != nil || artifact.Path != blob || artifact.Digest != digest.FromString("all:\n") {
+		t.Errorf("expected blob path, got %+v, %v", artifact, err)
+	}
+}
+
+func TestStoreLookupAndReferences(t *testing.T) {
+	origCache := newCache
+	defer func() { newCache = origCache }()
+	newCache = cache.NewCache
+	ctx := context.Background()
+
+	cfg := &config.Config{CacheDir: t.TempDir(), DefaultRegistry: "ghcr.io"}
+	s := New(cfg)
+	if refs, err := s.References(ctx); err != nil || len(refs) != 0 {
+		t.Fatalf("expected no references in an empty cache, got %v (%v)", refs, err)
+	}
+
+	httpRef := "https://example.com/make/go.mk"
+	if err := cache.NewHTTPCache(cfg).Push(ctx, httpRef, v1.Descriptor{}, strings.NewReader("http:\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.NewOCIRepository(cfg).Push(ctx, "org/make:v1", v1.Descriptor{}, strings.NewReader("oci:\n")); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := s.References(ctx)
+	if err != nil {
+		t.Fatalf("References error: %v", err)
+	}
+	if want := []string{"ghcr.io/org/make:v1", httpRef}; strings.Join(refs, " ") != strings.Join(want, " ") {
+		t.Errorf("expected references %v, got %v", want, refs)
+	}
+
+	for ref, want := range map[string]string{httpRef: "http:\n", "org/make:v1": "oci:\n"} {
+		path, err := s.Lookup(ctx, ref)
+		if err != nil {
+			t.Fatalf("Lookup(%s) error: %v", ref, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != want {
+			t.Errorf("Lookup(%s): unexpected content %q", ref, data)
+		}
+	}
+	if _, err := s.Lookup(ctx, "org/make:v2"); err == nil {
+		t.Error("expected cache miss for an uncached reference")
+	}
+	if _, err := s.Lookup(ctx, "git+https://example.com/org/make.git//go.mk@main"); err == nil || !strings.Contains(err.Error(), "without resolving") {
+		t.Errorf("expected git branches not to be resolved, got %v", err)
+	}
+	if _, err := s.Lookup(ctx, "git+https://example.com/org/make.git//go.mk@"+strings.Repeat("a", 64)); err == nil || strings.Contains(err.Error(), "without resolving") {
+		t.Errorf("expected a SHA-256 commit to be looked up as a cache miss, got %v", err)
+	}
+	local := filepath.Join(t.TempDir(), "Makefile")
+	_ = os.WriteFile(local, []byte("all:\n"), 0o644)
+	if path, err := s.Lookup(ctx, local); err != nil || path != local {
+		t.Errorf("expected local files as-is, got %s (%v)", path, err)
+	}
+}